@@ -112,10 +112,16 @@ type APIRequest[In, Out any] struct {
 	a                   *Agent
 	unmarshal           func([]byte, Out) error
 	typ                 RequestType
+	canisterID          principal.Principal
 	methodName          string
 	effectiveCanisterID principal.Principal
 	requestID           RequestID
+	ingressExpiry       uint64
 	data                []byte
+	// cacheKey identifies the query in the query cache, if enabled.
+	cacheKey queryCacheKey
+	// skipVerification skips the verification of query signatures.
+	skipVerification bool
 }
 
 // CreateAPIRequest creates a new api request to the given canister and method using
@@ -134,32 +140,47 @@ func CreateAPIRequest[In, Out any](
 	effectiveCanisterID principal.Principal,
 	methodName string,
 	in In,
+	options ...RequestOption,
 ) (*APIRequest[In, Out], error) {
 	rawArgs, err := marshal(in)
 	if err != nil {
 		return nil, err
 	}
-	nonce := newNonce()
-	requestID, data, err := a.sign(Request{
+	a, opts := a.withRequestOptions(options)
+	nonce := opts.nonce
+	if nonce == nil {
+		nonce = newNonce()
+	}
+	ingressExpiry := a.expiryDate()
+	request := Request{
 		Type:          typ,
 		Sender:        a.Sender(),
 		CanisterID:    canisterID,
 		MethodName:    methodName,
 		Arguments:     rawArgs,
-		IngressExpiry: a.expiryDate(),
+		IngressExpiry: ingressExpiry,
 		Nonce:         nonce,
-	})
+	}
+	requestID, data, err := a.sign(request)
 	if err != nil {
 		return nil, err
 	}
+	var cacheKey queryCacheKey
+	if typ == RequestTypeQuery && a.queryCache != nil {
+		cacheKey = newQueryCacheKey(request)
+	}
 	return &APIRequest[In, Out]{
 		a:                   a,
 		unmarshal:           unmarshal,
 		typ:                 typ,
+		canisterID:          canisterID,
 		methodName:          methodName,
 		effectiveCanisterID: effectiveCanisterID,
 		requestID:           *requestID,
+		ingressExpiry:       ingressExpiry,
 		data:                data,
+		cacheKey:            cacheKey,
+		skipVerification:    opts.skipVerification,
 	}, nil
 }
 
@@ -183,6 +204,10 @@ type Agent struct {
 	queryVerificationCache *queryVerificationKeyCache
 	sender                 principal.Principal
 	senderPubKey           []byte
+	journal                CallJournal
+	tracer                 Tracer
+	metrics                Metrics
+	queryCache             *queryCache
 }
 
 // New returns a new Agent based on the given configuration.
@@ -196,6 +221,7 @@ func New(cfg Config) (*Agent, error) {
 		id = cfg.Identity
 	}
 	client := NewClient(cfg.ClientConfig...)
+	client.interceptors = append(client.interceptors, cfg.Interceptors...)
 	rootKey, err := hex.DecodeString(certification.RootKey)
 	if err != nil {
 		return nil, err
@@ -233,10 +259,19 @@ func New(cfg Config) (*Agent, error) {
 		senderPubKey:           id.PublicKey(),
 		verifySignatures:       !cfg.DisableSignedQueryVerification,
 		queryVerificationCache: newQueryVerificationKeyCache(cfg.IngressExpiry),
+		journal:                cfg.CallJournal,
+		tracer:                 cfg.Tracer,
+		metrics:                cfg.Metrics,
 	}
 	if cfg.RouteProvider != nil {
 		a.client.SetRouteProvider(cfg.RouteProvider)
 	}
+	if cfg.RetryPolicy != nil {
+		a.client.retryPolicy = *cfg.RetryPolicy
+	}
+	if cfg.QueryCache != nil {
+		a.queryCache = newQueryCache(*cfg.QueryCache)
+	}
 
 	return a, nil
 }
@@ -246,8 +281,24 @@ func (a Agent) Client() *Client {
 	return &a.client
 }
 
+// VerifiesQuerySignatures returns whether the node signatures of query
+// responses are verified, see Config.DisableSignedQueryVerification.
+func (a Agent) VerifiesQuerySignatures() bool {
+	return a.verifySignatures
+}
+
 // CreateCandidAPIRequest creates a new api request to the given canister and method.
 func (a *Agent) CreateCandidAPIRequest(typ RequestType, canisterID principal.Principal, methodName string, args ...any) (*CandidAPIRequest, error) {
+	return a.createCandidAPIRequest(typ, canisterID, methodName, args, nil)
+}
+
+// CreateCandidAPIRequestWithOptions is like CreateCandidAPIRequest, but applies
+// the given request options.
+func (a *Agent) CreateCandidAPIRequestWithOptions(typ RequestType, canisterID principal.Principal, methodName string, args []any, options ...RequestOption) (*CandidAPIRequest, error) {
+	return a.createCandidAPIRequest(typ, canisterID, methodName, args, options)
+}
+
+func (a *Agent) createCandidAPIRequest(typ RequestType, canisterID principal.Principal, methodName string, args []any, options []RequestOption) (*CandidAPIRequest, error) {
 	return CreateAPIRequest(
 		a,
 		candid.Marshal,
@@ -257,11 +308,12 @@ func (a *Agent) CreateCandidAPIRequest(typ RequestType, canisterID principal.Pri
 		effectiveCanisterID(canisterID, args),
 		methodName,
 		args,
+		options...,
 	)
 }
 
 // CreateProtoAPIRequest creates a new api request to the given canister and method.
-func (a *Agent) CreateProtoAPIRequest(typ RequestType, canisterID principal.Principal, methodName string, message proto.Message) (*ProtoAPIRequest, error) {
+func (a *Agent) CreateProtoAPIRequest(typ RequestType, canisterID principal.Principal, methodName string, message proto.Message, options ...RequestOption) (*ProtoAPIRequest, error) {
 	return CreateAPIRequest(
 		a,
 		func(m proto.Message) ([]byte, error) {
@@ -281,6 +333,7 @@ func (a *Agent) CreateProtoAPIRequest(typ RequestType, canisterID principal.Prin
 		canisterID,
 		methodName,
 		message,
+		options...,
 	)
 }
 
@@ -293,7 +346,7 @@ func (a *Agent) CreateProtoAPIRequest(typ RequestType, canisterID principal.Prin
 //	req, _ := a.CreateRawAPIRequest(agent.RequestTypeCall, canisterID, "ingest", cborBytes)
 //	var reply []byte
 //	_ = req.CallAndWait(&reply)
-func (a *Agent) CreateRawAPIRequest(typ RequestType, canisterID principal.Principal, methodName string, arg []byte) (*RawAPIRequest, error) {
+func (a *Agent) CreateRawAPIRequest(typ RequestType, canisterID principal.Principal, methodName string, arg []byte, options ...RequestOption) (*RawAPIRequest, error) {
 	return CreateAPIRequest(
 		a,
 		func(b []byte) ([]byte, error) { return b, nil },
@@ -303,6 +356,7 @@ func (a *Agent) CreateRawAPIRequest(typ RequestType, canisterID principal.Princi
 		canisterID,
 		methodName,
 		arg,
+		options...,
 	)
 }
 
@@ -419,7 +473,16 @@ func (a Agent) expiryDate() uint64 {
 	return uint64(time.Now().Add(a.ingressExpiry).UnixNano())
 }
 
-func (a Agent) poll(ctx context.Context, ecID principal.Principal, requestID RequestID) ([]byte, error) {
+func (a Agent) poll(ctx context.Context, ecID principal.Principal, requestID RequestID, ingressExpiry uint64) ([]byte, error) {
+	return a.pollStatus(ctx, ecID, requestID, ingressExpiry, func(ctx context.Context) ([]byte, hashtree.Node, error) {
+		return a.requestStatus(ctx, ecID, requestID)
+	})
+}
+
+// pollStatus polls the status of the request with the given ID until it is
+// replied or rejected, using status to read the certified request status. An
+// ingress expiry of 0 means that the expiry of the request is not known.
+func (a Agent) pollStatus(ctx context.Context, ecID principal.Principal, requestID RequestID, ingressExpiry uint64, status func(ctx context.Context) ([]byte, hashtree.Node, error)) ([]byte, error) {
 	if ctx == nil {
 		ctx = a.ctx
 	}
@@ -430,31 +493,15 @@ func (a Agent) poll(ctx context.Context, ecID principal.Principal, requestID Req
 
 	for {
 		a.logger.Printf("[AGENT] POLL %s %x", ecID, requestID)
-		data, node, err := a.requestStatus(ctx, ecID, requestID)
+		a.recordPoll(ecID)
+		pollCtx, span := a.startSpan(ctx, "agent.poll", ecID, "")
+		data, node, err := status(pollCtx)
+		endSpan(span, err)
 		if err != nil {
 			return nil, err
 		}
-		if len(data) != 0 {
-			path := []hashtree.Label{hashtree.Label("request_status"), requestID[:]}
-			switch string(data) {
-			case "replied":
-				replied, err := hashtree.Lookup(node, append(path, hashtree.Label("reply"))...)
-				if err != nil {
-					return nil, fmt.Errorf("no reply found")
-				}
-				return replied, nil
-			case "rejected":
-				tree := hashtree.NewHashTree(node)
-				code, err := tree.Lookup(append(path, hashtree.Label("reject_code"))...)
-				if err != nil {
-					return nil, err
-				}
-				message, err := tree.Lookup(append(path, hashtree.Label("reject_message"))...)
-				if err != nil {
-					return nil, err
-				}
-				return nil, fmt.Errorf("(%d) %s", uint64FromBytes(code), string(message))
-			}
+		if raw, done, err := requestResult(data, node, requestID, ingressExpiry); done {
+			return raw, err
 		}
 
 		select {
@@ -467,13 +514,57 @@ func (a Agent) poll(ctx context.Context, ecID principal.Principal, requestID Req
 	}
 }
 
+// unknownStatusMargin is the time after the ingress expiry of a request after
+// which a request that is unknown to the IC is not executed anymore. It covers
+// the difference between the clocks of the agent and the IC.
+const unknownStatusMargin = 2 * time.Minute
+
+// requestResult returns the reply of a replied request, or the error of a
+// rejected request, or an UnknownOutcomeError if the outcome of the request
+// can not be known anymore. done is false if the outcome is not known yet.
+func requestResult(status []byte, node hashtree.Node, requestID RequestID, ingressExpiry uint64) (raw []byte, done bool, err error) {
+	path := []hashtree.Label{hashtree.Label("request_status"), requestID[:]}
+	switch string(status) {
+	case "replied":
+		replied, err := hashtree.Lookup(node, append(path, hashtree.Label("reply"))...)
+		if err != nil {
+			return nil, true, fmt.Errorf("no reply found")
+		}
+		return replied, true, nil
+	case "rejected":
+		tree := hashtree.NewHashTree(node)
+		code, err := tree.Lookup(append(path, hashtree.Label("reject_code"))...)
+		if err != nil {
+			return nil, true, err
+		}
+		message, err := tree.Lookup(append(path, hashtree.Label("reject_message"))...)
+		if err != nil {
+			return nil, true, err
+		}
+		errorCode, _ := tree.Lookup(append(path, hashtree.Label("error_code"))...)
+		return nil, true, &RejectError{
+			RejectCode: RejectCode(uint64FromBytes(code)),
+			Message:    string(message),
+			ErrorCode:  string(errorCode),
+		}
+	case "done":
+		return nil, true, &UnknownOutcomeError{RequestID: requestID, Status: "done"}
+	case "":
+		expiry := time.Unix(0, int64(ingressExpiry)).Add(unknownStatusMargin)
+		if ingressExpiry != 0 && time.Now().After(expiry) {
+			return nil, true, &UnknownOutcomeError{RequestID: requestID, Status: "unknown"}
+		}
+		return nil, false, nil
+	default:
+		return nil, false, nil
+	}
+}
+
 func (a Agent) readState(ctx context.Context, ecID principal.Principal, data []byte) (map[string][]byte, error) {
 	if ctx == nil {
 		ctx = a.ctx
 	}
-	ctx, cancel := context.WithTimeout(ctx, a.readStateTimeout)
-	defer cancel()
-	resp, err := a.client.ReadState(ctx, ecID, data)
+	resp, err := a.readStateRaw(ctx, ecID, data)
 	if err != nil {
 		return nil, err
 	}
@@ -481,6 +572,14 @@ func (a Agent) readState(ctx context.Context, ecID principal.Principal, data []b
 	return m, cbor.Unmarshal(resp, &m)
 }
 
+// readStateRaw sends the signed read_state envelope and returns the CBOR
+// encoded response.
+func (a Agent) readStateRaw(ctx context.Context, ecID principal.Principal, data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.readStateTimeout)
+	defer cancel()
+	return a.client.ReadState(ctx, ecID, data)
+}
+
 func (a Agent) readStateContext(ctx context.Context, ecID principal.Principal, data []byte) (map[string][]byte, error) {
 	return a.readState(ctx, ecID, data)
 }
@@ -495,22 +594,64 @@ func (a Agent) readStateCertificate(ctx context.Context, ecID principal.Principa
 	if err != nil {
 		return nil, err
 	}
+	return a.readSignedStateCertificate(ctx, ecID, data)
+}
+
+// readSignedStateCertificate sends the signed read_state envelope and verifies
+// the returned certificate.
+func (a Agent) readSignedStateCertificate(ctx context.Context, ecID principal.Principal, data []byte) (_ *certification.Certificate, err error) {
 	a.logger.Printf("[AGENT] READ STATE %s (ecID)", ecID)
-	resp, err := a.readState(ctx, ecID, data)
+	ctx, span := a.startSpan(ctx, "agent.read_state", ecID, "")
+	defer func() { endSpan(span, err) }()
+	var certificate *certification.Certificate
+	d := newCachedDecoder(func(ctx context.Context, raw []byte) *Outcome {
+		var err error
+		certificate, err = unmarshalStateCertificate(raw)
+		if err == nil {
+			err = a.verifyCertificate(ctx, *certificate, ecID)
+		}
+		return &Outcome{Err: err}
+	})
+	raw, err := a.readStateRaw(withDecoder(ctx, d.do), ecID, data)
 	if err != nil {
 		return nil, err
 	}
+	if err := d.do(ctx, raw).Err; err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+// unmarshalStateCertificate unmarshals the certificate of a CBOR encoded
+// read_state response.
+func unmarshalStateCertificate(raw []byte) (*certification.Certificate, error) {
+	var resp map[string][]byte
+	if err := cbor.Unmarshal(raw, &resp); err != nil {
+		return nil, err
+	}
 	var certificate certification.Certificate
 	if err := cbor.Unmarshal(resp["certificate"], &certificate); err != nil {
 		return nil, err
 	}
+	return &certificate, nil
+}
+
+// verifyCertificate verifies the time and signature of a certificate, and
+// that the canister is in the canister ranges of the signing subnet.
+func (a Agent) verifyCertificate(ctx context.Context, certificate certification.Certificate, ecID principal.Principal) (err error) {
+	_, span := a.startSpan(ctx, "agent.verify_certificate", ecID, "")
+	start := a.startTimer()
+	defer func() {
+		a.recordVerification("certificate", start, err)
+		endSpan(span, err)
+	}()
 	if err := certificate.VerifyTime(a.ingressExpiry); err != nil {
-		return nil, err
+		return &VerificationError{Err: err}
 	}
 	if err := certification.VerifyCertificate(certificate, ecID, a.rootKey); err != nil {
-		return nil, err
+		return &VerificationError{Err: err}
 	}
-	return &certificate, nil
+	return nil
 }
 
 func (a Agent) readStateCertificateContext(ctx context.Context, ecID principal.Principal, paths [][]hashtree.Label) (*certification.Certificate, error) {
@@ -522,9 +663,7 @@ func (a Agent) ReadSubnetState(subnetID principal.Principal, data []byte) (map[s
 }
 
 func (a Agent) ReadSubnetStateContext(ctx context.Context, subnetID principal.Principal, data []byte) (map[string][]byte, error) {
-	ctx, cancel := context.WithTimeout(ctx, a.readStateTimeout)
-	defer cancel()
-	resp, err := a.client.ReadSubnetState(ctx, subnetID, data)
+	resp, err := a.readSubnetStateRaw(ctx, subnetID, data)
 	if err != nil {
 		return nil, err
 	}
@@ -532,11 +671,19 @@ func (a Agent) ReadSubnetStateContext(ctx context.Context, subnetID principal.Pr
 	return m, cbor.Unmarshal(resp, &m)
 }
 
+// readSubnetStateRaw sends the signed subnet read_state envelope and returns
+// the CBOR encoded response.
+func (a Agent) readSubnetStateRaw(ctx context.Context, subnetID principal.Principal, data []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.readStateTimeout)
+	defer cancel()
+	return a.client.ReadSubnetState(ctx, subnetID, data)
+}
+
 func (a Agent) ReadSubnetStateCertificate(subnetID principal.Principal, paths [][]hashtree.Label) (*certification.Certificate, error) {
 	return a.ReadSubnetStateCertificateContext(a.ctx, subnetID, paths)
 }
 
-func (a Agent) ReadSubnetStateCertificateContext(ctx context.Context, subnetID principal.Principal, paths [][]hashtree.Label) (*certification.Certificate, error) {
+func (a Agent) ReadSubnetStateCertificateContext(ctx context.Context, subnetID principal.Principal, paths [][]hashtree.Label) (_ *certification.Certificate, err error) {
 	_, data, err := a.sign(Request{
 		Type:          RequestTypeReadState,
 		Sender:        a.Sender(),
@@ -547,21 +694,42 @@ func (a Agent) ReadSubnetStateCertificateContext(ctx context.Context, subnetID p
 		return nil, err
 	}
 	a.logger.Printf("[AGENT] READ SUBNET STATE %s (subnetID)", subnetID)
-	resp, err := a.ReadSubnetStateContext(ctx, subnetID, data)
+	ctx, span := a.startSpan(ctx, "agent.read_state", subnetID, "")
+	defer func() { endSpan(span, err) }()
+	var certificate *certification.Certificate
+	d := newCachedDecoder(func(ctx context.Context, raw []byte) *Outcome {
+		var err error
+		certificate, err = unmarshalStateCertificate(raw)
+		if err == nil {
+			err = a.verifySubnetCertificate(ctx, *certificate, subnetID)
+		}
+		return &Outcome{Err: err}
+	})
+	raw, err := a.readSubnetStateRaw(withDecoder(ctx, d.do), subnetID, data)
 	if err != nil {
 		return nil, err
 	}
-	var certificate certification.Certificate
-	if err := cbor.Unmarshal(resp["certificate"], &certificate); err != nil {
+	if err := d.do(ctx, raw).Err; err != nil {
 		return nil, err
 	}
-	if err := certificate.VerifyTime(a.ingressExpiry); err != nil {
-		return nil, err
+	return certificate, nil
+}
+
+// verifySubnetCertificate verifies the time and signature of a certificate of
+// the subnet.
+func (a Agent) verifySubnetCertificate(ctx context.Context, certificate certification.Certificate, subnetID principal.Principal) error {
+	_, span := a.startSpan(ctx, "agent.verify_certificate", subnetID, "")
+	start := a.startTimer()
+	err := certificate.VerifyTime(a.ingressExpiry)
+	if err == nil {
+		err = certification.VerifySubnetCertificate(certificate, subnetID, a.rootKey)
 	}
-	if err := certification.VerifySubnetCertificate(certificate, subnetID, a.rootKey); err != nil {
-		return nil, err
+	a.recordVerification("certificate", start, err)
+	endSpan(span, err)
+	if err != nil {
+		return &VerificationError{Err: err}
 	}
-	return &certificate, nil
+	return nil
 }
 
 func (a Agent) requestStatus(ctx context.Context, ecID principal.Principal, requestID RequestID) ([]byte, hashtree.Node, error) {
@@ -575,15 +743,24 @@ func (a Agent) requestStatus(ctx context.Context, ecID principal.Principal, requ
 }
 
 func (a Agent) sign(request Request) (*RequestID, []byte, error) {
+	var delegations []identity.SignedDelegation
+	if id, ok := a.identity.(delegatedIdentity); ok {
+		// Requests with an invalid delegation are rejected by the replica.
+		if err := id.Check(request.CanisterID, time.Now()); err != nil {
+			return nil, nil, err
+		}
+		delegations = id.Delegations()
+	}
 	requestID := NewRequestID(request)
 	sig, err := requestID.Sign(a.identity)
 	if err != nil {
 		return nil, nil, err
 	}
 	data, err := cbor.Marshal(Envelope{
-		Content:      request,
-		SenderPubKey: a.identity.PublicKey(),
-		SenderSig:    sig,
+		Content:          request,
+		SenderPubKey:     a.identity.PublicKey(),
+		SenderSig:        sig,
+		SenderDelegation: delegations,
 	})
 	if err != nil {
 		return nil, nil, err
@@ -593,6 +770,13 @@ func (a Agent) sign(request Request) (*RequestID, []byte, error) {
 
 type CandidAPIRequest = APIRequest[[]any, []any]
 
+// delegatedIdentity is an identity that signs on behalf of another key, see
+// identity.DelegatedIdentity.
+type delegatedIdentity interface {
+	Check(canisterID principal.Principal, now time.Time) error
+	Delegations() []identity.SignedDelegation
+}
+
 // Config is the configuration for an Agent.
 type Config struct {
 	// Identity is the identity used by the Agent.
@@ -622,6 +806,24 @@ type Config struct {
 	// a custom one. To use on-chain discovery, call DiscoverRoutes against
 	// a freshly constructed agent and pass the result to a RouteProvider.
 	RouteProvider RouteProvider
+	// RetryPolicy, if non-nil, determines how requests are retried on transient
+	// failures. The default is DefaultRetryPolicy.
+	RetryPolicy *RetryPolicy
+	// CallJournal, if non-nil, records update calls until they are replied or
+	// rejected, so that they can be resumed with Wait after a restart.
+	CallJournal CallJournal
+	// Interceptors intercept every call, query and read_state request that is
+	// sent by the agent. The first interceptor is the outermost one.
+	Interceptors []Interceptor
+	// Tracer, if non-nil, is used to trace calls, queries, polls, read_state
+	// requests and verifications.
+	Tracer Tracer
+	// Metrics, if non-nil, records the latency and results of requests.
+	Metrics Metrics
+	// QueryCache, if non-nil, enables caching of query responses. Responses
+	// are only cached once their signatures are verified, and identical
+	// concurrent queries are coalesced into a single request.
+	QueryCache *QueryCacheConfig
 }
 
 type ProtoAPIRequest = APIRequest[proto.Message, proto.Message]
@@ -1,6 +1,7 @@
 package agent_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
@@ -14,9 +15,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
 	"github.com/niccolofant/agent-go/candid/idl"
 	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/certification/ii"
 	"github.com/niccolofant/agent-go/identity"
 	"github.com/niccolofant/agent-go/principal"
 )
@@ -303,6 +307,68 @@ func TestAgent_QueryWithContext_cancelled(t *testing.T) {
 	}
 }
 
+func TestAgent_Query_DelegatedIdentity(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica()
+	defer r.Close()
+	r.HandleQuery(canisterID, "whoami", func(call agenttest.Call) ([]any, error) {
+		return []any{call.Sender}, nil
+	})
+
+	root, _ := identity.NewRandomEd25519Identity()
+	session, _ := identity.NewRandomEd25519Identity()
+	newIdentity := func(expiration time.Time) *identity.DelegatedIdentity {
+		chain, err := ii.NewDelegationChain(root, session.PublicKey(), expiration, canisterID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := chain.Identity(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	var envelope agent.Envelope
+	cfg := r.AgentConfig()
+	cfg.Identity = newIdentity(time.Now().Add(time.Hour))
+	cfg.Interceptors = []agent.Interceptor{
+		func(ctx context.Context, op *agent.Operation, next agent.Invoker) ([]byte, error) {
+			if err := cbor.Unmarshal(op.Envelope, &envelope); err != nil {
+				return nil, err
+			}
+			return next(ctx, op)
+		},
+	}
+	a, err := agent.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sender principal.Principal
+	if err := a.Query(canisterID, "whoami", nil, []any{&sender}); err != nil {
+		t.Fatal(err)
+	}
+	if !sender.Equal(root.Sender()) {
+		t.Errorf("got sender %s, want %s", sender, root.Sender())
+	}
+	if !bytes.Equal(envelope.SenderPubKey, root.PublicKey()) {
+		t.Error("expected the public key of the delegating key")
+	}
+	if len(envelope.SenderDelegation) != 1 || !bytes.Equal(envelope.SenderDelegation[0].Delegation.PublicKey, session.PublicKey()) {
+		t.Errorf("unexpected delegations %v", envelope.SenderDelegation)
+	}
+
+	// Requests with an invalid delegation are not sent.
+	other := principal.MustDecode("rrkah-fqaaa-aaaaa-aaaaq-cai")
+	if err := a.Query(other, "whoami", nil, []any{&sender}); !errors.Is(err, identity.ErrDelegationTarget) {
+		t.Errorf("got %v, want %v", err, identity.ErrDelegationTarget)
+	}
+	expired := newIdentity(time.Now().Add(-time.Minute))
+	if err := a.Query(canisterID, "whoami", nil, []any{&sender}, agent.WithIdentity(expired)); !errors.Is(err, identity.ErrDelegationExpired) {
+		t.Errorf("got %v, want %v", err, identity.ErrDelegationExpired)
+	}
+}
+
 func TestAgent_Query_Ed25519(t *testing.T) {
 	id, err := identity.NewRandomEd25519Identity()
 	if err != nil {
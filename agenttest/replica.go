@@ -0,0 +1,560 @@
+// Package agenttest provides an in-process fake replica for testing code that
+// is built on top of the agent.
+//
+// The replica implements the subset of the HTTP interface of the Internet
+// Computer that is used by the agent: status, query, call and read_state. All
+// certificates are signed with a freshly generated root key, and all query
+// responses are signed by a single node, so agents can keep certificate and
+// signature verification enabled. Like the IC, the replica verifies the
+// signatures and delegations of the envelopes it receives.
+//
+// Example:
+//
+//	r := agenttest.NewReplica()
+//	defer r.Close()
+//	r.HandleQuery(canisterID, "greet", func(call agenttest.Call) ([]any, error) {
+//		var name string
+//		if err := call.Decode(&name); err != nil {
+//			return nil, err
+//		}
+//		return []any{"Hello, " + name + "!"}, nil
+//	})
+//	a, _ := agent.New(r.AgentConfig())
+package agenttest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/candid"
+	"github.com/niccolofant/agent-go/certification"
+	"github.com/niccolofant/agent-go/certification/bls"
+	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/certification/ii"
+	"github.com/niccolofant/agent-go/identity"
+	"github.com/niccolofant/agent-go/leb128"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// Call is an incoming call to a canister method.
+type Call struct {
+	// CanisterID is the canister that is called.
+	CanisterID principal.Principal
+	// MethodName is the name of the called method.
+	MethodName string
+	// Sender is the principal that sent the call.
+	Sender principal.Principal
+	// Arg is the Candid encoded argument of the call.
+	Arg []byte
+}
+
+// Decode decodes the Candid argument of the call into the given values.
+func (c Call) Decode(values ...any) error {
+	return candid.Unmarshal(c.Arg, values)
+}
+
+// Handler handles a call to a canister method. The returned values are Candid
+// encoded and used as the reply. Returning a *Reject rejects the call with the
+// given code, any other error rejects it as a canister error.
+type Handler func(call Call) ([]any, error)
+
+// Option is an option for the Replica.
+type Option func(r *Replica)
+
+// WithAsynchronousCalls makes the replica answer every call with 202 Accepted,
+// so that the agent has to poll the request status with read_state.
+func WithAsynchronousCalls() Option {
+	return func(r *Replica) {
+		r.async = true
+	}
+}
+
+// WithBatchedRequestStatus makes the replica accept read_state requests for
+// the status of more than one request. Like the IC, the replica rejects them
+// with 400 Bad Request by default.
+func WithBatchedRequestStatus() Option {
+	return func(r *Replica) {
+		r.batchedRequestStatus = true
+	}
+}
+
+// Reject is an error that can be returned by a Handler to reject a call.
+type Reject struct {
+	// Code is the reject code.
+	Code uint64
+	// Message is the reject message.
+	Message string
+	// ErrorCode is an optional implementation-specific error code.
+	ErrorCode string
+}
+
+func (r *Reject) Error() string {
+	return fmt.Sprintf("(%d) %s", r.Code, r.Message)
+}
+
+// Replica is an in-process fake replica, backed by an httptest.Server.
+type Replica struct {
+	server    *httptest.Server
+	url       *url.URL
+	secretKey *bls.SecretKey
+	rootKey   []byte
+	subnetID  principal.Principal
+	nodeID    principal.Principal
+	nodeKey   ed25519.PrivateKey
+	async     bool
+	// batchedRequestStatus allows reading the status of more than one request
+	// with a single read_state request.
+	batchedRequestStatus bool
+
+	mu        sync.Mutex
+	methods   map[methodKey]method
+	requests  map[agent.RequestID]requestStatus
+	canisters map[string]*canisterState
+	// boundaryNodes are the certified API boundary nodes.
+	boundaryNodes []agent.APIBoundaryNode
+}
+
+// NewReplica starts a new fake replica. The caller should call Close when
+// finished, to shut it down.
+func NewReplica(options ...Option) *Replica {
+	secretKey := bls.NewSecretKeyByCSPRNG()
+	if secretKey == nil {
+		panic("agenttest: failed to generate root key")
+	}
+	publicKey := bls12381.G2Affine(*secretKey.PublicKey())
+	publicKeyBytes := publicKey.Bytes()
+	rootKey, err := certification.PublicBLSKeyToDER(publicKeyBytes[:])
+	if err != nil {
+		panic(fmt.Sprintf("agenttest: %v", err))
+	}
+	nodePublicKey, nodeKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("agenttest: %v", err))
+	}
+	r := &Replica{
+		secretKey: secretKey,
+		rootKey:   rootKey,
+		// Certificates without a delegation are signed by the root subnet.
+		subnetID:  principal.MustDecode(certification.RootSubnetID),
+		nodeID:    principal.NewSelfAuthenticating(nodePublicKey),
+		nodeKey:   nodeKey,
+		methods:   make(map[methodKey]method),
+		requests:  make(map[agent.RequestID]requestStatus),
+		canisters: make(map[string]*canisterState),
+	}
+	for _, o := range options {
+		o(r)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2/status", r.handleStatus)
+	mux.HandleFunc("POST /api/v2/canister/{ecid}/query", r.handleQuery)
+	mux.HandleFunc("POST /api/{version}/canister/{ecid}/call", r.handleCall)
+	mux.HandleFunc("POST /api/{version}/canister/{ecid}/read_state", r.handleReadState)
+	mux.HandleFunc("POST /api/{version}/subnet/{subnetID}/read_state", r.handleReadState)
+	r.server = httptest.NewServer(mux)
+	r.url, _ = url.Parse(r.server.URL)
+	return r
+}
+
+// AgentConfig returns an agent configuration that points to the replica and
+// fetches its root key.
+func (r *Replica) AgentConfig() agent.Config {
+	return agent.Config{
+		ClientConfig: []agent.ClientOption{agent.WithHostURL(r.url)},
+		FetchRootKey: true,
+	}
+}
+
+// Close shuts down the replica.
+func (r *Replica) Close() {
+	r.server.Close()
+}
+
+// HandleQuery registers a query method on the given canister. Query methods can
+// be called both as a query and as an update call.
+func (r *Replica) HandleQuery(canisterID principal.Principal, methodName string, handler Handler) {
+	r.handle(canisterID, methodName, method{handler: handler, query: true})
+}
+
+// HandleUpdate registers an update method on the given canister.
+func (r *Replica) HandleUpdate(canisterID principal.Principal, methodName string, handler Handler) {
+	r.handle(canisterID, methodName, method{handler: handler})
+}
+
+// RemoveReply removes the reply of the replied or rejected request with the
+// given ID, which changes its status to done, like the IC does some time after
+// the request was executed.
+func (r *Replica) RemoveReply(requestID agent.RequestID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if status, ok := r.requests[requestID]; ok && status.status != "processing" {
+		r.requests[requestID] = requestStatus{status: "done"}
+	}
+}
+
+// RootKey returns the DER encoded root key of the replica.
+func (r *Replica) RootKey() []byte {
+	return r.rootKey
+}
+
+// SetAPIBoundaryNodes sets the API boundary nodes that are certified in the
+// api_boundary_nodes sub-tree of the state.
+func (r *Replica) SetAPIBoundaryNodes(nodes []agent.APIBoundaryNode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.boundaryNodes = slices.Clone(nodes)
+}
+
+// SetControllers sets the certified controllers of the given canister.
+func (r *Replica) SetControllers(canisterID principal.Principal, controllers []principal.Principal) {
+	raw := make([][]byte, len(controllers))
+	for i, c := range controllers {
+		raw[i] = c.Raw
+	}
+	controllersCBOR, _ := cbor.Marshal(raw)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.canisterLocked(canisterID).controllers = controllersCBOR
+}
+
+// SetMetadata sets the certified metadata section with the given name of the
+// given canister.
+func (r *Replica) SetMetadata(canisterID principal.Principal, name string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.canisterLocked(canisterID).metadata[name] = data
+}
+
+// SetModuleHash sets the certified module hash of the given canister. A nil
+// hash marks the canister as empty.
+func (r *Replica) SetModuleHash(canisterID principal.Principal, moduleHash []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.canisterLocked(canisterID).moduleHash = moduleHash
+}
+
+// URL returns the base URL of the replica.
+func (r *Replica) URL() *url.URL {
+	return r.url
+}
+
+func (r *Replica) handle(canisterID principal.Principal, methodName string, m method) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.methods[methodKey{canisterID: string(canisterID.Raw), methodName: methodName}] = m
+}
+
+func (r *Replica) canisterLocked(canisterID principal.Principal) *canisterState {
+	c, ok := r.canisters[string(canisterID.Raw)]
+	if !ok {
+		c = &canisterState{metadata: make(map[string][]byte)}
+		r.canisters[string(canisterID.Raw)] = c
+	}
+	return c
+}
+
+// execute runs the handler of the called method and returns its status.
+func (r *Replica) execute(content agent.Request, query bool) requestStatus {
+	canisterID := content.CanisterID
+	r.mu.Lock()
+	m, ok := r.methods[methodKey{canisterID: string(canisterID.Raw), methodName: content.MethodName}]
+	r.mu.Unlock()
+	if !ok {
+		return rejected(&Reject{
+			Code:      3,
+			Message:   fmt.Sprintf("Canister %s has no method '%s'", canisterID, content.MethodName),
+			ErrorCode: "IC0302",
+		})
+	}
+	if query && !m.query {
+		return rejected(&Reject{
+			Code:      3,
+			Message:   fmt.Sprintf("Canister %s has no query method '%s'", canisterID, content.MethodName),
+			ErrorCode: "IC0302",
+		})
+	}
+	values, err := m.handler(Call{
+		CanisterID: canisterID,
+		MethodName: content.MethodName,
+		Sender:     content.Sender,
+		Arg:        content.Arguments,
+	})
+	if err != nil {
+		return rejected(err)
+	}
+	reply, err := candid.Marshal(values)
+	if err != nil {
+		return rejected(fmt.Errorf("failed to encode reply: %w", err))
+	}
+	return requestStatus{status: "replied", reply: reply}
+}
+
+func (r *Replica) handleCall(w http.ResponseWriter, req *http.Request) {
+	content, ok := r.readEnvelope(w, req, agent.RequestTypeCall)
+	if !ok {
+		return
+	}
+	requestID := agent.NewRequestID(content)
+	r.mu.Lock()
+	_, known := r.requests[requestID]
+	if !known {
+		// The request is processing while it is executed, so that duplicate
+		// submissions in the meantime are not executed again.
+		r.requests[requestID] = requestStatus{status: "processing"}
+	}
+	r.mu.Unlock()
+	// Duplicate submissions of the same request are ignored, like on the IC.
+	if !known {
+		status := r.execute(content, false)
+		r.mu.Lock()
+		r.requests[requestID] = status
+		r.mu.Unlock()
+	}
+	if r.async || req.PathValue("version") == "v2" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	certificate, err := r.certificate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeCBOR(w, map[string]any{
+		"status":      "replied",
+		"certificate": certificate,
+	})
+}
+
+func (r *Replica) handleQuery(w http.ResponseWriter, req *http.Request) {
+	content, ok := r.readEnvelope(w, req, agent.RequestTypeQuery)
+	if !ok {
+		return
+	}
+	requestID := agent.NewRequestID(content)
+	status := r.execute(content, true)
+	timestamp := time.Now().UnixNano()
+	response := map[string]any{"status": status.status}
+	var fields []certification.KeyValuePair
+	switch status.status {
+	case "replied":
+		reply := map[string]any{"arg": status.reply}
+		response["reply"] = reply
+		fields = []certification.KeyValuePair{
+			{Key: "status", Value: status.status},
+			{Key: "reply", Value: reply},
+		}
+	default:
+		response["reject_code"] = status.rejectCode
+		response["reject_message"] = status.rejectMessage
+		response["error_code"] = status.errorCode
+		fields = []certification.KeyValuePair{
+			{Key: "status", Value: status.status},
+			{Key: "reject_code", Value: leb128.AppendUnsignedUint64(nil, status.rejectCode)},
+			{Key: "reject_message", Value: status.rejectMessage},
+			{Key: "error_code", Value: status.errorCode},
+		}
+	}
+	hash, err := certification.RepresentationIndependentHash(append(
+		fields,
+		certification.KeyValuePair{Key: "timestamp", Value: timestamp},
+		certification.KeyValuePair{Key: "request_id", Value: requestID[:]},
+	))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response["signatures"] = []map[string]any{{
+		"timestamp": timestamp,
+		"signature": ed25519.Sign(r.nodeKey, append([]byte("\x0Bic-response"), hash[:]...)),
+		"identity":  r.nodeID.Raw,
+	}}
+	writeCBOR(w, response)
+}
+
+func (r *Replica) handleReadState(w http.ResponseWriter, req *http.Request) {
+	content, ok := r.readEnvelope(w, req, agent.RequestTypeReadState)
+	if !ok {
+		return
+	}
+	if !r.batchedRequestStatus && countRequestIDs(content.Paths) > 1 {
+		http.Error(w, "can not read the status of more than one request", http.StatusBadRequest)
+		return
+	}
+	certificate, err := r.certificate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeCBOR(w, map[string]any{"certificate": certificate})
+}
+
+func (r *Replica) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	writeCBOR(w, map[string]any{"root_key": r.rootKey})
+}
+
+// readEnvelope reads and validates the envelope of the request. It writes an
+// error response and returns false if the envelope is invalid.
+func (r *Replica) readEnvelope(w http.ResponseWriter, req *http.Request, typ agent.RequestType) (agent.Request, bool) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return agent.Request{}, false
+	}
+	var envelope struct {
+		Content          agent.Request               `cbor:"content"`
+		SenderPubKey     []byte                      `cbor:"sender_pubkey"`
+		SenderSig        []byte                      `cbor:"sender_sig"`
+		SenderDelegation []identity.SignedDelegation `cbor:"sender_delegation"`
+	}
+	if err := cbor.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, fmt.Sprintf("invalid envelope: %v", err), http.StatusBadRequest)
+		return agent.Request{}, false
+	}
+	content := envelope.Content
+	if content.Type != typ {
+		http.Error(w, fmt.Sprintf("invalid request type: %s", content.Type), http.StatusBadRequest)
+		return agent.Request{}, false
+	}
+	if content.IngressExpiry < uint64(time.Now().UnixNano()) {
+		http.Error(w, "ingress expiry has passed", http.StatusBadRequest)
+		return agent.Request{}, false
+	}
+	if !content.Sender.IsAnonymous() {
+		if err := verifySender(content, envelope.SenderPubKey, envelope.SenderSig, envelope.SenderDelegation); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return agent.Request{}, false
+		}
+	}
+	if typ != agent.RequestTypeReadState && len(content.CanisterID.Raw) != 0 {
+		ecID, err := principal.Decode(req.PathValue("ecid"))
+		if err != nil || !ecID.Equal(content.CanisterID) {
+			http.Error(w, "effective canister ID does not match the canister ID", http.StatusBadRequest)
+			return agent.Request{}, false
+		}
+	}
+	return content, true
+}
+
+// countRequestIDs returns the number of distinct request IDs of which the
+// status is read by the given paths.
+func countRequestIDs(paths [][]hashtree.Label) int {
+	requestIDs := make(map[string]struct{})
+	for _, path := range paths {
+		if len(path) > 1 && string(path[0]) == "request_status" {
+			requestIDs[string(path[1])] = struct{}{}
+		}
+	}
+	return len(requestIDs)
+}
+
+// maxDelegations is the maximum length of a chain of delegations.
+const maxDelegations = 20
+
+// verifySender verifies that the request is signed by the sender, either with
+// the given public key or with the last key of the chain of delegations.
+func verifySender(content agent.Request, publicKey, sig []byte, delegations []identity.SignedDelegation) error {
+	if !principal.NewSelfAuthenticating(publicKey).Equal(content.Sender) {
+		return fmt.Errorf("sender does not match the public key")
+	}
+	if len(delegations) > maxDelegations {
+		return fmt.Errorf("too many delegations: %d", len(delegations))
+	}
+	canisterID := content.CanisterID
+	now := uint64(time.Now().UnixNano())
+	for i, d := range delegations {
+		msg, err := delegationMessage(d.Delegation)
+		if err != nil {
+			return err
+		}
+		if !identity.VerifySignature(publicKey, msg, d.Signature) {
+			return fmt.Errorf("invalid signature of delegation %d", i)
+		}
+		if d.Delegation.Expiration < now {
+			return fmt.Errorf("delegation %d has expired", i)
+		}
+		// Like the agent, the canister of read_state requests is not checked
+		// against the targets.
+		if len(canisterID.Raw) != 0 && len(d.Delegation.Targets) != 0 && !slices.ContainsFunc(d.Delegation.Targets, canisterID.Equal) {
+			return fmt.Errorf("canister %s is not a target of delegation %d", canisterID, i)
+		}
+		publicKey = d.Delegation.PublicKey
+	}
+	requestID := agent.NewRequestID(content)
+	if !identity.VerifySignature(publicKey, append([]byte("\x0Aic-request"), requestID[:]...), sig) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// delegationMessage returns the message that is signed by the delegating key
+// of the given delegation.
+func delegationMessage(d identity.Delegation) ([]byte, error) {
+	delegation := ii.Delegation{
+		PublicKey:  ii.HexString(d.PublicKey),
+		Expiration: ii.BEHexUint64(d.Expiration),
+	}
+	for _, target := range d.Targets {
+		delegation.Targets = append(delegation.Targets, ii.HexString(target.Raw))
+	}
+	return delegation.SignatureMessage()
+}
+
+type canisterState struct {
+	moduleHash  []byte
+	controllers []byte
+	metadata    map[string][]byte
+}
+
+type method struct {
+	handler Handler
+	query   bool
+}
+
+type methodKey struct {
+	canisterID string
+	methodName string
+}
+
+type requestStatus struct {
+	status        string
+	reply         []byte
+	rejectCode    uint64
+	rejectMessage string
+	errorCode     string
+}
+
+func rejected(err error) requestStatus {
+	var reject *Reject
+	if !errors.As(err, &reject) {
+		reject = &Reject{Code: 5, Message: err.Error(), ErrorCode: "IC0503"}
+	}
+	return requestStatus{
+		status:        "rejected",
+		rejectCode:    reject.Code,
+		rejectMessage: reject.Message,
+		errorCode:     reject.ErrorCode,
+	}
+}
+
+func writeCBOR(w http.ResponseWriter, v any) {
+	raw, err := cbor.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/cbor")
+	_, _ = w.Write(raw)
+}
@@ -0,0 +1,281 @@
+package agenttest_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/certification/ii"
+	"github.com/niccolofant/agent-go/identity"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+var canisterID = principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+
+func TestReplica_call(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		options []agenttest.Option
+	}{
+		{name: "sync"},
+		{name: "async", options: []agenttest.Option{agenttest.WithAsynchronousCalls()}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := agenttest.NewReplica(test.options...)
+			defer r.Close()
+
+			var counter uint64
+			r.HandleUpdate(canisterID, "inc", func(call agenttest.Call) ([]any, error) {
+				var n uint64
+				if err := call.Decode(&n); err != nil {
+					return nil, err
+				}
+				counter += n
+				return []any{counter}, nil
+			})
+
+			a := newAgent(t, r, nil)
+			var out uint64
+			if err := a.Call(canisterID, "inc", []any{uint64(2)}, []any{&out}); err != nil {
+				t.Fatal(err)
+			}
+			if out != 2 {
+				t.Errorf("got %d, want 2", out)
+			}
+		})
+	}
+}
+
+func TestReplica_query(t *testing.T) {
+	r := agenttest.NewReplica()
+	defer r.Close()
+
+	r.HandleQuery(canisterID, "whoami", func(call agenttest.Call) ([]any, error) {
+		return []any{call.Sender}, nil
+	})
+
+	id, err := identity.NewRandomEd25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newAgent(t, r, id)
+	var sender principal.Principal
+	if err := a.Query(canisterID, "whoami", nil, []any{&sender}); err != nil {
+		t.Fatal(err)
+	}
+	if !sender.Equal(id.Sender()) {
+		t.Errorf("got %s, want %s", sender, id.Sender())
+	}
+
+	// Query methods can also be called as update calls.
+	if err := a.Call(canisterID, "whoami", nil, []any{&sender}); err != nil {
+		t.Fatal(err)
+	}
+	if !sender.Equal(id.Sender()) {
+		t.Errorf("got %s, want %s", sender, id.Sender())
+	}
+}
+
+func TestReplica_reject(t *testing.T) {
+	r := agenttest.NewReplica()
+	defer r.Close()
+
+	r.HandleQuery(canisterID, "fail", func(call agenttest.Call) ([]any, error) {
+		return nil, &agenttest.Reject{Code: 4, Message: "no access", ErrorCode: "IC0406"}
+	})
+	r.HandleUpdate(canisterID, "update", func(call agenttest.Call) ([]any, error) {
+		return nil, nil
+	})
+
+	a := newAgent(t, r, nil)
+	if err := a.Query(canisterID, "fail", nil, nil); err == nil || !strings.Contains(err.Error(), "no access") {
+		t.Errorf("expected rejection, got %v", err)
+	}
+	if err := a.Call(canisterID, "fail", nil, nil); err == nil || !strings.Contains(err.Error(), "no access") {
+		t.Errorf("expected rejection, got %v", err)
+	}
+	if err := a.Query(canisterID, "update", nil, nil); err == nil {
+		t.Error("expected update method to be rejected as a query")
+	}
+	if err := a.Call(canisterID, "unknown", nil, nil); err == nil || !strings.Contains(err.Error(), "has no method") {
+		t.Errorf("expected rejection, got %v", err)
+	}
+}
+
+func TestReplica_duplicateCalls(t *testing.T) {
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls())
+	defer r.Close()
+
+	var calls atomic.Int64
+	release := make(chan struct{})
+	r.HandleUpdate(canisterID, "inc", func(call agenttest.Call) ([]any, error) {
+		calls.Add(1)
+		<-release
+		return nil, nil
+	})
+
+	a := newAgent(t, r, nil)
+	req, err := a.CreateCandidAPIRequest(agent.RequestTypeCall, canisterID, "inc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error)
+	for range 2 {
+		go func() {
+			_, err := req.Submit(context.Background())
+			errs <- err
+		}()
+	}
+	// One submission is executed, the duplicate returns without executing.
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("duplicate submission is executed")
+	}
+	close(release)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("executed %d times, want 1", n)
+	}
+}
+
+func TestReplica_signatures(t *testing.T) {
+	r := agenttest.NewReplica()
+	defer r.Close()
+
+	r.HandleQuery(canisterID, "whoami", func(call agenttest.Call) ([]any, error) {
+		return []any{call.Sender}, nil
+	})
+
+	id, err := identity.NewRandomEd25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := r.AgentConfig()
+	config.Identity = id
+	config.Interceptors = []agent.Interceptor{
+		func(ctx context.Context, op *agent.Operation, next agent.Invoker) ([]byte, error) {
+			if op.MethodName() != "whoami" {
+				return next(ctx, op)
+			}
+			var envelope agent.Envelope
+			if err := cbor.Unmarshal(op.Envelope, &envelope); err != nil {
+				return nil, err
+			}
+			envelope.SenderSig[0] ^= 0xff
+			raw, err := cbor.Marshal(envelope)
+			if err != nil {
+				return nil, err
+			}
+			op.Envelope = raw
+			return next(ctx, op)
+		},
+	}
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Query(canisterID, "whoami", nil, nil); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("expected invalid signature, got %v", err)
+	}
+
+	// A delegation that is not signed by the sender.
+	root, err := identity.NewRandomEd25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := identity.NewRandomEd25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := ii.NewDelegationChain(id, session.PublicKey(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.PublicKey = ii.HexString(root.PublicKey())
+	delegated, err := chain.Identity(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = newAgent(t, r, delegated)
+	if err := a.Query(canisterID, "whoami", nil, nil); err == nil || !strings.Contains(err.Error(), "invalid signature of delegation 0") {
+		t.Errorf("expected invalid delegation, got %v", err)
+	}
+
+	// A valid delegation.
+	chain, err = ii.NewDelegationChain(root, session.PublicKey(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegated, err = chain.Identity(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = newAgent(t, r, delegated)
+	var sender principal.Principal
+	if err := a.Query(canisterID, "whoami", nil, []any{&sender}); err != nil {
+		t.Fatal(err)
+	}
+	if !sender.Equal(root.Sender()) {
+		t.Errorf("got %s, want %s", sender, root.Sender())
+	}
+}
+
+func TestReplica_canisterState(t *testing.T) {
+	r := agenttest.NewReplica()
+	defer r.Close()
+
+	moduleHash := bytes.Repeat([]byte{0x01}, 32)
+	controller := principal.MustDecode("rwlgt-iiaaa-aaaaa-aaaaa-cai")
+	r.SetModuleHash(canisterID, moduleHash)
+	r.SetControllers(canisterID, []principal.Principal{controller})
+	r.SetMetadata(canisterID, "candid:service", []byte("service : {}"))
+
+	a := newAgent(t, r, nil)
+	h, err := a.GetCanisterModuleHash(canisterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h, moduleHash) {
+		t.Errorf("module hash = %x, want %x", h, moduleHash)
+	}
+	controllers, err := a.GetCanisterControllers(canisterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(controllers) != 1 || !controllers[0].Equal(controller) {
+		t.Errorf("controllers = %v, want [%s]", controllers, controller)
+	}
+	metadata, err := a.GetCanisterMetadata(canisterID, "candid:service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(metadata) != "service : {}" {
+		t.Errorf("metadata = %q", metadata)
+	}
+	if _, err := a.GetTime(canisterID); err != nil {
+		t.Error(err)
+	}
+}
+
+func newAgent(t *testing.T, r *agenttest.Replica, id identity.Identity) *agent.Agent {
+	t.Helper()
+	config := r.AgentConfig()
+	config.Identity = id
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
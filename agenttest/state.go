@@ -0,0 +1,149 @@
+package agenttest
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"math/big"
+	"slices"
+	"time"
+
+	bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/niccolofant/agent-go/certification"
+	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/leb128"
+)
+
+// certificate returns the CBOR encoded certificate of the current state tree.
+func (r *Replica) certificate() ([]byte, error) {
+	tree, err := r.stateTree()
+	if err != nil {
+		return nil, err
+	}
+	root := tree.Reconstruct()
+	signature, err := r.secretKey.Sign(append(hashtree.DomainSeparator("ic-state-root"), root[:]...))
+	if err != nil {
+		return nil, err
+	}
+	signaturePoint := bls12381.G1Affine(*signature)
+	signatureBytes := signaturePoint.Bytes()
+	return cbor.Marshal(certification.Certificate{
+		Tree:      hashtree.NewHashTree(tree),
+		Signature: signatureBytes[:],
+	})
+}
+
+// stateTree builds the full state tree of the replica. The tree is never
+// pruned, so paths that are not in the tree are provably absent.
+func (r *Replica) stateTree() (hashtree.Node, error) {
+	now, err := leb128.EncodeUnsigned(big.NewInt(time.Now().UnixNano()))
+	if err != nil {
+		return nil, err
+	}
+	nodePublicKey, err := x509.MarshalPKIXPublicKey(r.nodeKey.Public().(ed25519.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	// A single range that contains every canister.
+	canisterRanges, err := cbor.Marshal([][][]byte{{{}, slices.Repeat([]byte{0xff}, 29)}})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := make(map[string]hashtree.Node, len(r.requests))
+	for id, status := range r.requests {
+		fields := map[string]hashtree.Node{
+			"status": hashtree.Leaf(status.status),
+		}
+		switch status.status {
+		case "replied":
+			fields["reply"] = hashtree.Leaf(status.reply)
+		case "rejected":
+			fields["reject_code"] = hashtree.Leaf(leb128.AppendUnsignedUint64(nil, status.rejectCode))
+			fields["reject_message"] = hashtree.Leaf(status.rejectMessage)
+			fields["error_code"] = hashtree.Leaf(status.errorCode)
+		}
+		requests[string(id[:])] = labeled(fields)
+	}
+
+	canisters := make(map[string]hashtree.Node, len(r.canisters))
+	for id, c := range r.canisters {
+		fields := make(map[string]hashtree.Node)
+		if c.moduleHash != nil {
+			fields["module_hash"] = hashtree.Leaf(c.moduleHash)
+		}
+		if c.controllers != nil {
+			fields["controllers"] = hashtree.Leaf(c.controllers)
+		}
+		if len(c.metadata) != 0 {
+			metadata := make(map[string]hashtree.Node, len(c.metadata))
+			for name, data := range c.metadata {
+				metadata[name] = hashtree.Leaf(data)
+			}
+			fields["metadata"] = labeled(metadata)
+		}
+		canisters[id] = labeled(fields)
+	}
+
+	boundaryNodes := make(map[string]hashtree.Node, len(r.boundaryNodes))
+	for _, node := range r.boundaryNodes {
+		fields := map[string]hashtree.Node{
+			"domain": hashtree.Leaf(node.Domain),
+		}
+		if node.IPv4Address != "" {
+			fields["ipv4_address"] = hashtree.Leaf(node.IPv4Address)
+		}
+		if node.IPv6Address != "" {
+			fields["ipv6_address"] = hashtree.Leaf(node.IPv6Address)
+		}
+		boundaryNodes[string(node.NodeID.Raw)] = labeled(fields)
+	}
+
+	return labeled(map[string]hashtree.Node{
+		"api_boundary_nodes": labeled(boundaryNodes),
+		"canister":           labeled(canisters),
+		"request_status":     labeled(requests),
+		"subnet": labeled(map[string]hashtree.Node{
+			string(r.subnetID.Raw): labeled(map[string]hashtree.Node{
+				"canister_ranges": hashtree.Leaf(canisterRanges),
+				"node": labeled(map[string]hashtree.Node{
+					string(r.nodeID.Raw): labeled(map[string]hashtree.Node{
+						"public_key": hashtree.Leaf(nodePublicKey),
+					}),
+				}),
+				"public_key": hashtree.Leaf(r.rootKey),
+			}),
+		}),
+		"time": hashtree.Leaf(now),
+	}), nil
+}
+
+// labeled builds a tree of labeled sub-trees, sorted by their labels.
+func labeled(children map[string]hashtree.Node) hashtree.Node {
+	labels := make([]string, 0, len(children))
+	for label := range children {
+		labels = append(labels, label)
+	}
+	slices.Sort(labels)
+	nodes := make([]hashtree.Node, len(labels))
+	for i, label := range labels {
+		nodes[i] = hashtree.Labeled{Label: hashtree.Label(label), Tree: children[label]}
+	}
+	return fork(nodes)
+}
+
+// fork builds a balanced tree of forks over the given nodes.
+func fork(nodes []hashtree.Node) hashtree.Node {
+	switch len(nodes) {
+	case 0:
+		return hashtree.Empty{}
+	case 1:
+		return nodes[0]
+	default:
+		m := len(nodes) / 2
+		return hashtree.Fork{LeftTree: fork(nodes[:m]), RightTree: fork(nodes[m:])}
+	}
+}
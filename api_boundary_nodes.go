@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"crypto/rand"
 	"errors"
 	"fmt"
@@ -14,8 +15,10 @@ import (
 )
 
 // DiscoverRoutes enumerates API boundary nodes on-chain and returns their
-// https://<domain> URLs. Pair with RoundRobinRoute or RandomRoute to build a
-// RouteProvider, then call Agent.Client().SetRouteProvider to use it.
+// https://<domain> URLs. Pair with RoundRobinRoute, RandomRoute or
+// NewHealthAwareRoute to build a RouteProvider, then call
+// Agent.Client().SetRouteProvider to use it. Long-running processes should
+// use NewDiscoveryRoute instead, which keeps the list of nodes up to date.
 //
 // Example:
 //
@@ -24,7 +27,11 @@ import (
 //	rp, _ := agent.RoundRobinRoute(hosts)
 //	a.Client().SetRouteProvider(rp)
 func DiscoverRoutes(a *Agent) ([]*url.URL, error) {
-	nodes, err := a.GetAPIBoundaryNodes()
+	return discoverRoutes(a.ctx, a)
+}
+
+func discoverRoutes(ctx context.Context, a *Agent) ([]*url.URL, error) {
+	nodes, err := a.GetAPIBoundaryNodesContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("api boundary node discovery: %w", err)
 	}
@@ -65,8 +72,15 @@ type APIBoundaryNode struct {
 // This is the authoritative way to discover boundary nodes; hardcoding
 // icp0.io/ic0.app is a fallback for bootstrapping only.
 func (a Agent) GetAPIBoundaryNodes() ([]APIBoundaryNode, error) {
+	return a.GetAPIBoundaryNodesContext(a.ctx)
+}
+
+// GetAPIBoundaryNodesContext enumerates the API boundary nodes published
+// on-chain.
+func (a Agent) GetAPIBoundaryNodesContext(ctx context.Context) ([]APIBoundaryNode, error) {
 	root := []hashtree.Label{hashtree.Label("api_boundary_nodes")}
-	cert, err := a.ReadSubnetStateCertificate(
+	cert, err := a.ReadSubnetStateCertificateContext(
+		ctx,
 		principal.MustDecode(certification.RootSubnetID),
 		[][]hashtree.Label{root},
 	)
@@ -110,6 +124,26 @@ type RouteProvider interface {
 	Route() (*url.URL, error)
 }
 
+// CanisterRouteProvider is a RouteProvider that selects the host based on the
+// effective canister ID of the request, e.g. to send requests directly to the
+// nodes of the subnet of the canister. Route is still used for requests that
+// are not sent to a canister, like status and subnet read_state requests.
+type CanisterRouteProvider interface {
+	RouteProvider
+	// RouteCanister returns the host URL for the next request to the given
+	// effective canister.
+	RouteCanister(ecID principal.Principal) (*url.URL, error)
+}
+
+// UntrustedRouteProvider is a RouteProvider that sends requests to hosts that
+// are not trusted, e.g. directly to replica nodes. Their responses have to be
+// verified, so queries that skip the verification of signatures fail.
+type UntrustedRouteProvider interface {
+	RouteProvider
+	// Untrusted returns whether the hosts of the route are not trusted.
+	Untrusted() bool
+}
+
 // RandomRoute returns a RouteProvider that picks a uniformly random host on
 // each call using crypto/rand.
 func RandomRoute(hosts []*url.URL) (RouteProvider, error) {
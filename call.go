@@ -2,9 +2,10 @@ package agent
 
 import (
 	"context"
-	"strings"
+	"errors"
 
 	"github.com/fxamacker/cbor/v2"
+	"github.com/niccolofant/agent-go/candid"
 	"github.com/niccolofant/agent-go/certification"
 	"github.com/niccolofant/agent-go/certification/hashtree"
 	"github.com/niccolofant/agent-go/principal"
@@ -20,62 +21,127 @@ func (c APIRequest[_, Out]) CallAndWait(out Out) error {
 // of the per-request timeouts and the polling loop, letting the caller cancel an
 // in-flight update call.
 func (c APIRequest[_, Out]) CallAndWaitWithContext(ctx context.Context, out Out) error {
+	raw, err := c.callAndWait(ctx)
+	if err != nil {
+		return withCall(err, c.canisterID, c.methodName)
+	}
+	return c.unmarshal(raw, out)
+}
+
+// Submit submits the call without waiting for the result. The returned request
+// ID can be passed to Agent.Wait to wait for the result, also from another
+// process if the call is recorded in a CallJournal.
+//
+// The request ID is also returned on error: if submitting fails with a network
+// error the call might still have been received, Agent.Wait can be used to find
+// out.
+func (c APIRequest[_, _]) Submit(ctx context.Context) (requestID RequestID, err error) {
+	c.a.logger.Printf("[AGENT] SUBMIT %s %s (%x)", c.effectiveCanisterID, c.methodName, c.requestID)
+	ctx, span := c.a.startSpan(ctx, "agent.submit", c.canisterID, c.methodName)
+	defer func() { endSpan(span, err) }()
+	if err := c.a.record(c.JournalEntry()); err != nil {
+		return c.requestID, err
+	}
+	if _, err := c.a.call(ctx, c.effectiveCanisterID, c.data); err != nil {
+		c.a.resolve(c.requestID, err)
+		return c.requestID, withCall(err, c.canisterID, c.methodName)
+	}
+	return c.requestID, nil
+}
+
+// callAndWait submits the call and returns the raw reply.
+func (c APIRequest[_, _]) callAndWait(ctx context.Context) (raw []byte, err error) {
 	c.a.logger.Printf("[AGENT] CALL %s %s (%x)", c.effectiveCanisterID, c.methodName, c.requestID)
-	rawCertificate, err := c.a.call(ctx, c.effectiveCanisterID, c.data)
+	ctx, span := c.a.startSpan(ctx, "agent.call", c.canisterID, c.methodName)
+	start := c.a.startTimer()
+	defer func() {
+		c.a.recordRequest(RequestTypeCall, c.canisterID, c.methodName, start, err)
+		endSpan(span, err)
+	}()
+	if err := c.a.record(c.JournalEntry()); err != nil {
+		return nil, err
+	}
+	raw, err = c.submitAndWait(ctx)
+	c.a.resolve(c.requestID, err)
+	return raw, err
+}
+
+// JournalEntry returns the entry of the call in a CallJournal, e.g. to wait for
+// a submitted call with Agent.WaitEntry or Poller.Wait.
+func (c APIRequest[_, _]) JournalEntry() CallJournalEntry {
+	return CallJournalEntry{
+		RequestID:           c.requestID,
+		CanisterID:          c.canisterID,
+		EffectiveCanisterID: c.effectiveCanisterID,
+		MethodName:          c.methodName,
+		IngressExpiry:       c.ingressExpiry,
+	}
+}
+
+func (c APIRequest[_, _]) submitAndWait(ctx context.Context) ([]byte, error) {
+	d := newCachedDecoder(c.decodeCertificate)
+	rawCertificate, err := c.a.call(withDecoder(ctx, d.do), c.effectiveCanisterID, c.data)
 	if err != nil {
 		if !isTransientError(err) {
-			return err
+			return nil, err
 		}
-		// EOF/transient: fall through to poll to check if it went through
+		// The call might have been received despite the error, fall through
+		// to poll to check whether it went through.
 		rawCertificate = nil
 	}
 
 	if len(rawCertificate) != 0 {
-		var certificate certification.Certificate
-		if err := cbor.Unmarshal(rawCertificate, &certificate); err != nil {
-			goto poll
-		}
-		// A v4 synchronous response is served by a single replica. Treat it as
-		// authoritative only after the same time, signature, delegation, and
-		// canister-range checks used by read_state. If validation fails, the
-		// update may still have executed, so resolve it through certified polling
-		// instead of returning a potentially false failure.
-		if err := certificate.VerifyTime(c.a.ingressExpiry); err != nil {
-			goto poll
-		}
-		if err := certification.VerifyCertificate(certificate, c.effectiveCanisterID, c.a.rootKey); err != nil {
-			goto poll
-		}
-		path := []hashtree.Label{hashtree.Label("request_status"), c.requestID[:]}
-		if raw, err := certificate.Tree.Lookup(append(path, hashtree.Label("reply"))...); err == nil {
-			return c.unmarshal(raw, out)
+		outcome := d.do(ctx, rawCertificate)
+		var rejectErr *RejectError
+		switch {
+		case outcome == nil:
+			// Not in tree yet, fall through to poll.
+		case outcome.Err == nil:
+			return outcome.Reply, nil
+		case errors.As(outcome.Err, &rejectErr):
+			return nil, outcome.Err
 		}
+	}
+	return c.a.poll(ctx, c.effectiveCanisterID, c.requestID, c.ingressExpiry)
+}
 
-		rejectCode, err := certificate.Tree.Lookup(append(path, hashtree.Label("reject_code"))...)
-		if err != nil {
-			// Not in tree yet — fall through to poll
-			goto poll
-		}
-		message, _ := certificate.Tree.Lookup(append(path, hashtree.Label("reject_message"))...)
-		errorCode, _ := certificate.Tree.Lookup(append(path, hashtree.Label("error_code"))...)
-		return preprocessingError{
-			RejectCode: uint64FromBytes(rejectCode),
-			Message:    string(message),
-			ErrorCode:  string(errorCode),
-		}
+// decodeCertificate decodes and verifies the certificate of a synchronous
+// call. It returns nil if the certificate does not contain the outcome of the
+// call.
+func (c APIRequest[_, _]) decodeCertificate(ctx context.Context, rawCertificate []byte) *Outcome {
+	var certificate certification.Certificate
+	if err := cbor.Unmarshal(rawCertificate, &certificate); err != nil {
+		return &Outcome{Err: err}
+	}
+	// A v4 synchronous response is served by a single replica. Treat it as
+	// authoritative only after the same time, signature, delegation, and
+	// canister-range checks used by read_state. If validation fails, the
+	// update may still have executed, so resolve it through certified polling
+	// instead of returning a potentially false failure.
+	if err := c.a.verifyCertificate(ctx, certificate, c.effectiveCanisterID); err != nil {
+		return &Outcome{Err: err}
+	}
+	path := []hashtree.Label{hashtree.Label("request_status"), c.requestID[:]}
+	if raw, err := certificate.Tree.Lookup(append(path, hashtree.Label("reply"))...); err == nil {
+		return &Outcome{Reply: raw}
 	}
 
-poll:
-	raw, err := c.a.poll(ctx, c.effectiveCanisterID, c.requestID)
+	rejectCode, err := certificate.Tree.Lookup(append(path, hashtree.Label("reject_code"))...)
 	if err != nil {
-		return err
+		return nil
 	}
-	return c.unmarshal(raw, out)
+	message, _ := certificate.Tree.Lookup(append(path, hashtree.Label("reject_message"))...)
+	errorCode, _ := certificate.Tree.Lookup(append(path, hashtree.Label("error_code"))...)
+	return &Outcome{Err: &RejectError{
+		RejectCode: RejectCode(uint64FromBytes(rejectCode)),
+		Message:    string(message),
+		ErrorCode:  string(errorCode),
+	}}
 }
 
 // Call calls a method on a canister and unmarshals the result into the given values.
-func (a Agent) Call(canisterID principal.Principal, methodName string, in []any, out []any) error {
-	call, err := a.CreateCandidAPIRequest(RequestTypeCall, canisterID, methodName, in...)
+func (a Agent) Call(canisterID principal.Principal, methodName string, in []any, out []any, options ...RequestOption) error {
+	call, err := a.createCandidAPIRequest(RequestTypeCall, canisterID, methodName, in, options)
 	if err != nil {
 		return err
 	}
@@ -83,8 +149,8 @@ func (a Agent) Call(canisterID principal.Principal, methodName string, in []any,
 }
 
 // CallProto calls a method on a canister and unmarshals the result into the given proto message.
-func (a Agent) CallProto(canisterID principal.Principal, methodName string, in, out proto.Message) error {
-	call, err := a.CreateProtoAPIRequest(RequestTypeCall, canisterID, methodName, in)
+func (a Agent) CallProto(canisterID principal.Principal, methodName string, in, out proto.Message, options ...RequestOption) error {
+	call, err := a.CreateProtoAPIRequest(RequestTypeCall, canisterID, methodName, in, options...)
 	if err != nil {
 		return err
 	}
@@ -97,8 +163,8 @@ func (a Agent) CallProto(canisterID principal.Principal, methodName string, in,
 // Example:
 //
 //	reply, err := a.CallRaw(canisterID, "ingest", cborBytes)
-func (a Agent) CallRaw(canisterID principal.Principal, methodName string, arg []byte) ([]byte, error) {
-	call, err := a.CreateRawAPIRequest(RequestTypeCall, canisterID, methodName, arg)
+func (a Agent) CallRaw(canisterID principal.Principal, methodName string, arg []byte, options ...RequestOption) ([]byte, error) {
+	call, err := a.CreateRawAPIRequest(RequestTypeCall, canisterID, methodName, arg, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -112,34 +178,63 @@ func (a Agent) CallRaw(canisterID principal.Principal, methodName string, arg []
 // CallWithContext is like Call but uses the given context as the parent of the
 // per-request timeouts and the polling loop, letting the caller cancel an in-flight
 // update call.
-func (a Agent) CallWithContext(ctx context.Context, canisterID principal.Principal, methodName string, in []any, out []any) error {
-	call, err := a.CreateCandidAPIRequest(RequestTypeCall, canisterID, methodName, in...)
+func (a Agent) CallWithContext(ctx context.Context, canisterID principal.Principal, methodName string, in []any, out []any, options ...RequestOption) error {
+	call, err := a.createCandidAPIRequest(RequestTypeCall, canisterID, methodName, in, options)
 	if err != nil {
 		return err
 	}
 	return call.CallAndWaitWithContext(ctx, out)
 }
 
+// Wait waits for the result of a call that was submitted with Submit, possibly
+// by another process, and unmarshals it into the given values. The agent must
+// use the identity that signed the call.
+//
+// Since the ingress expiry of the call is not known, a call of which the IC
+// has no status is waited for until the timeout of the agent: it can not be
+// told apart from a call that is still on its way. Use WaitEntry to stop
+// waiting with an UnknownOutcomeError once such a call can not be executed
+// anymore.
+//
+// Example:
+//
+//	requestID, _ := call.Submit(ctx)
+//	err := a.Wait(ctx, canisterID, requestID, out)
+func (a Agent) Wait(ctx context.Context, ecID principal.Principal, requestID RequestID, out []any) error {
+	return a.WaitEntry(ctx, CallJournalEntry{
+		RequestID:           requestID,
+		EffectiveCanisterID: ecID,
+	}, out)
+}
+
+// WaitEntry is like Wait but waits for a call recorded in a CallJournal. The
+// call is removed from the CallJournal of the agent once it is replied or
+// rejected, or once its outcome can not be known anymore, see
+// UnknownOutcomeError. An IngressExpiry of 0 means that the expiry of the call
+// is not known, as with Wait.
+//
+// Example:
+//
+//	pending, _ := journal.Pending()
+//	for _, call := range pending {
+//		err := a.WaitEntry(ctx, call, out)
+//	}
+func (a Agent) WaitEntry(ctx context.Context, call CallJournalEntry, out []any) error {
+	raw, err := a.poll(ctx, call.EffectiveCanisterID, call.RequestID, call.IngressExpiry)
+	a.resolve(call.RequestID, err)
+	if err != nil {
+		return err
+	}
+	return candid.Unmarshal(raw, out)
+}
+
 // CallWithEffectiveCanisterID is like Call but lets the caller supply the effective
 // canister ID. Needed for management-canister methods whose args carry no canister_id
 // (create_canister, provisional_create_canister_with_cycles).
-func (a Agent) CallWithEffectiveCanisterID(canisterID, effectiveCanisterID principal.Principal, methodName string, in, out []any) error {
-	call, err := a.CreateCandidAPIRequest(RequestTypeCall, canisterID, methodName, in...)
+func (a Agent) CallWithEffectiveCanisterID(canisterID, effectiveCanisterID principal.Principal, methodName string, in, out []any, options ...RequestOption) error {
+	call, err := a.createCandidAPIRequest(RequestTypeCall, canisterID, methodName, in, options)
 	if err != nil {
 		return err
 	}
 	return call.WithEffectiveCanisterID(effectiveCanisterID).CallAndWait(out)
 }
-
-func isTransientError(err error) bool {
-	if err == nil {
-		return false
-	}
-	msg := err.Error()
-	return strings.Contains(msg, "EOF") ||
-		strings.Contains(msg, "connection reset") ||
-		strings.Contains(msg, "broken pipe") ||
-		strings.Contains(msg, "timeout") ||
-		strings.Contains(msg, "temporary") ||
-		strings.Contains(msg, "TLS handshake")
-}
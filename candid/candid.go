@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/0x51-dev/upeg/parser"
 	"github.com/niccolofant/agent-go/candid/did"
 	"github.com/niccolofant/agent-go/candid/idl"
 	"github.com/niccolofant/agent-go/candid/internal/cvalue"
@@ -44,21 +45,39 @@ func DecodeValuesString(types []idl.Type, values []any) (string, error) {
 
 // EncodeValueString encodes the given candid string into a byte slice.
 func EncodeValueString(value string) ([]byte, error) {
-	p, err := cvalue.NewParser([]rune(value))
+	n, err := parseValueString(value)
 	if err != nil {
 		return nil, err
 	}
-	n, err := p.ParseEOF(cvalue.Values)
+	types, args, err := did.ConvertValues(n)
 	if err != nil {
 		return nil, err
 	}
-	types, args, err := did.ConvertValues(n)
+	return Encode(types, args)
+}
+
+// EncodeValuesString encodes the given candid string as values of the given
+// types into a byte slice, e.g. "(1)" as (nat8).
+func EncodeValuesString(types []idl.Type, value string) ([]byte, error) {
+	n, err := parseValueString(value)
+	if err != nil {
+		return nil, err
+	}
+	args, err := did.ConvertTypedValues(types, n)
 	if err != nil {
 		return nil, err
 	}
 	return Encode(types, args)
 }
 
+func parseValueString(value string) (*parser.Node, error) {
+	p, err := cvalue.NewParser([]rune(value))
+	if err != nil {
+		return nil, err
+	}
+	return p.ParseEOF(cvalue.Values)
+}
+
 func valueToString(typ idl.Type, value any) (string, error) {
 	switch t := typ.(type) {
 	case *idl.NullType:
@@ -83,7 +102,10 @@ func valueToString(typ idl.Type, value any) (string, error) {
 		return "empty", nil
 	case *idl.OptionalType:
 		if value == nil {
-			return "opt null", nil
+			return "null", nil
+		}
+		if v, ok := value.(*any); ok && idl.ContainsNull(t.Type) {
+			value = *v
 		}
 		s, err := valueToString(t.Type, value)
 		if err != nil {
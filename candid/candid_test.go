@@ -41,7 +41,9 @@ func TestDecodeValue(t *testing.T) {
 		value   string
 		encoded string
 	}{
-		{"(opt null)", "4449444c016e7f010000"},
+		{"(null)", "4449444c016e7f010000"},
+		{"(opt null)", "4449444c016e7f010001"},
+		{"(opt opt null)", "4449444c026e7f6e0001010101"},
 		{"(opt 0)", "4449444c016e7c01000100"},
 
 		{"(0 : nat)", "4449444c00017d00"},
@@ -119,7 +121,8 @@ func TestEncodeValue(t *testing.T) {
 		value   string
 		encoded string
 	}{
-		{"opt null", "4449444c016e7f010000"},
+		{"opt null", "4449444c016e7f010001"},
+		{"opt opt null", "4449444c026e7f6e0001010101"},
 		{"opt 0", "4449444c016e7c01000100"},
 
 		{"0", "4449444c00017c00"},
@@ -157,6 +160,19 @@ func TestEncodeValue(t *testing.T) {
 
 		{"vec {}", "4449444c016d7f010000"},
 		{"vec { 0; }", "4449444c016d7c01000100"},
+
+		{"(18446744073709551615 : nat)", "4449444c00017dffffffffffffffffff01"},
+		{"(+1)", "4449444c00017c01"},
+		{`"\t\n\r\"\'\\"`, "4449444c00017106090a0d22275c"},
+		{`"☃"`, "4449444c00017103e29883"},
+		{`"\u{2603}"`, "4449444c00017103e29883"},
+		{`blob "a\00\ff"`, "4449444c016d7b0100036100ff"},
+		{"record { 42; true }", "4449444c016c02007c017e01002a01"},
+		{"record { 97 = 42 }", "4449444c016c01617c01002a"},
+		{"variant { 0 }", "4449444c016b01007f010000"},
+		{`principal "w7x7r-cok77-xa"`, "4449444c0001680103caffee"},
+		{`service "w7x7r-cok77-xa"`, "4449444c01690001000103caffee"},
+		{`func "w7x7r-cok77-xa".foo`, "4449444c016a0000000100010103caffee03666f6f"},
 	} {
 		e, err := candid.EncodeValueString(test.value)
 		if err != nil {
@@ -168,6 +184,50 @@ func TestEncodeValue(t *testing.T) {
 	}
 }
 
+func TestEncodeValuesString(t *testing.T) {
+	for _, test := range []struct {
+		value   string
+		types   []idl.Type
+		encoded string
+	}{
+		{"(1)", []idl.Type{idl.Nat8Type()}, "4449444c00017b01"},
+		{"(18446744073709551615)", []idl.Type{new(idl.NatType)}, "4449444c00017dffffffffffffffffff01"},
+		{"(1, 2)", []idl.Type{new(idl.NatType), idl.Float32Type()}, "4449444c00027d730100000040"},
+		{"(null)", []idl.Type{new(idl.ReservedType)}, "4449444c000170"},
+		{"(opt null)", []idl.Type{idl.NewOptionalType(idl.NewOptionalType(new(idl.NatType)))}, "4449444c026e7d6e0001010100"},
+		{"(record { a = 1 })", []idl.Type{idl.NewRecordType(map[string]idl.Type{
+			"a": new(idl.NatType),
+			"b": idl.NewOptionalType(new(idl.NatType)),
+		})}, "4449444c026e7d6c02617d620001010100"},
+		{`(blob "\00")`, []idl.Type{idl.NewVectorType(idl.Nat8Type())}, "4449444c016d7b01000100"},
+	} {
+		e, err := candid.EncodeValuesString(test.types, test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := fmt.Sprintf("%x", e); e != test.encoded {
+			t.Error(test.value, e)
+		}
+	}
+
+	for _, test := range []struct {
+		value string
+		types []idl.Type
+	}{
+		{"(256)", []idl.Type{idl.Nat8Type()}},
+		{"(-1)", []idl.Type{new(idl.NatType)}},
+		{"(1 : int)", []idl.Type{new(idl.NatType)}},
+		{"(1)", []idl.Type{new(idl.TextType)}},
+		{"(1, 2)", []idl.Type{new(idl.NatType)}},
+		{"(record {})", []idl.Type{idl.NewRecordType(map[string]idl.Type{"a": new(idl.NatType)})}},
+		{"(record { b = 1 })", []idl.Type{idl.NewRecordType(nil)}},
+	} {
+		if _, err := candid.EncodeValuesString(test.types, test.value); err == nil {
+			t.Errorf("%s: expected error", test.value)
+		}
+	}
+}
+
 func TestParseDID(t *testing.T) {
 	raw, _ := os.ReadFile("internal/candid/testdata/ic.did")
 	if _, err := did.ParseDID([]rune(string(raw))); err != nil {
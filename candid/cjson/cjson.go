@@ -0,0 +1,107 @@
+// Package cjson converts Candid values to JSON and back, driven by the Candid
+// types of the values, e.g. the argument types of a method of a service.
+//
+// The JSON representation of the Candid values is canonical and lossless:
+//   - null and reserved are null.
+//   - bool is a boolean and text is a string.
+//   - nat, int, nat64 and int64 are decimal strings, since they do not fit in
+//     the numbers of most JSON implementations. The smaller nat and int types
+//     are numbers.
+//   - float32 and float64 are numbers, or the strings "NaN", "Infinity" and
+//     "-Infinity".
+//   - blob, i.e. vec nat8, is a base64 or hex string, see BlobEncoding. Other
+//     vectors are arrays.
+//   - opt t is null or the value of t. If the value of t can be null itself,
+//     i.e. t is null, reserved or an opt type, the value is wrapped in an
+//     array, e.g. `[null]` for `opt null`.
+//   - a record is an object with the field names as keys, a tuple is an array.
+//   - a variant is an object with a single key, the name of the tag.
+//   - principal and service are the textual representation of the principal.
+//   - func is an object with the keys "principal" and "method".
+package cjson
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/niccolofant/agent-go/candid/did"
+	"github.com/niccolofant/agent-go/candid/idl"
+)
+
+// BlobEncoding is the encoding of blobs in JSON.
+type BlobEncoding int
+
+const (
+	// Base64 encodes blobs with the standard base64 encoding.
+	Base64 BlobEncoding = iota
+	// Hex encodes blobs as lowercase hex strings.
+	Hex
+)
+
+// Options are the options of ToJSON and FromJSON.
+type Options struct {
+	// Blob is the encoding of blobs. Defaults to Base64.
+	Blob BlobEncoding
+}
+
+// MethodTypes returns the argument and result types of the method with the
+// given name of the service of the description.
+func MethodTypes(desc did.Description, name string) ([]idl.Type, []idl.Type, error) {
+	service, err := desc.ServiceType()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range service.Methods {
+		if m.Name != name {
+			continue
+		}
+		var args, rets []idl.Type
+		for _, p := range m.Func.ArgumentParameters {
+			args = append(args, p.Type)
+		}
+		for _, p := range m.Func.ReturnParameters {
+			rets = append(rets, p.Type)
+		}
+		return args, rets, nil
+	}
+	return nil, nil, fmt.Errorf("unknown method %q", name)
+}
+
+// isNullable reports whether the JSON value of the given type can be null.
+func isNullable(t idl.Type) bool {
+	switch t.(type) {
+	case *idl.NullType, *idl.ReservedType, *idl.OptionalType:
+		return true
+	default:
+		return false
+	}
+}
+
+// isBlob reports whether the given type is a vector of nat8.
+func isBlob(t *idl.VectorType) bool {
+	n, ok := t.Type.(*idl.NatType)
+	return ok && n.Base() == 1
+}
+
+// isTuple reports whether the record is a tuple, i.e. its fields are named
+// "0", "1", ... in order.
+func isTuple(t *idl.RecordType) bool {
+	if t.IsTuple {
+		return true
+	}
+	for i, f := range t.Fields {
+		if f.Name != strconv.Itoa(i) {
+			return false
+		}
+	}
+	return len(t.Fields) != 0
+}
+
+// fieldID returns the id of the field with the given name, which is either a
+// number, or a name that is hashed.
+func fieldID(name string) uint64 {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return id
+	}
+	return idl.Hash(name).Uint64()
+}
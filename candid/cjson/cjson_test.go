@@ -0,0 +1,211 @@
+package cjson_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/niccolofant/agent-go/candid"
+	"github.com/niccolofant/agent-go/candid/cjson"
+	"github.com/niccolofant/agent-go/candid/did"
+	"github.com/niccolofant/agent-go/candid/idl"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+const testDID = `
+type List = opt record { int; List };
+type Value = variant { Nat : nat; Array : vec Value };
+type Result = variant { ok : nat; err : text };
+type Account = record { owner : principal; subaccount : opt blob };
+service : {
+  numbers : (nat, int, nat8, nat16, nat32, nat64, int8, int16, int32, int64) -> ();
+  floats : (float32, float64) -> ();
+  basics : (null, bool, text, reserved) -> ();
+  blob : (blob) -> ();
+  optional : (opt nat, opt null, opt opt text) -> ();
+  record : (Account, record { nat; text }, record {}) -> ();
+  variant : (Result, variant { a; b : vec int }) -> ();
+  list : (List) -> ();
+  value : (Value) -> ();
+  references : (principal, func (nat) -> (), service { m : () -> () }) -> ();
+}
+`
+
+func methodTypes(t *testing.T, name string) []idl.Type {
+	desc, err := did.ParseDID([]rune(testDID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, _, err := cjson.MethodTypes(*desc, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return args
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		method string
+		json   string
+	}{
+		{
+			method: "numbers",
+			json:   `["340282366920938463463374607431768211456","-340282366920938463463374607431768211456",255,65535,4294967295,"18446744073709551615",-128,-32768,-2147483648,"-9223372036854775808"]`,
+		},
+		{
+			method: "floats",
+			json:   `[0.1,-1.7976931348623157e+308]`,
+		},
+		{
+			method: "floats",
+			json:   `["NaN","-Infinity"]`,
+		},
+		{
+			method: "basics",
+			json:   `[null,true,"<hello> \"world\" ✓",null]`,
+		},
+		{
+			method: "blob",
+			json:   `["AAH/"]`,
+		},
+		{
+			method: "optional",
+			json:   `[null,null,null]`,
+		},
+		{
+			method: "optional",
+			json:   `["42",[null],[null]]`,
+		},
+		{
+			method: "optional",
+			json:   `["0",null,["text"]]`,
+		},
+		{
+			method: "record",
+			json:   `[{"owner":"aaaaa-aa","subaccount":"AQID"},["1","one"],{}]`,
+		},
+		{
+			method: "record",
+			json:   `[{"owner":"2vxsx-fae","subaccount":null},["0",""],{}]`,
+		},
+		{
+			method: "variant",
+			json:   `[{"ok":"1"},{"a":null}]`,
+		},
+		{
+			method: "variant",
+			json:   `[{"err":"failed"},{"b":["-1","2"]}]`,
+		},
+		{
+			method: "list",
+			json:   `[["1",["-2",null]]]`,
+		},
+		{
+			method: "list",
+			json:   `[null]`,
+		},
+		{
+			method: "value",
+			json:   `[{"Array":[{"Nat":"1"},{"Array":[]}]}]`,
+		},
+		{
+			method: "references",
+			json:   `["ryjl3-tyaaa-aaaaa-aaaba-cai",{"method":"transfer","principal":"ryjl3-tyaaa-aaaaa-aaaba-cai"},"aaaaa-aa"]`,
+		},
+	} {
+		t.Run(test.method, func(t *testing.T) {
+			types := methodTypes(t, test.method)
+			raw, err := cjson.FromJSON(types, []byte(test.json), cjson.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			js, err := cjson.ToJSON(types, raw, cjson.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(js) != test.json {
+				t.Errorf("got %s, want %s", js, test.json)
+			}
+		})
+	}
+}
+
+func TestToJSON_subtypes(t *testing.T) {
+	type account struct {
+		Owner principal.Principal `ic:"owner"`
+		Name  string              `ic:"name"`
+	}
+	raw, err := candid.Marshal([]any{account{Owner: principal.AnonymousID, Name: "extra"}, "extra argument"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := cjson.ToJSON(methodTypes(t, "record")[:1], raw, cjson.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Additional fields and arguments are ignored, missing optional fields
+	// are null.
+	if want := `[{"owner":"2vxsx-fae","subaccount":null}]`; string(js) != want {
+		t.Errorf("got %s, want %s", js, want)
+	}
+
+	raw, err = candid.EncodeValueString(`(42 : nat)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err = cjson.ToJSON(methodTypes(t, "optional"), raw, cjson.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A nat is an opt nat, missing optional arguments are null.
+	if want := `["42",null,null]`; string(js) != want {
+		t.Errorf("got %s, want %s", js, want)
+	}
+
+	if _, err := cjson.ToJSON(methodTypes(t, "blob"), raw, cjson.Options{}); err == nil {
+		t.Error("expected error for a nat as blob")
+	}
+}
+
+func TestToJSON_recursive(t *testing.T) {
+	raw := []byte("DIDL\x02\x6e\x01\x6c\x02\x00\x7c\x01\x00\x01\x00\x01\x01\x01\x02\x00")
+	js, err := cjson.ToJSON(methodTypes(t, "list"), raw, cjson.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[["1",["2",null]]]`; string(js) != want {
+		t.Errorf("got %s, want %s", js, want)
+	}
+}
+
+func TestFromJSON_invalid(t *testing.T) {
+	for _, test := range []struct {
+		method string
+		json   string
+	}{
+		{"numbers", `["1","1",256,0,0,"0",0,0,0,"0"]`},
+		{"numbers", `["-1","1",0,0,0,"0",0,0,0,"0"]`},
+		{"numbers", `["1","1",0,0,0,"0",128,0,0,"0"]`},
+		{"basics", `[null,true,"text"]`},
+		{"optional", `[null,null,"text"]`},
+		{"record", `[{"owner":"aaaaa-aa","unknown":null},["1","one"],{}]`},
+		{"variant", `[{"ok":"1","err":"failed"},{"a":null}]`},
+		{"blob", `["not base64"]`},
+	} {
+		types := methodTypes(t, test.method)
+		if _, err := cjson.FromJSON(types, []byte(test.json), cjson.Options{}); err == nil {
+			t.Errorf("expected error for %s", test.json)
+		}
+	}
+}
+
+func ExampleToJSON() {
+	desc, _ := did.ParseDID([]rune(`service : {
+		transfer : (record { to : principal; amount : nat; memo : opt blob }) -> ();
+	}`))
+	args, _, _ := cjson.MethodTypes(*desc, "transfer")
+	raw, _ := cjson.FromJSON(args, []byte(`[{"to":"aaaaa-aa","amount":"1000","memo":"cafe"}]`), cjson.Options{Blob: cjson.Hex})
+	js, _ := cjson.ToJSON(args, raw, cjson.Options{Blob: cjson.Hex})
+	fmt.Println(string(js))
+	// Output:
+	// [{"amount":"1000","memo":"cafe","to":"aaaaa-aa"}]
+}
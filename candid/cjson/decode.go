@@ -0,0 +1,270 @@
+package cjson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/niccolofant/agent-go/candid"
+	"github.com/niccolofant/agent-go/candid/idl"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// ToJSON converts the Candid message to a JSON array with the values of the
+// arguments of the given types. The types of the message have to be subtypes
+// of the given types, missing optional arguments are null and additional
+// arguments are ignored.
+func ToJSON(types []idl.Type, data []byte, options Options) ([]byte, error) {
+	ts, raws, err := candid.DecodeRaw(data)
+	if err != nil {
+		return nil, err
+	}
+	d := decoder{options: options}
+	args := make([]any, len(types))
+	for i, t := range types {
+		if len(ts) <= i {
+			if !isNullable(t) {
+				return nil, fmt.Errorf("missing argument %d of type %s", i, t)
+			}
+			continue
+		}
+		if err := idl.CheckSubtype(ts[i], t); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		v, err := ts[i].Decode(bytes.NewReader(raws[i]))
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		if args[i], err = d.value(ts[i], t, v); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(args); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// decoder converts decoded Candid values to JSON values.
+type decoder struct {
+	options Options
+}
+
+// value converts the value v of type wire, as returned by idl.Type.Decode, to
+// a JSON value of type t, of which wire is a subtype.
+func (d decoder) value(wire, t idl.Type, v any) (any, error) {
+	switch t := t.(type) {
+	case *idl.NullType, *idl.ReservedType:
+		return nil, nil
+	case *idl.OptionalType:
+		return d.optional(wire, t, v)
+	case *idl.VectorType:
+		wire, ok := wire.(*idl.VectorType)
+		if !ok {
+			return nil, fmt.Errorf("expected vec, got %s", wire)
+		}
+		return d.vector(wire, t, v)
+	case *idl.RecordType:
+		wire, ok := wire.(*idl.RecordType)
+		if !ok {
+			return nil, fmt.Errorf("expected record, got %s", wire)
+		}
+		return d.record(wire, t, v)
+	case *idl.VariantType:
+		wire, ok := wire.(*idl.VariantType)
+		if !ok {
+			return nil, fmt.Errorf("expected variant, got %s", wire)
+		}
+		return d.variant(wire, t, v)
+	case *idl.EmptyType:
+		return nil, fmt.Errorf("cannot decode empty type")
+	case *idl.BoolType, *idl.TextType:
+		return v, nil
+	case *idl.NatType:
+		return number(v, t.Base())
+	case *idl.IntType:
+		return number(v, t.Base())
+	case *idl.FloatType:
+		switch v := v.(type) {
+		case float32:
+			return float(float64(v), 32), nil
+		case float64:
+			return float(v, 64), nil
+		}
+	case *idl.PrincipalType:
+		if p, ok := v.(principal.Principal); ok {
+			return p.String(), nil
+		}
+	case *idl.FunctionType:
+		if pm, ok := v.(*idl.PrincipalMethod); ok {
+			return map[string]any{
+				"principal": pm.Principal.String(),
+				"method":    pm.Method,
+			}, nil
+		}
+	case *idl.Service, idl.Service:
+		if p, ok := v.(*principal.Principal); ok {
+			return p.String(), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %v (%T) to %s", v, v, t)
+}
+
+func (d decoder) optional(wire idl.Type, t *idl.OptionalType, v any) (any, error) {
+	switch w := wire.(type) {
+	case *idl.NullType, *idl.ReservedType:
+		return nil, nil
+	case *idl.OptionalType:
+		if v == nil {
+			return nil, nil
+		}
+		if p, ok := v.(*any); ok && idl.ContainsNull(w.Type) {
+			// As returned by idl.OptionalType.Decode.
+			v = *p
+		}
+		wire = w.Type
+	default:
+		// A value of type t is a value of type opt t, unless t can be null.
+		if isNullable(t.Type) {
+			return nil, nil
+		}
+	}
+	// Values that do not match the type of the option are null.
+	if !idl.IsSubtype(wire, t.Type) {
+		return nil, nil
+	}
+	v, err := d.value(wire, t.Type, v)
+	if err != nil {
+		return nil, err
+	}
+	if isNullable(t.Type) {
+		return []any{v}, nil
+	}
+	return v, nil
+}
+
+func (d decoder) vector(wire, t *idl.VectorType, v any) (any, error) {
+	vs, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected vec, got %v (%T)", v, v)
+	}
+	if isBlob(wire) && isBlob(t) {
+		bs := make([]byte, len(vs))
+		for i, v := range vs {
+			b, ok := v.(uint8)
+			if !ok {
+				return nil, fmt.Errorf("expected nat8, got %v (%T)", v, v)
+			}
+			bs[i] = b
+		}
+		if d.options.Blob == Hex {
+			return hex.EncodeToString(bs), nil
+		}
+		return base64.StdEncoding.EncodeToString(bs), nil
+	}
+	js := make([]any, len(vs))
+	for i, v := range vs {
+		j, err := d.value(wire.Type, t.Type, v)
+		if err != nil {
+			return nil, err
+		}
+		js[i] = j
+	}
+	return js, nil
+}
+
+func (d decoder) record(wire, t *idl.RecordType, v any) (any, error) {
+	// Records without fields are decoded as nil.
+	m, _ := v.(map[string]any)
+	fields := make(map[uint64]idl.FieldType, len(t.Fields))
+	for _, f := range t.Fields {
+		fields[fieldID(f.Name)] = f
+	}
+	vs := make(map[string]any, len(t.Fields))
+	for _, wf := range wire.Fields {
+		f, ok := fields[fieldID(wf.Name)]
+		if !ok {
+			// Additional fields are ignored.
+			continue
+		}
+		v, err := d.value(wf.Type, f.Type, m[wf.Name])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		vs[f.Name] = v
+	}
+	// Missing fields are of type opt, null or reserved.
+	for _, f := range t.Fields {
+		if _, ok := vs[f.Name]; !ok {
+			vs[f.Name] = nil
+		}
+	}
+	if !isTuple(t) {
+		return vs, nil
+	}
+	tuple := make([]any, len(t.Fields))
+	for i, f := range t.Fields {
+		tuple[i] = vs[f.Name]
+	}
+	return tuple, nil
+}
+
+func (d decoder) variant(wire, t *idl.VariantType, v any) (any, error) {
+	variant, ok := v.(*idl.Variant)
+	if !ok {
+		return nil, fmt.Errorf("expected variant, got %v (%T)", v, v)
+	}
+	for _, f := range t.Fields {
+		if fieldID(f.Name) != fieldID(variant.Name) {
+			continue
+		}
+		v, err := d.value(variant.Type, f.Type, variant.Value)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", f.Name, err)
+		}
+		return map[string]any{f.Name: v}, nil
+	}
+	return nil, fmt.Errorf("unknown tag %s", variant.Name)
+}
+
+// number converts a decoded nat or int value to a JSON value. Values of types
+// with a size of 8 bytes or more are strings.
+func number(v any, base uint) (any, error) {
+	var s string
+	switch v := v.(type) {
+	case idl.Nat:
+		s = v.String()
+	case idl.Int:
+		s = v.String()
+	case uint64, uint32, uint16, uint8, int64, int32, int16, int8:
+		s = fmt.Sprint(v)
+	default:
+		return nil, fmt.Errorf("invalid number %v (%T)", v, v)
+	}
+	if base == 0 || base == 8 {
+		return s, nil
+	}
+	return json.Number(s), nil
+}
+
+// float converts a float to a JSON value, with the shortest representation
+// that decodes to the same float.
+func float(f float64, bitSize int) any {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	default:
+		return json.Number(strconv.FormatFloat(f, 'g', -1, bitSize))
+	}
+}
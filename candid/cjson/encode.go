@@ -0,0 +1,310 @@
+package cjson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+
+	"github.com/niccolofant/agent-go/candid"
+	"github.com/niccolofant/agent-go/candid/idl"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// FromJSON converts a JSON array with the values of the arguments of the given
+// types to a Candid message. It is the inverse of ToJSON.
+func FromJSON(types []idl.Type, data []byte, options Options) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var args []any
+	if err := dec.Decode(&args); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the arguments")
+	}
+	if len(args) != len(types) {
+		return nil, fmt.Errorf("expected %d arguments, got %d", len(types), len(args))
+	}
+	e := encoder{options: options}
+	values := make([]any, len(types))
+	for i, t := range types {
+		v, err := e.value(t, args[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		values[i] = v
+	}
+	return candid.Encode(types, values)
+}
+
+// encoder converts JSON values to values that idl.Type.EncodeValue accepts.
+type encoder struct {
+	options Options
+}
+
+// value converts the JSON value to a value of type t.
+func (e encoder) value(t idl.Type, v any) (any, error) {
+	switch t := t.(type) {
+	case *idl.NullType:
+		if v != nil {
+			return nil, fmt.Errorf("expected null, got %v", v)
+		}
+		return nil, nil
+	case *idl.ReservedType:
+		return nil, nil
+	case *idl.EmptyType:
+		return nil, fmt.Errorf("cannot encode empty type")
+	case *idl.OptionalType:
+		return e.optional(t, v)
+	case *idl.VectorType:
+		return e.vector(t, v)
+	case *idl.RecordType:
+		return e.record(t, v)
+	case *idl.VariantType:
+		return e.variant(t, v)
+	case *idl.BoolType:
+		if _, ok := v.(bool); !ok {
+			return nil, fmt.Errorf("expected bool, got %v", v)
+		}
+		return v, nil
+	case *idl.TextType:
+		if _, ok := v.(string); !ok {
+			return nil, fmt.Errorf("expected text, got %v", v)
+		}
+		return v, nil
+	case *idl.NatType:
+		n, err := integer(v, t.Base(), false)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Base() {
+		case 0:
+			return idl.NewBigNat(n), nil
+		case 1:
+			return uint8(n.Uint64()), nil
+		case 2:
+			return uint16(n.Uint64()), nil
+		case 4:
+			return uint32(n.Uint64()), nil
+		default:
+			return n.Uint64(), nil
+		}
+	case *idl.IntType:
+		n, err := integer(v, t.Base(), true)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Base() {
+		case 0:
+			return idl.NewBigInt(n), nil
+		case 1:
+			return int8(n.Int64()), nil
+		case 2:
+			return int16(n.Int64()), nil
+		case 4:
+			return int32(n.Int64()), nil
+		default:
+			return n.Int64(), nil
+		}
+	case *idl.FloatType:
+		f, err := parseFloat(v, int(t.Base())*8)
+		if err != nil {
+			return nil, err
+		}
+		if t.Base() == 4 {
+			return float32(f), nil
+		}
+		return f, nil
+	case *idl.PrincipalType, *idl.Service, idl.Service:
+		return parsePrincipal(v)
+	case *idl.FunctionType:
+		m, ok := v.(map[string]any)
+		if !ok || len(m) != 2 {
+			return nil, fmt.Errorf("expected func reference, got %v", v)
+		}
+		p, err := parsePrincipal(m["principal"])
+		if err != nil {
+			return nil, err
+		}
+		method, ok := m["method"].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected method name, got %v", m["method"])
+		}
+		return &idl.PrincipalMethod{Principal: p, Method: method}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func (e encoder) optional(t *idl.OptionalType, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if isNullable(t.Type) {
+		vs, ok := v.([]any)
+		if !ok || len(vs) != 1 {
+			return nil, fmt.Errorf("expected optional value in an array, got %v", v)
+		}
+		v = vs[0]
+	}
+	v, err := e.value(t.Type, v)
+	if err != nil {
+		return nil, err
+	}
+	// A pointer is always encoded as some value, even if it points to nil or
+	// to another pointer.
+	return &v, nil
+}
+
+func (e encoder) vector(t *idl.VectorType, v any) (any, error) {
+	if isBlob(t) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected blob, got %v", v)
+		}
+		var (
+			blob []byte
+			err  error
+		)
+		if e.options.Blob == Hex {
+			blob, err = hex.DecodeString(s)
+		} else {
+			blob, err = base64.StdEncoding.DecodeString(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob %q: %w", s, err)
+		}
+		return blob, nil
+	}
+	vs, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected array, got %v", v)
+	}
+	values := make([]any, len(vs))
+	for i, v := range vs {
+		value, err := e.value(t.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (e encoder) record(t *idl.RecordType, v any) (any, error) {
+	var values []any
+	if isTuple(t) {
+		vs, ok := v.([]any)
+		if !ok || len(vs) != len(t.Fields) {
+			return nil, fmt.Errorf("expected array of %d values, got %v", len(t.Fields), v)
+		}
+		values = vs
+	} else {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected object, got %v", v)
+		}
+		for name := range m {
+			if !slices.ContainsFunc(t.Fields, func(f idl.FieldType) bool { return f.Name == name }) {
+				return nil, fmt.Errorf("unknown field %s", name)
+			}
+		}
+		for _, f := range t.Fields {
+			// Missing fields are null, which is only valid for fields of type
+			// opt, null or reserved.
+			values = append(values, m[f.Name])
+		}
+	}
+	fields := make(map[string]any, len(t.Fields))
+	for i, f := range t.Fields {
+		value, err := e.value(f.Type, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		fields[f.Name] = value
+	}
+	return fields, nil
+}
+
+func (e encoder) variant(t *idl.VariantType, v any) (any, error) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, fmt.Errorf("expected object with a single tag, got %v", v)
+	}
+	for name, v := range m {
+		i := slices.IndexFunc(t.Fields, func(f idl.FieldType) bool { return f.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown tag %s", name)
+		}
+		value, err := e.value(t.Fields[i].Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", name, err)
+		}
+		return idl.Variant{Name: name, Value: value, Type: t.Fields[i].Type}, nil
+	}
+	return nil, nil
+}
+
+// integer parses a nat or int value of the given size in bytes, and checks
+// whether it is in range. A size of 0 is unbounded.
+func integer(v any, base uint, signed bool) (*big.Int, error) {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		return nil, fmt.Errorf("expected number, got %v", v)
+	}
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	if base == 0 {
+		if !signed && n.Sign() < 0 {
+			return nil, fmt.Errorf("number %s out of range", s)
+		}
+		return n, nil
+	}
+	lo, hi := new(big.Int), new(big.Int).Lsh(big.NewInt(1), base*8)
+	if signed {
+		hi.Rsh(hi, 1)
+		lo.Neg(hi)
+	}
+	if n.Cmp(lo) < 0 || n.Cmp(hi) >= 0 {
+		return nil, fmt.Errorf("number %s out of range", s)
+	}
+	return n, nil
+}
+
+func parseFloat(v any, bitSize int) (float64, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return strconv.ParseFloat(v.String(), bitSize)
+	case string:
+		switch v {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+	}
+	return 0, fmt.Errorf("expected float, got %v", v)
+}
+
+func parsePrincipal(v any) (principal.Principal, error) {
+	s, ok := v.(string)
+	if !ok {
+		return principal.Principal{}, fmt.Errorf("expected principal, got %v", v)
+	}
+	return principal.Decode(s)
+}
@@ -10,16 +10,66 @@ import (
 	"github.com/niccolofant/agent-go/leb128"
 )
 
+// DecodeOptions are the limits of DecodeWithOptions and UnmarshalWithOptions,
+// which protect against messages that are small, but take long to decode or
+// decode to large values. A zero limit means that it is not checked.
+type DecodeOptions struct {
+	// MaxElements is the maximum number of values in a message, including the
+	// elements of vectors and the values of nested types.
+	MaxElements int
+	// MaxZeroSizedElements is the maximum number of null and reserved elements
+	// of vectors in a message. These take up no bytes, so their number is not
+	// limited by the size of the message.
+	MaxZeroSizedElements int
+	// MaxSkipCost is the maximum number of values that can be skipped, e.g.
+	// record fields that are not present in the Go value.
+	MaxSkipCost int
+	// MaxTypeTableEntries is the maximum number of entries in the type table.
+	MaxTypeTableEntries int
+	// MaxDepth is the maximum nesting depth of the values in a message.
+	MaxDepth int
+}
+
+// DefaultDecodeOptions are the limits of Decode and Unmarshal.
+var DefaultDecodeOptions = DecodeOptions{
+	MaxElements:          1 << 24,
+	MaxZeroSizedElements: 1 << 16,
+	MaxSkipCost:          1 << 24,
+	MaxTypeTableEntries:  1 << 14,
+	MaxDepth:             1 << 12,
+}
+
+// LimitError is returned if decoding a message exceeds one of the limits of
+// the DecodeOptions.
+type LimitError struct {
+	// Limit is the name of the exceeded limit, e.g. "MaxElements".
+	Limit string
+	// Max is the value of the exceeded limit.
+	Max int
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("decoding limit exceeded: %s of %d", e.Limit, e.Max)
+}
+
+// Decode decodes the given message with the DefaultDecodeOptions.
 func Decode(bs []byte) ([]idl.Type, []any, error) {
-	ts, r, err := decodeTypes(bs)
+	return DecodeWithOptions(bs, DefaultDecodeOptions)
+}
+
+// DecodeWithOptions decodes the given message, within the limits of the given
+// options.
+func DecodeWithOptions(bs []byte, options DecodeOptions) ([]idl.Type, []any, error) {
+	ts, r, err := decodeTypes(bs, options)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	q := quota{options: options}
 	var vs []any
 	{ // M
 		for i := range ts {
-			v, err := ts[i].Decode(r)
+			v, err := q.decodeValue(ts[i], r)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -33,32 +83,76 @@ func Decode(bs []byte) ([]idl.Type, []any, error) {
 	return ts, vs, nil
 }
 
+// DecodeRaw decodes the types of the given message with the
+// DefaultDecodeOptions, and returns the values of the arguments undecoded.
+func DecodeRaw(bs []byte) ([]idl.Type, []idl.RawMessage, error) {
+	return DecodeRawWithOptions(bs, DefaultDecodeOptions)
+}
+
+// DecodeRawWithOptions decodes the types of the given message, and returns the
+// values of the arguments undecoded. The values are checked to be within the
+// limits of the given options.
+func DecodeRawWithOptions(bs []byte, options DecodeOptions) ([]idl.Type, []idl.RawMessage, error) {
+	ts, r, err := decodeTypes(bs, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q := quota{options: options}
+	raws := make([]idl.RawMessage, len(ts))
+	for i := range ts {
+		raw, err := q.readValue(ts[i], r)
+		if err != nil {
+			return nil, nil, err
+		}
+		raws[i] = raw
+	}
+
+	if r.Len() != 0 {
+		return nil, nil, fmt.Errorf("too long")
+	}
+	return ts, raws, nil
+}
+
+// Unmarshal decodes the given message into the given values with the
+// DefaultDecodeOptions.
 func Unmarshal(data []byte, values []any) error {
-	ts, r, err := decodeTypes(data)
+	return UnmarshalWithOptions(data, values, DefaultDecodeOptions)
+}
+
+// UnmarshalWithOptions decodes the given message into the given values, within
+// the limits of the given options.
+func UnmarshalWithOptions(data []byte, values []any, options DecodeOptions) error {
+	ts, r, err := decodeTypes(data, options)
 	if err != nil {
 		return err
 	}
-	if len(ts) != len(values) {
-		return fmt.Errorf("unequal value lengths: %d %d", len(ts), len(values))
-	}
 
+	q := quota{options: options}
 	for i, v := range values {
+		if len(ts) <= i {
+			// Missing arguments are null, which only optional values can be.
+			if err := unmarshalNull(v); err != nil {
+				return fmt.Errorf("missing argument %d: %w", i, err)
+			}
+			continue
+		}
 		switch v := v.(type) {
 		case *idl.RawMessage:
-			bs, err := ts[i].Read(r)
+			bs, err := q.readValue(ts[i], r)
 			if err != nil {
 				return err
 			}
 			*v = bs
 		default:
 			if canUnmarshalDirect(ts[i], v) {
-				if err := unmarshalDirect(ts[i], r, v); err != nil {
+				if err := unmarshalDirect(ts[i], r, v, &q); err != nil {
 					return err
 				}
 				continue
 			}
 
-			vs, err := ts[i].Decode(r)
+			vs, err := q.decodeValue(ts[i], r)
 			if err != nil {
 				return err
 			}
@@ -67,10 +161,37 @@ func Unmarshal(data []byte, values []any) error {
 			}
 		}
 	}
+	// Additional arguments are ignored.
+	for i := len(values); i < len(ts); i++ {
+		if err := q.skipValue(ts[i], r); err != nil {
+			return err
+		}
+	}
 
+	if r.Len() != 0 {
+		return fmt.Errorf("too long")
+	}
 	return nil
 }
 
+// unmarshalNull sets the value v points to to null, which is only possible for
+// optional values, null and reserved.
+func unmarshalNull(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return idl.NewUnmarshalGoError(nil, v)
+	}
+	switch dst := rv.Elem(); {
+	case dst.Kind() == reflect.Pointer,
+		dst.Type() == reflect.TypeOf(idl.Null{}),
+		dst.Type() == reflect.TypeOf(idl.Reserved{}):
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	default:
+		return idl.NewUnmarshalGoError(nil, v)
+	}
+}
+
 func checkHeader(r *bytes.Reader) error {
 	magic := make([]byte, 4)
 	n, err := r.Read(magic)
@@ -90,7 +211,7 @@ func checkHeader(r *bytes.Reader) error {
 	return nil
 }
 
-func decodeTypes(bs []byte) ([]idl.Type, *bytes.Reader, error) {
+func decodeTypes(bs []byte, options DecodeOptions) ([]idl.Type, *bytes.Reader, error) {
 	if len(bs) == 0 {
 		return nil, nil, &idl.FormatError{
 			Description: "empty",
@@ -109,6 +230,9 @@ func decodeTypes(bs []byte) ([]idl.Type, *bytes.Reader, error) {
 		if err != nil {
 			return nil, nil, err
 		}
+		if max := options.MaxTypeTableEntries; max != 0 && (!tdtl.IsInt64() || int64(max) < tdtl.Int64()) {
+			return nil, nil, &LimitError{Limit: "MaxTypeTableEntries", Max: max}
+		}
 
 		var tc typeCache
 		for range int(tdtl.Int64()) {
@@ -154,15 +278,17 @@ func decodeTypes(bs []byte) ([]idl.Type, *bytes.Reader, error) {
 				}
 				tds = append(tds, typ)
 			default:
-				if o >= 0 {
+				// Only constructed types and future types, of which the
+				// opcodes are below the opcode of principal, are defined in
+				// the type table.
+				if o >= idl.PrincipalOpCode {
 					return nil, nil, fmt.Errorf("invalid opcode: %d", o)
 				}
-				count, err := leb128.DecodeUnsigned(r)
+				count, err := decodeIntoLen(r)
 				if err != nil {
 					return nil, nil, err
 				}
-				skip := make([]byte, count.Int64())
-				if _, err := r.Read(skip); err != nil {
+				if err := skipBytes(r, count); err != nil {
 					return nil, nil, err
 				}
 				tds = append(tds, &idl.FutureType{OpCode: o})
@@ -406,17 +532,26 @@ func (tc *typeCache) decodeFuncOpCode(r *bytes.Reader, tds []idl.Type) (idl.Type
 		}
 	}
 
-	l, err := leb128.DecodeUnsigned(r)
+	l, err := decodeIntoLen(r)
 	if err != nil {
 		return nil, err
 	}
-	ann := make([]byte, l.Int64())
-	if _, err := r.Read(ann); err != nil {
-		return nil, err
-	}
 	var anns []string
-	if len(ann) != 0 {
-		anns = append(anns, string(ann))
+	for i := 0; i < l; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case 0x01:
+			anns = append(anns, "query")
+		case 0x02:
+			anns = append(anns, "oneway")
+		case 0x03:
+			anns = append(anns, "composite_query")
+		default:
+			return nil, fmt.Errorf("invalid function annotation: %d", b)
+		}
 	}
 
 	return &idl.FunctionType{
@@ -432,22 +567,25 @@ func (tc *typeCache) decodeOptOpCode(r *bytes.Reader, tds []idl.Type) (idl.Type,
 		return nil, err
 	}
 	o := idl.OpCode(tid.Int64())
-	f := func(tdt []idl.Type) (idl.Type, error) {
-		v, err := o.GetType(tdt)
-		if err != nil {
-			return nil, err
-		}
+	if v, err := o.GetType(tds); err == nil {
 		return idl.NewOptionalType(v), nil
 	}
-	if v, err := f(tds); err == nil {
-		return v, nil
-	}
 
+	// The type is defined later in the table, or is the type itself, e.g.
+	// "type t = opt t". Other types can refer to it before it is resolved.
+	t := idl.NewOptionalType(nil)
 	tc.cache = append(tc.cache, delayType{
 		index: len(tds),
-		f:     f,
+		f: func(tdt []idl.Type) (idl.Type, error) {
+			v, err := o.GetType(tdt)
+			if err != nil {
+				return nil, err
+			}
+			t.Type = v
+			return t, nil
+		},
 	})
-	return nil, nil
+	return t, nil
 }
 
 func (tc *typeCache) decodeRecOpCode(r *bytes.Reader, tds []idl.Type) (idl.Type, error) {
@@ -465,16 +603,16 @@ func (tc *typeCache) decodeServiceOpCode(r *bytes.Reader, tds []idl.Type) (idl.T
 	}
 	var methods []idl.Method
 	for i := 0; i < int(l.Int64()); i++ {
-		lm, err := leb128.DecodeUnsigned(r)
+		lm, err := decodeIntoLen(r)
 		if err != nil {
 			return nil, err
 		}
-		name := make([]byte, lm.Int64())
+		name := make([]byte, lm)
 		n, err := r.Read(name)
 		if err != nil {
 			return nil, err
 		}
-		if n != int(lm.Int64()) {
+		if n != lm {
 			return nil, fmt.Errorf("invalid method name: %s", name)
 		}
 
@@ -515,22 +653,25 @@ func (tc *typeCache) decodeVecOpCode(r *bytes.Reader, tds []idl.Type) (idl.Type,
 		return nil, err
 	}
 	o := idl.OpCode(tid.Int64())
-	f := func(tdt []idl.Type) (idl.Type, error) {
-		v, err := o.GetType(tdt)
-		if err != nil {
-			return nil, err
-		}
+	if v, err := o.GetType(tds); err == nil {
 		return idl.NewVectorType(v), nil
 	}
-	if v, err := f(tds); err == nil {
-		return v, nil
-	}
 
+	// The type is defined later in the table, or is the type itself, e.g.
+	// "type t = vec t". Other types can refer to it before it is resolved.
+	t := idl.NewVectorType(nil)
 	tc.cache = append(tc.cache, delayType{
 		index: len(tds),
-		f:     f,
+		f: func(tdt []idl.Type) (idl.Type, error) {
+			v, err := o.GetType(tdt)
+			if err != nil {
+				return nil, err
+			}
+			t.Type = v
+			return t, nil
+		},
 	})
-	return nil, nil
+	return t, nil
 }
 
 // resolve should empty out the type cache by resolving all forward references.
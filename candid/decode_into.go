@@ -2,16 +2,20 @@ package candid
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/niccolofant/agent-go/candid/idl"
 )
 
 var rawMessagePtrType = reflect.TypeOf((*idl.RawMessage)(nil))
+var nullType = reflect.TypeOf(idl.Null{})
+var reservedType = reflect.TypeOf(idl.Reserved{})
 var structFieldIndexes sync.Map // map[reflect.Type]map[string]int
 
 type decodeIntoVisit struct {
@@ -28,8 +32,8 @@ func canUnmarshalDirect(t idl.Type, v any) bool {
 	return canDecodeIntoValue(t, dst, make(map[decodeIntoVisit]bool), make(map[uintptr]bool))
 }
 
-func unmarshalDirect(t idl.Type, r *bytes.Reader, v any) error {
-	return decodeIntoValue(t, r, reflect.ValueOf(v).Elem())
+func unmarshalDirect(t idl.Type, r *bytes.Reader, v any, q *quota) error {
+	return decodeIntoValue(t, r, reflect.ValueOf(v).Elem(), q)
 }
 
 func canDecodeIntoValue(t idl.Type, dst reflect.Value, seen map[decodeIntoVisit]bool, skipSeen map[uintptr]bool) bool {
@@ -39,6 +43,9 @@ func canDecodeIntoValue(t idl.Type, dst reflect.Value, seen map[decodeIntoVisit]
 	if dst.CanAddr() && dst.Addr().Type() == rawMessagePtrType {
 		return true
 	}
+	if dst.Type() == reservedType {
+		return canSkipValue(t, skipSeen)
+	}
 
 	if key, ok := decodeIntoVisitKey(t, dst); ok {
 		if seen[key] {
@@ -48,6 +55,14 @@ func canDecodeIntoValue(t idl.Type, dst reflect.Value, seen map[decodeIntoVisit]
 		defer delete(seen, key)
 	}
 
+	if dst.Kind() == reflect.Pointer {
+		// Values that can not be decoded into an optional value become null.
+		if t, ok := t.(*idl.OptionalType); ok {
+			return canSkipValue(t.Type, skipSeen)
+		}
+		return canSkipValue(t, skipSeen)
+	}
+
 	switch t := t.(type) {
 	case *idl.RecordType:
 		if dst.Kind() != reflect.Struct {
@@ -71,11 +86,6 @@ func canDecodeIntoValue(t idl.Type, dst reflect.Value, seen map[decodeIntoVisit]
 			return false
 		}
 		return canDecodeIntoValue(t.Type, reflect.New(dst.Type().Elem()).Elem(), seen, skipSeen)
-	case *idl.OptionalType:
-		if dst.Kind() != reflect.Pointer {
-			return false
-		}
-		return canDecodeIntoValue(t.Type, reflect.New(dst.Type().Elem()).Elem(), seen, skipSeen)
 	case *idl.VariantType:
 		if dst.Kind() != reflect.Struct {
 			return false
@@ -142,20 +152,54 @@ func canSkipValue(t idl.Type, seen map[uintptr]bool) bool {
 	}
 }
 
-func decodeIntoValue(t idl.Type, r *bytes.Reader, dst reflect.Value) error {
+func decodeIntoValue(t idl.Type, r *bytes.Reader, dst reflect.Value, q *quota) error {
 	if dst.CanAddr() && dst.Addr().Type() == rawMessagePtrType {
-		raw, err := t.Read(r)
+		raw, err := q.readValue(t, r)
 		if err != nil {
 			return err
 		}
 		dst.SetBytes(raw)
 		return nil
 	}
+	if dst.Type() == reservedType {
+		// Any value can be decoded as reserved.
+		return q.skipValue(t, r)
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		switch t.(type) {
+		case *idl.OptionalType, *idl.NullType, *idl.ReservedType:
+		default:
+			// A value of type t is a value of type opt t, unless it is
+			// decoded into an optional value of a type that contains null,
+			// e.g. opt opt t or opt reserved.
+			if elem := dst.Type().Elem(); elem.Kind() == reflect.Pointer ||
+				elem == nullType || elem == reservedType {
+				dst.Set(reflect.Zero(dst.Type()))
+				return q.skipValue(t, r)
+			}
+			return decodeOptionalValueInto(t, r, dst, q)
+		}
+	}
+
+	leave, err := q.enter(t, q.addElements)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
+	if dst.Kind() == reflect.Pointer {
+		if t, ok := t.(*idl.OptionalType); ok {
+			return decodeOptionalInto(t, r, dst, q)
+		}
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
 
 	switch t := t.(type) {
 	case *idl.RecordType:
 		if dst.Kind() != reflect.Struct {
-			raw, err := t.Decode(r)
+			raw, err := q.decode(t, r)
 			if err != nil {
 				return err
 			}
@@ -164,24 +208,24 @@ func decodeIntoValue(t idl.Type, r *bytes.Reader, dst reflect.Value) error {
 		for _, f := range t.Fields {
 			field, ok := fieldByCandidName(dst, f.Name)
 			if !ok {
-				if err := skipValue(f.Type, r); err != nil {
+				if err := q.skipValue(f.Type, r); err != nil {
 					return err
 				}
 				continue
 			}
-			if err := decodeIntoValue(f.Type, r, field); err != nil {
+			if err := decodeIntoValue(f.Type, r, field, q); err != nil {
 				return err
 			}
 		}
 		return nil
 	case *idl.VectorType:
-		return decodeVectorInto(t, r, dst)
+		return decodeVectorInto(t, r, dst, q)
 	case *idl.OptionalType:
-		return decodeOptionalInto(t, r, dst)
+		return decodeOptionalInto(t, r, dst, q)
 	case *idl.VariantType:
-		return decodeVariantInto(t, r, dst)
+		return decodeVariantInto(t, r, dst, q)
 	default:
-		raw, err := t.Decode(r)
+		raw, err := q.decode(t, r)
 		if err != nil {
 			return err
 		}
@@ -189,8 +233,8 @@ func decodeIntoValue(t idl.Type, r *bytes.Reader, dst reflect.Value) error {
 	}
 }
 
-func decodeVectorInto(t *idl.VectorType, r *bytes.Reader, dst reflect.Value) error {
-	n, err := decodeIntoLen(r)
+func decodeVectorInto(t *idl.VectorType, r *bytes.Reader, dst reflect.Value, q *quota) error {
+	n, err := q.decodeVectorLen(t, r)
 	if err != nil {
 		return err
 	}
@@ -209,14 +253,14 @@ func decodeVectorInto(t *idl.VectorType, r *bytes.Reader, dst reflect.Value) err
 		return idl.NewUnmarshalGoError(nil, dst.Addr().Interface())
 	}
 	for i := 0; i < n; i++ {
-		if err := decodeIntoValue(t.Type, r, dst.Index(i)); err != nil {
+		if err := decodeIntoValue(t.Type, r, dst.Index(i), q); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func decodeOptionalInto(t *idl.OptionalType, r *bytes.Reader, dst reflect.Value) error {
+func decodeOptionalInto(t *idl.OptionalType, r *bytes.Reader, dst reflect.Value, q *quota) error {
 	b, err := r.ReadByte()
 	if err != nil {
 		return err
@@ -229,16 +273,42 @@ func decodeOptionalInto(t *idl.OptionalType, r *bytes.Reader, dst reflect.Value)
 		if dst.Kind() != reflect.Pointer {
 			return idl.NewUnmarshalGoError(nil, dst.Addr().Interface())
 		}
-		if dst.IsNil() {
-			dst.Set(reflect.New(dst.Type().Elem()))
-		}
-		return decodeIntoValue(t.Type, r, dst.Elem())
+		return decodeOptionalValueInto(t.Type, r, dst, q)
 	default:
 		return fmt.Errorf("invalid option value: %x", b)
 	}
 }
 
-func decodeVariantInto(t *idl.VariantType, r *bytes.Reader, dst reflect.Value) error {
+// decodeOptionalValueInto decodes a value of type t into the optional value
+// dst. If the value can not be decoded into the type dst points to, it is
+// skipped and dst is set to null, as required by the subtyping rules of opt.
+func decodeOptionalValueInto(t idl.Type, r *bytes.Reader, dst reflect.Value, q *quota) error {
+	elem := reflect.New(dst.Type().Elem())
+	if !canDecodeIntoValue(t, elem.Elem(), make(map[decodeIntoVisit]bool), make(map[uintptr]bool)) {
+		dst.Set(reflect.Zero(dst.Type()))
+		return q.skipValue(t, r)
+	}
+	start := r.Size() - int64(r.Len())
+	elements, zeroSized := q.elements, q.zeroSized
+	if err := decodeIntoValue(t, r, elem.Elem(), q); err != nil {
+		var unmarshalGoError *idl.UnmarshalGoError
+		if !errors.As(err, &unmarshalGoError) {
+			return err
+		}
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		// The value is skipped instead, so it is no longer charged as
+		// decoded.
+		q.elements, q.zeroSized = elements, zeroSized
+		dst.Set(reflect.Zero(dst.Type()))
+		return q.skipValue(t, r)
+	}
+	dst.Set(elem)
+	return nil
+}
+
+func decodeVariantInto(t *idl.VariantType, r *bytes.Reader, dst reflect.Value, q *quota) error {
 	index, err := readULEB128Uint64(r)
 	if err != nil {
 		return err
@@ -249,7 +319,7 @@ func decodeVariantInto(t *idl.VariantType, r *bytes.Reader, dst reflect.Value) e
 	f := t.Fields[int(index)]
 	field, ok := fieldByCandidName(dst, f.Name)
 	if !ok {
-		if err := skipValue(f.Type, r); err != nil {
+		if err := q.skipValue(f.Type, r); err != nil {
 			return err
 		}
 		return idl.NewUnmarshalGoError(nil, dst.Addr().Interface())
@@ -260,25 +330,203 @@ func decodeVariantInto(t *idl.VariantType, r *bytes.Reader, dst reflect.Value) e
 	if field.IsNil() {
 		field.Set(reflect.New(field.Type().Elem()))
 	}
-	return decodeIntoValue(f.Type, r, field.Elem())
+	return decodeIntoValue(f.Type, r, field.Elem(), q)
+}
+
+// quota tracks the resources that are used to decode a message against the
+// limits of the decode options.
+type quota struct {
+	options   DecodeOptions
+	elements  int
+	zeroSized int
+	skipCost  int
+	depth     int
+}
+
+// enter charges a value of type t with the given cost function, and checks the
+// nesting depth if it is of a constructed type. The returned function must be
+// called once the value is read.
+func (q *quota) enter(t idl.Type, charge func(n int) error) (func(), error) {
+	if err := charge(1); err != nil {
+		return nil, err
+	}
+	switch t.(type) {
+	case *idl.RecordType, *idl.VectorType, *idl.OptionalType, *idl.VariantType:
+	default:
+		return func() {}, nil
+	}
+	q.depth++
+	if max := q.options.MaxDepth; max != 0 && max < q.depth {
+		q.depth--
+		return nil, &LimitError{Limit: "MaxDepth", Max: max}
+	}
+	return func() { q.depth-- }, nil
+}
+
+// decodeValue decodes the value of type t into the same values as t.Decode,
+// but checks the limits while the value is decoded.
+func (q *quota) decodeValue(t idl.Type, r *bytes.Reader) (any, error) {
+	leave, err := q.enter(t, q.addElements)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+	return q.decode(t, r)
+}
+
+// decode decodes the value of type t, which is already charged by enter.
+func (q *quota) decode(t idl.Type, r *bytes.Reader) (any, error) {
+	switch t := t.(type) {
+	case *idl.RecordType:
+		rec := make(map[string]any)
+		for _, f := range t.Fields {
+			v, err := q.decodeValue(f.Type, r)
+			if err != nil {
+				return nil, err
+			}
+			rec[f.Name] = v
+		}
+		if len(rec) == 0 {
+			return nil, nil
+		}
+		return rec, nil
+	case *idl.VectorType:
+		n, err := q.decodeVectorLen(t, r)
+		if err != nil {
+			return nil, err
+		}
+		vs := make([]any, n)
+		for i := range vs {
+			v, err := q.decodeValue(t.Type, r)
+			if err != nil {
+				return nil, err
+			}
+			vs[i] = v
+		}
+		return vs, nil
+	case *idl.OptionalType:
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case 0x00:
+			return nil, nil
+		case 0x01:
+			v, err := q.decodeValue(t.Type, r)
+			if err != nil {
+				return nil, err
+			}
+			if idl.ContainsNull(t.Type) {
+				// As returned by idl.OptionalType.Decode.
+				return &v, nil
+			}
+			return v, nil
+		default:
+			return nil, fmt.Errorf("invalid option value: %x", b)
+		}
+	case *idl.VariantType:
+		index, err := readULEB128Uint64(r)
+		if err != nil {
+			return nil, err
+		}
+		if index >= uint64(len(t.Fields)) {
+			return nil, fmt.Errorf("invalid variant index: %v", index)
+		}
+		f := t.Fields[int(index)]
+		v, err := q.decodeValue(f.Type, r)
+		if err != nil {
+			return nil, err
+		}
+		return &idl.Variant{
+			Name:  f.Name,
+			Value: v,
+			Type:  f.Type,
+		}, nil
+	default:
+		return t.Decode(r)
+	}
+}
+
+// readValue reads the value of type t without decoding it, and returns its
+// bytes.
+func (q *quota) readValue(t idl.Type, r *bytes.Reader) ([]byte, error) {
+	start := r.Size() - int64(r.Len())
+	if err := q.walkValue(t, r, q.addElements); err != nil {
+		return nil, err
+	}
+	raw := make([]byte, r.Size()-int64(r.Len())-start)
+	if n, err := r.ReadAt(raw, start); n != len(raw) {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (q *quota) addElements(n int) error {
+	q.elements += n
+	if max := q.options.MaxElements; max != 0 && max < q.elements {
+		return &LimitError{Limit: "MaxElements", Max: max}
+	}
+	return nil
+}
+
+func (q *quota) addZeroSized(n int) error {
+	// The length is not limited by the input, so it is checked before it is
+	// added, which could overflow.
+	if max := q.options.MaxZeroSizedElements; max != 0 && max-q.zeroSized < n {
+		return &LimitError{Limit: "MaxZeroSizedElements", Max: max}
+	}
+	q.zeroSized += n
+	return nil
+}
+
+func (q *quota) addSkipCost(n int) error {
+	q.skipCost += n
+	if max := q.options.MaxSkipCost; max != 0 && max < q.skipCost {
+		return &LimitError{Limit: "MaxSkipCost", Max: max}
+	}
+	return nil
 }
 
-func skipValue(t idl.Type, r *bytes.Reader) error {
+// skipValue skips the value of type t, which is charged to the skip cost.
+func (q *quota) skipValue(t idl.Type, r *bytes.Reader) error {
+	return q.walkValue(t, r, q.addSkipCost)
+}
+
+// walkValue reads past the value of type t, charging every value it contains
+// with the given cost function.
+func (q *quota) walkValue(t idl.Type, r *bytes.Reader, charge func(n int) error) error {
+	leave, err := q.enter(t, charge)
+	if err != nil {
+		return err
+	}
+	defer leave()
+
 	switch t := t.(type) {
 	case *idl.RecordType:
 		for _, f := range t.Fields {
-			if err := skipValue(f.Type, r); err != nil {
+			if err := q.walkValue(f.Type, r, charge); err != nil {
 				return err
 			}
 		}
 		return nil
 	case *idl.VectorType:
-		n, err := decodeIntoLen(r)
+		n, err := q.decodeVectorLen(t, r)
 		if err != nil {
 			return err
 		}
+		if size, ok := fixedSize(t.Type); ok {
+			// Blobs and other vectors of fixed size values are skipped at once.
+			if err := charge(n); err != nil {
+				return err
+			}
+			if size != 0 && n > r.Len()/size {
+				return io.ErrUnexpectedEOF
+			}
+			return skipBytes(r, n*size)
+		}
 		for i := 0; i < n; i++ {
-			if err := skipValue(t.Type, r); err != nil {
+			if err := q.walkValue(t.Type, r, charge); err != nil {
 				return err
 			}
 		}
@@ -292,7 +540,7 @@ func skipValue(t idl.Type, r *bytes.Reader) error {
 		case 0x00:
 			return nil
 		case 0x01:
-			return skipValue(t.Type, r)
+			return q.walkValue(t.Type, r, charge)
 		default:
 			return fmt.Errorf("invalid option value: %x", b)
 		}
@@ -304,7 +552,7 @@ func skipValue(t idl.Type, r *bytes.Reader) error {
 		if index >= uint64(len(t.Fields)) {
 			return fmt.Errorf("invalid variant index: %v", index)
 		}
-		return skipValue(t.Fields[int(index)].Type, r)
+		return q.walkValue(t.Fields[int(index)].Type, r, charge)
 	case *idl.NullType, *idl.ReservedType:
 		return nil
 	case *idl.EmptyType:
@@ -331,11 +579,7 @@ func skipValue(t idl.Type, r *bytes.Reader) error {
 	case *idl.FloatType:
 		return skipBytes(r, int(t.Base()))
 	case *idl.TextType:
-		n, err := decodeIntoLen(r)
-		if err != nil {
-			return err
-		}
-		return skipBytes(r, n)
+		return skipText(r)
 	case *idl.PrincipalType:
 		return skipPrincipal(r)
 	case *idl.FunctionType:
@@ -349,6 +593,23 @@ func skipValue(t idl.Type, r *bytes.Reader) error {
 	}
 }
 
+// fixedSize returns the size of the values of type t, if all of them have
+// the same size and consist of a single value, e.g. nat8 or null.
+func fixedSize(t idl.Type) (int, bool) {
+	switch t := t.(type) {
+	case *idl.NullType, *idl.ReservedType:
+		return 0, true
+	case *idl.NatType:
+		return int(t.Base()), t.Base() != 0
+	case *idl.IntType:
+		return int(t.Base()), t.Base() != 0
+	case *idl.FloatType:
+		return int(t.Base()), true
+	default:
+		return 0, false
+	}
+}
+
 func canDecodeScalarInto(t idl.Type, dst reflect.Value) bool {
 	if !dst.CanAddr() {
 		return false
@@ -363,6 +624,21 @@ func canDecodeScalarInto(t idl.Type, dst reflect.Value) bool {
 	}
 }
 
+func skipText(r *bytes.Reader) error {
+	n, err := decodeIntoLen(r)
+	if err != nil {
+		return err
+	}
+	bs := make([]byte, n)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return err
+	}
+	if !utf8.Valid(bs) {
+		return fmt.Errorf("invalid utf8 text: %s", bs)
+	}
+	return nil
+}
+
 func skipFunction(r *bytes.Reader) error {
 	b0, err := r.ReadByte()
 	if err != nil {
@@ -386,7 +662,14 @@ func skipFunction(r *bytes.Reader) error {
 	if err != nil {
 		return err
 	}
-	return skipBytes(r, n)
+	m := make([]byte, n)
+	if _, err := io.ReadFull(r, m); err != nil {
+		return err
+	}
+	if !utf8.Valid(m) {
+		return fmt.Errorf("invalid utf8 method: %s", m)
+	}
+	return nil
 }
 
 func skipService(r *bytes.Reader) error {
@@ -441,6 +724,27 @@ func decodeIntoLen(r *bytes.Reader) (int, error) {
 	return int(l), nil
 }
 
+// decodeVectorLen reads the length of a vector. Values of null and reserved
+// take up no bytes, so the lengths of their vectors are not limited by the
+// remaining input, but charged to MaxZeroSizedElements before any of them
+// are read.
+func (q *quota) decodeVectorLen(t *idl.VectorType, r *bytes.Reader) (int, error) {
+	if size, ok := fixedSize(t.Type); !ok || size != 0 {
+		return decodeIntoLen(r)
+	}
+	l, err := readULEB128Uint64(r)
+	if err != nil {
+		return 0, err
+	}
+	if l > uint64(int(^uint(0)>>1)) {
+		return 0, fmt.Errorf("invalid length %d", l)
+	}
+	if err := q.addZeroSized(int(l)); err != nil {
+		return 0, err
+	}
+	return int(l), nil
+}
+
 func skipLEB128(r *bytes.Reader) error {
 	for {
 		b, err := r.ReadByte()
@@ -1,10 +1,12 @@
 package candid
 
 import (
+	"errors"
 	"math/big"
 	"testing"
 
 	"github.com/niccolofant/agent-go/candid/idl"
+	"github.com/niccolofant/agent-go/principal"
 )
 
 func TestDecodeRaw(t *testing.T) {
@@ -84,6 +86,130 @@ func TestDecode_futureTypeOpcode(t *testing.T) {
 	})
 }
 
+func TestDecode_functionAnnotations(t *testing.T) {
+	for _, ann := range []string{"query", "oneway", "composite_query"} {
+		f := idl.NewFunctionType(nil, nil, []string{ann})
+		v := &idl.PrincipalMethod{
+			Principal: principal.MustDecode("w7x7r-cok77-xa"),
+			Method:    "foo",
+		}
+		raw, err := Encode([]idl.Type{f}, []any{v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts, _, err := Decode(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ts[0].(*idl.FunctionType).Annotations; len(got) != 1 || got[0] != ann {
+			t.Errorf("got %v, want [%s]", got, ann)
+		}
+	}
+
+	t.Run("unknown annotation", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01,                   // type table count = 1
+			0x6a, 0x00, 0x00, 0x01, // func () -> () with 1 annotation
+			0x04, // unknown annotation
+			0x00, // arg count = 0
+		}
+		if _, _, err := Decode(wire); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("invalid utf8 method", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01,                   // type table count = 1
+			0x6a, 0x00, 0x00, 0x00, // func () -> ()
+			0x01,       // arg count = 1
+			0x00,       // arg type = type-table index 0
+			0x01, 0x01, // reference
+			0x00,                   // principal length = 0
+			0x03, 0xe2, 0x28, 0xa1, // method "\xe2\x28\xa1"
+		}
+		if _, _, err := Decode(wire); err == nil {
+			t.Fatal("expected error")
+		}
+		var v idl.RawMessage
+		if err := Unmarshal(wire, []any{&v}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestDecode_primitiveTypeInTypeTable(t *testing.T) {
+	for _, o := range []byte{
+		0x7d, // nat (-3)
+		0x68, // principal (-24)
+	} {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01, // type table count = 1
+			o,    // primitive opcode, not allowed in the type table
+			0x01, // arg count = 1
+			0x00, // arg type = type-table index 0
+		}
+		var v any
+		if err := Unmarshal(wire, []any{&v}); err == nil {
+			t.Errorf("expected an error for opcode %#x in the type table", o)
+		}
+	}
+}
+
+func TestDecode_recursiveTypeTable(t *testing.T) {
+	t.Run("opt", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01,       // type table count = 1
+			0x6e, 0x00, // opt (type-table index 0)
+			0x01,             // arg count = 1
+			0x00,             // arg type = type-table index 0
+			0x01, 0x01, 0x00, // opt opt null
+		}
+		type opt *opt
+		var v opt
+		if err := Unmarshal(wire, []any{&v}); err != nil {
+			t.Fatal(err)
+		}
+		if v == nil || *v == nil || **v != nil {
+			t.Fatalf("got %v, want opt opt null", v)
+		}
+	})
+
+	t.Run("vec", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01,       // type table count = 1
+			0x6d, 0x00, // vec (type-table index 0)
+			0x01,             // arg count = 1
+			0x00,             // arg type = type-table index 0
+			0x02, 0x00, 0x00, // vec { vec {}; vec {} }
+		}
+		_, vs, err := Decode(wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vs := vs[0].([]any); len(vs) != 2 || len(vs[0].([]any)) != 0 || len(vs[1].([]any)) != 0 {
+			t.Fatalf("got %v, want vec { vec {}; vec {} }", vs)
+		}
+	})
+
+	t.Run("index out of range", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01,       // type table count = 1
+			0x6e, 0x01, // opt (type-table index 1)
+			0x00, // arg count = 0
+		}
+		if _, _, err := Decode(wire); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
 func TestDecode_recordFieldOrdering(t *testing.T) {
 	t.Run("duplicate id rejected", func(t *testing.T) {
 		wire := []byte{
@@ -163,7 +289,7 @@ func TestUnmarshalDirect_skipsUnknownNestedFields(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	ts, _, err := decodeTypes(encoded)
+	ts, _, err := decodeTypes(encoded, DefaultDecodeOptions)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -202,7 +328,7 @@ func TestUnmarshalDirect_fullRecord(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	ts, _, err := decodeTypes(encoded)
+	ts, _, err := decodeTypes(encoded, DefaultDecodeOptions)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -248,6 +374,213 @@ func TestUnmarshalDirect_unknownVariantArmStillErrors(t *testing.T) {
 	}
 }
 
+func TestUnmarshal_arguments(t *testing.T) {
+	encoded, err := Marshal([]any{uint64(1), "two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("additional arguments", func(t *testing.T) {
+		var one uint64
+		if err := Unmarshal(encoded, []any{&one}); err != nil {
+			t.Fatal(err)
+		}
+		if one != 1 {
+			t.Fatalf("got %d, want 1", one)
+		}
+	})
+
+	t.Run("missing optional arguments", func(t *testing.T) {
+		var (
+			one   uint64
+			two   string
+			three = new(uint64)
+			four  idl.Null
+		)
+		if err := Unmarshal(encoded, []any{&one, &two, &three, &four}); err != nil {
+			t.Fatal(err)
+		}
+		if three != nil {
+			t.Fatalf("got %d, want null", *three)
+		}
+	})
+
+	t.Run("missing arguments", func(t *testing.T) {
+		var (
+			one   uint64
+			two   string
+			three uint64
+		)
+		if err := Unmarshal(encoded, []any{&one, &two, &three}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		var (
+			one uint64
+			two string
+		)
+		if err := Unmarshal(append(encoded, 0x00), []any{&one, &two}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestUnmarshal_reserved(t *testing.T) {
+	encoded, err := Marshal([]any{uint64(1), struct {
+		A string `ic:"a"`
+		B []int8 `ic:"b"`
+	}{A: "a", B: []int8{-1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var one idl.Reserved
+	var two struct {
+		A idl.Reserved `ic:"a"`
+		B idl.Reserved `ic:"b"`
+	}
+	if err := Unmarshal(encoded, []any{&one, &two}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("invalid utf8 text", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x00,                   // type table count = 0
+			0x01,                   // arg count = 1
+			0x71,                   // arg type = text
+			0x03, 0xe2, 0x28, 0xa1, // "\xe2\x28\xa1"
+		}
+		if err := Unmarshal(wire, []any{&one}); err == nil {
+			t.Fatal("expected error")
+		}
+		if err := Unmarshal(wire, []any{}); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestUnmarshal_service(t *testing.T) {
+	p := principal.MustDecode("w7x7r-cok77-xa")
+	encoded, err := Encode([]idl.Type{idl.NewServiceType(nil)}, []any{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v principal.Principal
+	if err := Unmarshal(encoded, []any{&v}); err != nil {
+		t.Fatal(err)
+	}
+	if !v.Equal(p) {
+		t.Fatalf("got %s, want %s", v, p)
+	}
+}
+
+func TestUnmarshal_optionalCoercion(t *testing.T) {
+	type wireVariant struct {
+		Known *uint64 `ic:"known,variant"`
+		Other *uint64 `ic:"other,variant"`
+	}
+	type gotVariant struct {
+		Known *uint64 `ic:"known,variant"`
+	}
+
+	t.Run("unknown variant arm in opt", func(t *testing.T) {
+		type wire struct {
+			Choice *wireVariant `ic:"choice"`
+			Tail   string       `ic:"tail"`
+		}
+		type got struct {
+			Choice *gotVariant `ic:"choice"`
+			Tail   string      `ic:"tail"`
+		}
+		other := uint64(42)
+		encoded, err := Marshal([]any{wire{Choice: &wireVariant{Other: &other}, Tail: "kept"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		value := got{Choice: &gotVariant{}}
+		if err := Unmarshal(encoded, []any{&value}); err != nil {
+			t.Fatal(err)
+		}
+		if value.Choice != nil || value.Tail != "kept" {
+			t.Fatalf("got %#v", value)
+		}
+	})
+
+	t.Run("mismatched opt value", func(t *testing.T) {
+		type wire struct {
+			A *string `ic:"a"`
+			B uint64  `ic:"b"`
+		}
+		type got struct {
+			A *uint64 `ic:"a"`
+			B uint64  `ic:"b"`
+		}
+		a := "text"
+		encoded, err := Marshal([]any{wire{A: &a, B: 7}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var value got
+		if err := Unmarshal(encoded, []any{&value}); err != nil {
+			t.Fatal(err)
+		}
+		if value.A != nil || value.B != 7 {
+			t.Fatalf("got %#v", value)
+		}
+	})
+
+	t.Run("value into opt", func(t *testing.T) {
+		encoded, err := Marshal([]any{idl.NewNat(uint64(5)), "text", idl.Null{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := new(idl.Nat)
+		s := new(uint64)
+		null := new(string)
+		if err := Unmarshal(encoded, []any{&n, &s, &null}); err != nil {
+			t.Fatal(err)
+		}
+		if n == nil || n.BigInt().Int64() != 5 {
+			t.Fatalf("got %v, want 5", n)
+		}
+		if s != nil || null != nil {
+			t.Fatalf("got %v and %v, want null", s, null)
+		}
+	})
+
+	t.Run("value into nested opt", func(t *testing.T) {
+		encoded, err := Marshal([]any{"text"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := new(*string)
+		if err := Unmarshal(encoded, []any{&v}); err != nil {
+			t.Fatal(err)
+		}
+		if v != nil {
+			t.Fatalf("got %v, want null", v)
+		}
+	})
+
+	t.Run("value into opt reserved", func(t *testing.T) {
+		encoded, err := Marshal([]any{"text", "text"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reserved, null := new(idl.Reserved), new(idl.Null)
+		if err := Unmarshal(encoded, []any{&reserved, &null}); err != nil {
+			t.Fatal(err)
+		}
+		if reserved != nil || null != nil {
+			t.Fatalf("got %v and %v, want null", reserved, null)
+		}
+	})
+}
+
 func BenchmarkUnmarshal_skippedVsMaterializedNestedFields(b *testing.B) {
 	type ignoredInner struct {
 		A     uint64   `ic:"a"`
@@ -305,3 +638,144 @@ func BenchmarkUnmarshal_skippedVsMaterializedNestedFields(b *testing.B) {
 		}
 	})
 }
+
+func TestDecodeWithOptions_limits(t *testing.T) {
+	expectLimit := func(t *testing.T, err error, limit string) {
+		t.Helper()
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("expected limit error, got %v", err)
+		}
+		if limitErr.Limit != limit {
+			t.Fatalf("got limit %s, want %s", limitErr.Limit, limit)
+		}
+	}
+
+	t.Run("type table entries", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x02,       // type table count = 2
+			0x6e, 0x7f, // opt null
+			0x6e, 0x7f, // opt null
+			0x00, // arg count = 0
+		}
+		_, _, err := DecodeWithOptions(wire, DecodeOptions{MaxTypeTableEntries: 1})
+		expectLimit(t, err, "MaxTypeTableEntries")
+		if _, _, err := DecodeWithOptions(wire, DecodeOptions{MaxTypeTableEntries: 2}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("elements", func(t *testing.T) {
+		// A vec vec null of 64 inner vectors with 2016 null values in total.
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x02,       // type table count = 2
+			0x6d, 0x01, // vec (type-table index 1)
+			0x6d, 0x7f, // vec null
+			0x01, // arg count = 1
+			0x00, // arg type = type-table index 0
+			0x40, // 64 inner vectors
+		}
+		for i := 63; 0 <= i; i-- {
+			wire = append(wire, byte(i))
+		}
+		_, _, err := DecodeWithOptions(wire, DecodeOptions{MaxElements: 1000})
+		expectLimit(t, err, "MaxElements")
+		_, vs, err := DecodeWithOptions(wire, DecodeOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l := len(vs[0].([]any)); l != 64 {
+			t.Fatalf("got %d inner vectors, want 64", l)
+		}
+	})
+
+	t.Run("zero-sized elements", func(t *testing.T) {
+		// Null values take up no bytes, so the length of a vec null is only
+		// limited by MaxZeroSizedElements.
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01,       // type table count = 1
+			0x6d, 0x7f, // vec null
+			0x01, // arg count = 1
+			0x00, // arg type = type-table index 0
+			0x03, // 3 null values
+		}
+		_, vs, err := Decode(wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l := len(vs[0].([]any)); l != 3 {
+			t.Fatalf("got %d values, want 3", l)
+		}
+		var v []*struct{}
+		if err := Unmarshal(wire, []any{&v}); err != nil {
+			t.Fatal(err)
+		}
+		if len(v) != 3 {
+			t.Fatalf("got %d values, want 3", len(v))
+		}
+		_, _, err = DecodeWithOptions(wire, DecodeOptions{MaxElements: 3})
+		expectLimit(t, err, "MaxElements")
+		_, _, err = DecodeWithOptions(wire, DecodeOptions{MaxZeroSizedElements: 2})
+		expectLimit(t, err, "MaxZeroSizedElements")
+		expectLimit(t, UnmarshalWithOptions(wire, []any{&v}, DecodeOptions{MaxZeroSizedElements: 2}), "MaxZeroSizedElements")
+	})
+
+	t.Run("spacebomb", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01,       // type table count = 1
+			0x6d, 0x7f, // vec null
+			0x01,                   // arg count = 1
+			0x00,                   // arg type = type-table index 0
+			0xf0, 0xff, 0xff, 0x07, // 16777200 null values
+		}
+		_, _, err := Decode(wire)
+		expectLimit(t, err, "MaxZeroSizedElements")
+		_, _, err = DecodeRaw(wire)
+		expectLimit(t, err, "MaxZeroSizedElements")
+		var v []struct{}
+		expectLimit(t, Unmarshal(wire, []any{&v}), "MaxZeroSizedElements")
+		var a any
+		expectLimit(t, Unmarshal(wire, []any{&a}), "MaxZeroSizedElements")
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		wire := []byte{
+			'D', 'I', 'D', 'L',
+			0x01,             // type table count = 1
+			0x6c, 0x01, 0x00, // record { 0 : type-table index 0 }
+			0x00, // field type
+			0x01, // arg count = 1
+			0x00, // arg type = type-table index 0
+		}
+		_, _, err := Decode(wire)
+		expectLimit(t, err, "MaxDepth")
+		var v any
+		expectLimit(t, Unmarshal(wire, []any{&v}), "MaxDepth")
+	})
+
+	t.Run("skip cost", func(t *testing.T) {
+		type wire struct {
+			A []uint64 `ic:"a"`
+			B string   `ic:"b"`
+		}
+		type got struct {
+			B string `ic:"b"`
+		}
+		encoded, err := Marshal([]any{wire{A: make([]uint64, 100), B: "kept"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var g got
+		expectLimit(t, UnmarshalWithOptions(encoded, []any{&g}, DecodeOptions{MaxSkipCost: 100}), "MaxSkipCost")
+		if err := UnmarshalWithOptions(encoded, []any{&g}, DecodeOptions{MaxSkipCost: 101}); err != nil {
+			t.Fatal(err)
+		}
+		if g.B != "kept" {
+			t.Fatalf("got %q, want kept", g.B)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package did
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/niccolofant/agent-go/candid/idl"
+)
+
+// Incompatibility is a change to a method of a service that breaks clients of
+// the previous version of the service.
+type Incompatibility struct {
+	// Method is the name of the method.
+	Method string
+	// Reason describes the change, including the path to the type that
+	// changed, e.g. "args[0].owner: text is not a subtype of principal".
+	Reason string
+	// Warning is true if the change does not break clients, but values of the
+	// previous type are decoded as null by the special opt rule, e.g. if an
+	// "opt nat" changed into an "opt text".
+	Warning bool
+}
+
+func (i Incompatibility) String() string {
+	if i.Warning {
+		return fmt.Sprintf("warning: %s: %s", i.Method, i.Reason)
+	}
+	return fmt.Sprintf("%s: %s", i.Method, i.Reason)
+}
+
+// CheckCompatibility checks whether the service of next can replace the service
+// of prev without breaking its clients, i.e. whether it is a subtype of the
+// previous service, like `didc check` does. It returns the methods of prev that
+// were removed or whose types changed incompatibly, followed by warnings for
+// the values that are decoded as null after the upgrade, see
+// idl.OptionalCoercions.
+func CheckCompatibility(prev, next Description) ([]Incompatibility, error) {
+	prevService, err := prev.ServiceType()
+	if err != nil {
+		return nil, err
+	}
+	nextService, err := next.ServiceType()
+	if err != nil {
+		return nil, err
+	}
+	var incompatibilities, warnings []Incompatibility
+	for _, m := range prevService.Methods {
+		i := slices.IndexFunc(nextService.Methods, func(n idl.Method) bool { return n.Name == m.Name })
+		if i < 0 {
+			incompatibilities = append(incompatibilities, Incompatibility{
+				Method: m.Name,
+				Reason: "method was removed",
+			})
+			continue
+		}
+		if err := idl.CheckSubtype(nextService.Methods[i].Func, m.Func); err != nil {
+			incompatibilities = append(incompatibilities, Incompatibility{
+				Method: m.Name,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		for _, coercion := range idl.OptionalCoercions(nextService.Methods[i].Func, m.Func) {
+			warnings = append(warnings, Incompatibility{
+				Method:  m.Name,
+				Reason:  coercion.Error(),
+				Warning: true,
+			})
+		}
+	}
+	return append(incompatibilities, warnings...), nil
+}
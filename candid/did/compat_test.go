@@ -0,0 +1,67 @@
+package did
+
+import (
+	"testing"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	prev, err := ParseDID([]rune(`
+type Account = record { owner : principal; subaccount : opt blob };
+type List = opt record { head : nat; tail : List };
+service : {
+	balance : (Account) -> (nat) query;
+	transfer : (record { to : Account; amount : nat }) -> (variant { Ok : nat; Err : text });
+	list : () -> (List) query;
+	removed : () -> ();
+	annotated : () -> () query;
+	status : () -> (variant { Running; Stopped });
+	lookup : (opt nat) -> (opt nat) query;
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := ParseDID([]rune(`
+type Account = record { owner : principal; subaccount : opt blob; memo : opt text };
+type List = opt record { head : nat; tail : List };
+service : {
+	balance : (Account, opt nat) -> (nat) query;
+	transfer : (record { to : Account; amount : nat64 }) -> (variant { Ok : nat; Err : text; Pending });
+	list : () -> (List) query;
+	annotated : () -> ();
+	added : () -> ();
+	status : () -> (variant { Running; Stopped; Stopping });
+	lookup : (opt nat) -> (opt text) query;
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	incompatibilities, err := CheckCompatibility(*prev, *next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, i := range incompatibilities {
+		got = append(got, i.String())
+	}
+	want := []string{
+		"transfer: args[0].amount: nat is not a subtype of nat64",
+		"removed: method was removed",
+		"annotated: annotations [] and [query] differ",
+		"status: results[0]: unexpected tag Stopping",
+		"warning: lookup: results[0]: text is not a subtype of nat, the value is decoded as null",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %q, want %q", got[i], want[i])
+		}
+	}
+
+	// Upgrading to the same interface is always compatible.
+	if incompatibilities, err := CheckCompatibility(*next, *next); err != nil || len(incompatibilities) != 0 {
+		t.Errorf("got %v, %v", incompatibilities, err)
+	}
+}
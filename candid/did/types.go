@@ -0,0 +1,336 @@
+package did
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/niccolofant/agent-go/candid/idl"
+)
+
+// IDLType converts the data type to an idl.Type, resolving references to the
+// type definitions of the description. Recursive types result in recursive
+// idl types.
+func (p Description) IDLType(data Data) (idl.Type, error) {
+	return newTypeResolver(p).convert(data)
+}
+
+// ServiceType returns the idl type of the service of the description.
+func (p Description) ServiceType() (*idl.Service, error) {
+	if len(p.Services) == 0 {
+		return nil, fmt.Errorf("no service declared")
+	}
+	return newTypeResolver(p).service(p.Services[0])
+}
+
+// typeResolver converts data types to idl types.
+type typeResolver struct {
+	definitions map[string]Data
+	// types contains the converted type definitions.
+	types map[string]idl.Type
+}
+
+func newTypeResolver(desc Description) *typeResolver {
+	definitions := make(map[string]Data)
+	for _, def := range desc.Definitions {
+		if t, ok := def.(Type); ok {
+			definitions[t.Id] = t.Data
+		}
+	}
+	return &typeResolver{
+		definitions: definitions,
+		types:       make(map[string]idl.Type),
+	}
+}
+
+func (r *typeResolver) convert(data Data) (idl.Type, error) {
+	switch data := data.(type) {
+	case DataId:
+		return r.named(string(data))
+	case Primitive:
+		return primitiveType(data)
+	case Principal:
+		return new(idl.PrincipalType), nil
+	case Blob:
+		return idl.NewVectorType(idl.Nat8Type()), nil
+	default:
+		return r.convertInto(data, nil)
+	}
+}
+
+// convertInto converts a composite data type. The type is registered under the
+// given name before its contents are converted, so that they can refer to it.
+func (r *typeResolver) convertInto(data Data, name *string) (idl.Type, error) {
+	register := func(t idl.Type) {
+		if name != nil {
+			r.types[*name] = t
+		}
+	}
+	switch data := data.(type) {
+	case Optional:
+		t := new(idl.OptionalType)
+		register(t)
+		elem, err := r.convert(data.Data)
+		if err != nil {
+			return nil, err
+		}
+		t.Type = elem
+		return t, nil
+	case Vector:
+		t := new(idl.VectorType)
+		register(t)
+		elem, err := r.convert(data.Data)
+		if err != nil {
+			return nil, err
+		}
+		t.Type = elem
+		return t, nil
+	case Record:
+		t := &idl.RecordType{IsTuple: len(data) != 0}
+		register(t)
+		fields, err := r.fields([]Field(data), false)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range data {
+			if f.Name != nil || f.Nat != nil {
+				t.IsTuple = false
+			}
+		}
+		t.Fields = fields
+		return t, nil
+	case Variant:
+		t := new(idl.VariantType)
+		register(t)
+		fields, err := r.fields([]Field(data), true)
+		if err != nil {
+			return nil, err
+		}
+		t.Fields = fields
+		return t, nil
+	case Func:
+		t := new(idl.FunctionType)
+		register(t)
+		f, err := r.function(data)
+		if err != nil {
+			return nil, err
+		}
+		*t = *f
+		return t, nil
+	case Service:
+		t := new(idl.Service)
+		register(t)
+		s, err := r.service(data)
+		if err != nil {
+			return nil, err
+		}
+		*t = *s
+		return t, nil
+	default:
+		if name != nil {
+			return r.convert(data)
+		}
+		return nil, fmt.Errorf("unsupported data type %T", data)
+	}
+}
+
+// named returns the type of the definition with the given name.
+func (r *typeResolver) named(name string) (idl.Type, error) {
+	if t, ok := r.types[name]; ok {
+		return t, nil
+	}
+	// Follow aliases like `type a = b` to the definition of the type.
+	target := name
+	aliases := make(map[string]bool)
+	for {
+		data, ok := r.definitions[target]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", target)
+		}
+		id, ok := data.(DataId)
+		if !ok {
+			break
+		}
+		if aliases[target] {
+			return nil, fmt.Errorf("type %q refers to itself", name)
+		}
+		aliases[target] = true
+		target = string(id)
+	}
+	t, ok := r.types[target]
+	if !ok {
+		var err error
+		if t, err = r.convertInto(r.definitions[target], &target); err != nil {
+			return nil, err
+		}
+		r.types[target] = t
+	}
+	r.types[name] = t
+	return t, nil
+}
+
+// fields converts the fields of a record or variant, ordered by their ids.
+// Fields without a label get the id of the previous field plus one.
+func (r *typeResolver) fields(fields []Field, variant bool) ([]idl.FieldType, error) {
+	type idField struct {
+		id    *big.Int
+		field idl.FieldType
+	}
+	var (
+		ts   []idField
+		next = new(big.Int)
+	)
+	for _, f := range fields {
+		var (
+			name string
+			id   *big.Int
+		)
+		switch {
+		case f.Name != nil:
+			name, id = *f.Name, idl.Hash(*f.Name)
+		case f.Nat != nil:
+			name, id = f.Nat.String(), f.Nat
+		case variant && f.NameData != nil:
+			// variant { tag }
+			ts = append(ts, idField{idl.Hash(*f.NameData), idl.FieldType{Name: *f.NameData, Type: new(idl.NullType)}})
+			continue
+		case variant && f.NatData != nil:
+			ts = append(ts, idField{f.NatData, idl.FieldType{Name: f.NatData.String(), Type: new(idl.NullType)}})
+			continue
+		default:
+			name, id = next.String(), next
+		}
+		next = new(big.Int).Add(id, big.NewInt(1))
+
+		var (
+			t   idl.Type
+			err error
+		)
+		switch {
+		case f.Data != nil:
+			t, err = r.convert(*f.Data)
+		case f.NameData != nil:
+			t, err = r.named(*f.NameData)
+		default:
+			return nil, fmt.Errorf("field %s has no type", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, idField{id, idl.FieldType{Name: name, Type: t}})
+	}
+	slices.SortStableFunc(ts, func(a, b idField) int { return a.id.Cmp(b.id) })
+	result := make([]idl.FieldType, len(ts))
+	for i, f := range ts {
+		result[i] = f.field
+	}
+	return result, nil
+}
+
+func (r *typeResolver) function(f Func) (*idl.FunctionType, error) {
+	args, err := r.parameters(f.ArgTypes)
+	if err != nil {
+		return nil, err
+	}
+	rets, err := r.parameters(f.ResTypes)
+	if err != nil {
+		return nil, err
+	}
+	var annotations []string
+	if f.Annotation != nil {
+		annotations = append(annotations, string(*f.Annotation))
+	}
+	return idl.NewFunctionType(args, rets, annotations), nil
+}
+
+func (r *typeResolver) parameters(tuple Tuple) ([]idl.FunctionParameter, error) {
+	var parameters []idl.FunctionParameter
+	for _, a := range tuple {
+		t, err := r.convert(a.Data)
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, idl.FunctionParameter{Type: t})
+	}
+	return parameters, nil
+}
+
+func (r *typeResolver) service(s Service) (*idl.Service, error) {
+	if s.MethodId != nil {
+		t, err := r.named(*s.MethodId)
+		if err != nil {
+			return nil, err
+		}
+		service, ok := t.(*idl.Service)
+		if !ok {
+			return nil, fmt.Errorf("type %q is not a service", *s.MethodId)
+		}
+		return service, nil
+	}
+	var service idl.Service
+	for _, m := range s.Methods {
+		var f *idl.FunctionType
+		if m.ID != nil {
+			t, err := r.named(*m.ID)
+			if err != nil {
+				return nil, err
+			}
+			ft, ok := t.(*idl.FunctionType)
+			if !ok {
+				return nil, fmt.Errorf("type %q of method %s is not a function", *m.ID, m.Name)
+			}
+			f = ft
+		} else {
+			ft, err := r.function(*m.Func)
+			if err != nil {
+				return nil, err
+			}
+			f = ft
+		}
+		service.Methods = append(service.Methods, idl.Method{Name: m.Name, Func: f})
+	}
+	return &service, nil
+}
+
+func primitiveType(p Primitive) (idl.Type, error) {
+	switch p {
+	case "null":
+		return new(idl.NullType), nil
+	case "bool":
+		return new(idl.BoolType), nil
+	case "nat":
+		return new(idl.NatType), nil
+	case "int":
+		return new(idl.IntType), nil
+	case "nat8":
+		return idl.Nat8Type(), nil
+	case "nat16":
+		return idl.Nat16Type(), nil
+	case "nat32":
+		return idl.Nat32Type(), nil
+	case "nat64":
+		return idl.Nat64Type(), nil
+	case "int8":
+		return idl.Int8Type(), nil
+	case "int16":
+		return idl.Int16Type(), nil
+	case "int32":
+		return idl.Int32Type(), nil
+	case "int64":
+		return idl.Int64Type(), nil
+	case "float32":
+		return idl.Float32Type(), nil
+	case "float64":
+		return idl.Float64Type(), nil
+	case "text":
+		return new(idl.TextType), nil
+	case "reserved":
+		return new(idl.ReservedType), nil
+	case "empty":
+		return new(idl.EmptyType), nil
+	case "principal":
+		return new(idl.PrincipalType), nil
+	default:
+		return nil, fmt.Errorf("unknown primitive type %q", string(p))
+	}
+}
@@ -1,13 +1,16 @@
 package did
 
 import (
+	"fmt"
 	"math/big"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/0x51-dev/upeg/parser"
 	"github.com/niccolofant/agent-go/candid/idl"
 	"github.com/niccolofant/agent-go/candid/internal/cvalue"
+	"github.com/niccolofant/agent-go/principal"
 )
 
 func ConvertValues(n *parser.Node) ([]idl.Type, []any, error) {
@@ -34,17 +37,22 @@ func ConvertValues(n *parser.Node) ([]idl.Type, []any, error) {
 		if err != nil {
 			return nil, nil, err
 		}
-		return []idl.Type{idl.NewOptionalType(types[0])}, []any{args[0]}, nil
+		// A pointer, so that the value of a nested optional can be null.
+		return []idl.Type{idl.NewOptionalType(types[0])}, []any{&args[0]}, nil
 	case cvalue.Record.Name:
 		if len(n.Children()) == 0 {
 			return []idl.Type{idl.NewRecordType(nil)}, []any{nil}, nil
 		}
 		types := make(map[string]idl.Type)
 		args := make(map[string]any)
+		var next uint32
 		for _, n := range n.Children() {
-			n := n.Children()
-			id := n[0].Value()
-			typ, arg, err := ConvertValues(n[1])
+			id, v := fieldValue(n, next)
+			next = fieldID(id) + 1
+			if _, ok := types[id]; ok {
+				return nil, nil, fmt.Errorf("duplicate field: %s", id)
+			}
+			typ, arg, err := ConvertValues(v)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -53,8 +61,10 @@ func ConvertValues(n *parser.Node) ([]idl.Type, []any, error) {
 		}
 		return []idl.Type{idl.NewRecordType(types)}, []any{args}, nil
 	case cvalue.Text.Name:
-		n := n.Children()[0]
-		s := strings.TrimPrefix(strings.TrimSuffix(n.Value(), "\""), "\"")
+		s, err := convertText(n.Children()[0])
+		if err != nil {
+			return nil, nil, err
+		}
 		return []idl.Type{new(idl.TextType)}, []any{s}, nil
 	case cvalue.Values.Name:
 		var (
@@ -72,7 +82,7 @@ func ConvertValues(n *parser.Node) ([]idl.Type, []any, error) {
 		return types, args, nil
 	case cvalue.Variant.Name:
 		n := n.Children()
-		id := n[0].Value()
+		id := fieldName(n[0])
 		switch len(n) {
 		case 1:
 			typ := idl.NewVariantType(map[string]idl.Type{id: new(idl.NullType)})
@@ -106,17 +116,190 @@ func ConvertValues(n *parser.Node) ([]idl.Type, []any, error) {
 		}
 		return []idl.Type{idl.NewVectorType(types)}, []any{args}, nil
 	case cvalue.Blob.Name:
-		rawBlob := strings.TrimPrefix(strings.TrimSuffix(n.Value(), "\""), "blob \"")
-		var blob []any
-		for _, c := range rawBlob {
-			blob = append(blob, byte(c))
+		blob, err := unescape(n.Children()[0])
+		if err != nil {
+			return nil, nil, err
 		}
-		return []idl.Type{idl.NewVectorType(idl.Nat8Type())}, append([]any{}, blob), nil
+		return []idl.Type{idl.NewVectorType(idl.Nat8Type())}, []any{blob}, nil
+	case cvalue.Principal.Name:
+		p, err := convertPrincipal(n.Children()[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return []idl.Type{new(idl.PrincipalType)}, []any{p}, nil
+	case cvalue.Service.Name:
+		p, err := convertPrincipal(n.Children()[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return []idl.Type{idl.NewServiceType(nil)}, []any{p}, nil
+	case cvalue.Func.Name:
+		m, err := convertFuncValue(n)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []idl.Type{idl.NewFunctionType(nil, nil, nil)}, []any{m}, nil
 	default:
 		panic(n)
 	}
 }
 
+// ConvertTypedValues converts the values into values of the given types, e.g.
+// "(1)" as (nat8) into uint8(1). Values without a type annotation get their
+// type from the given types.
+func ConvertTypedValues(types []idl.Type, n *parser.Node) ([]any, error) {
+	vs := []*parser.Node{n}
+	if n.Name == cvalue.Values.Name {
+		vs = n.Children()
+	}
+	if len(vs) != len(types) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(types), len(vs))
+	}
+	args := make([]any, len(vs))
+	for i, v := range vs {
+		arg, err := convertTypedValue(types[i], v)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+func convertTypedValue(typ idl.Type, n *parser.Node) (any, error) {
+	switch t := typ.(type) {
+	case *idl.ReservedType:
+		// Any value is a value of type reserved.
+		return nil, nil
+	case *idl.NullType:
+		if n.Name == cvalue.Null.Name {
+			return nil, nil
+		}
+	case *idl.BoolType:
+		if n.Name == cvalue.BoolValue.Name {
+			return n.Value() == "true", nil
+		}
+	case *idl.NatType, *idl.IntType, *idl.FloatType:
+		if n.Name == cvalue.Num.Name {
+			n := n.Children()
+			if len(n) == 2 && n[1].Value() != typ.String() {
+				return nil, fmt.Errorf("can not convert %s to %s", n[1].Value(), typ)
+			}
+			return convertNumValue(typ, n[0].Value())
+		}
+	case *idl.TextType:
+		if n.Name == cvalue.Text.Name {
+			return convertText(n.Children()[0])
+		}
+	case *idl.OptionalType:
+		switch n.Name {
+		case cvalue.Null.Name:
+			return nil, nil
+		case cvalue.OptValue.Name:
+			v, err := convertTypedValue(t.Type, n.Children()[0])
+			if err != nil {
+				return nil, err
+			}
+			// A pointer, so that the value of a nested optional can be null.
+			return &v, nil
+		}
+	case *idl.VectorType:
+		switch n.Name {
+		case cvalue.Vec.Name:
+			args := make([]any, len(n.Children()))
+			for i, n := range n.Children() {
+				v, err := convertTypedValue(t.Type, n)
+				if err != nil {
+					return nil, err
+				}
+				args[i] = v
+			}
+			return args, nil
+		case cvalue.Blob.Name:
+			if nat, ok := t.Type.(*idl.NatType); ok && nat.Base() == 1 {
+				return unescape(n.Children()[0])
+			}
+		}
+	case *idl.RecordType:
+		if n.Name == cvalue.Record.Name {
+			return convertTypedRecord(t, n)
+		}
+	case *idl.VariantType:
+		if n.Name == cvalue.Variant.Name {
+			n := n.Children()
+			id := fieldID(fieldName(n[0]))
+			for _, f := range t.Fields {
+				if fieldID(f.Name) != id {
+					continue
+				}
+				if len(n) == 1 {
+					if _, ok := f.Type.(*idl.NullType); !ok {
+						return nil, fmt.Errorf("missing value of variant field: %s", f.Name)
+					}
+					return idl.Variant{Name: f.Name, Type: t}, nil
+				}
+				v, err := convertTypedValue(f.Type, n[1])
+				if err != nil {
+					return nil, err
+				}
+				return idl.Variant{Name: f.Name, Value: v, Type: t}, nil
+			}
+			return nil, fmt.Errorf("unknown variant field: %s", n[0].Value())
+		}
+	case *idl.PrincipalType:
+		if n.Name == cvalue.Principal.Name {
+			return convertPrincipal(n.Children()[0])
+		}
+	case *idl.Service, idl.Service:
+		if n.Name == cvalue.Service.Name {
+			return convertPrincipal(n.Children()[0])
+		}
+	case *idl.FunctionType:
+		if n.Name == cvalue.Func.Name {
+			return convertFuncValue(n)
+		}
+	}
+	return nil, fmt.Errorf("can not convert %s to %s", n.Value(), typ)
+}
+
+// convertTypedRecord converts a record value into a value of the given record
+// type. Fields that are missing in the value have to be optional.
+func convertTypedRecord(t *idl.RecordType, n *parser.Node) (map[string]any, error) {
+	vs := make(map[uint32]*parser.Node)
+	var next uint32
+	for _, n := range n.Children() {
+		name, v := fieldValue(n, next)
+		id := fieldID(name)
+		if _, ok := vs[id]; ok {
+			return nil, fmt.Errorf("duplicate field: %s", name)
+		}
+		vs[id], next = v, id+1
+	}
+	args := make(map[string]any)
+	for _, f := range t.Fields {
+		v, ok := vs[fieldID(f.Name)]
+		if !ok {
+			switch f.Type.(type) {
+			case *idl.OptionalType, *idl.NullType, *idl.ReservedType:
+				args[f.Name] = nil
+				continue
+			default:
+				return nil, fmt.Errorf("missing field: %s", f.Name)
+			}
+		}
+		delete(vs, fieldID(f.Name))
+		arg, err := convertTypedValue(f.Type, v)
+		if err != nil {
+			return nil, err
+		}
+		args[f.Name] = arg
+	}
+	for id := range vs {
+		return nil, fmt.Errorf("unknown field: %d", id)
+	}
+	return args, nil
+}
+
 func convertNum(n *parser.Node) (idl.Type, any, error) {
 	switch n := n.Children(); len(n) {
 	case 1:
@@ -133,68 +316,225 @@ func convertNum(n *parser.Node) (idl.Type, any, error) {
 		}
 
 		// int
-		v := strings.ReplaceAll(n.Value(), "_", "")
-		i, err := strconv.ParseInt(v, 10, 64)
+		typ := new(idl.IntType)
+		v, err := convertNumValue(typ, n.Value())
 		if err != nil {
 			return nil, nil, err
 		}
-		return new(idl.IntType), idl.NewInt(i), nil
+		return typ, v, nil
 	case 2:
-		vArg := n[0].Value()
-		vType := n[1].Value()
-
-		// floats
-		if vType == "float32" || vType == "float64" {
-			v := strings.ReplaceAll(vArg, "_", "")
-			switch n := n[1]; n.Value() {
-			case "float32":
-				f, err := strconv.ParseFloat(v, 32)
-				if err != nil {
-					return nil, nil, err
-				}
-				return idl.Float32Type(), float32(f), nil
-			default:
-				f, err := strconv.ParseFloat(v, 64)
-				if err != nil {
-					return nil, nil, err
-				}
-				return idl.Float64Type(), f, nil
-			}
-		}
-
-		// ints
-		v := strings.ReplaceAll(vArg, "_", "")
-		i, err := strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			return nil, nil, err
-		}
-		switch vType {
+		var typ idl.Type
+		switch n[1].Value() {
 		case "nat":
-			bi := big.NewInt(i)
-			return new(idl.NatType), idl.NewBigNat(bi), nil
+			typ = new(idl.NatType)
 		case "nat8":
-			return idl.Nat8Type(), uint8(i), nil
+			typ = idl.Nat8Type()
 		case "nat16":
-			return idl.Nat16Type(), uint16(i), nil
+			typ = idl.Nat16Type()
 		case "nat32":
-			return idl.Nat32Type(), uint32(i), nil
+			typ = idl.Nat32Type()
 		case "nat64":
-			return idl.Nat64Type(), uint64(i), nil
+			typ = idl.Nat64Type()
 		case "int":
-			bi := big.NewInt(i)
-			return new(idl.IntType), idl.NewBigInt(bi), nil
+			typ = new(idl.IntType)
 		case "int8":
-			return idl.Int8Type(), int8(i), nil
+			typ = idl.Int8Type()
 		case "int16":
-			return idl.Int16Type(), int16(i), nil
+			typ = idl.Int16Type()
 		case "int32":
-			return idl.Int32Type(), int32(i), nil
+			typ = idl.Int32Type()
 		case "int64":
-			return idl.Int64Type(), i, nil
+			typ = idl.Int64Type()
+		case "float32":
+			typ = idl.Float32Type()
+		case "float64":
+			typ = idl.Float64Type()
 		default:
 			panic(n)
 		}
+		v, err := convertNumValue(typ, n[0].Value())
+		if err != nil {
+			return nil, nil, err
+		}
+		return typ, v, nil
 	default:
 		panic(n)
 	}
 }
+
+// convertNumValue converts a number, e.g. "-1_000", into a value of the given
+// number type.
+func convertNumValue(typ idl.Type, s string) (any, error) {
+	v := strings.ReplaceAll(s, "_", "")
+	switch t := typ.(type) {
+	case *idl.FloatType:
+		if t.Base() == 4 {
+			f, err := strconv.ParseFloat(v, 32)
+			if err != nil {
+				return nil, err
+			}
+			return float32(f), nil
+		}
+		return strconv.ParseFloat(v, 64)
+	case *idl.NatType:
+		if t.Base() == 0 {
+			bi, ok := new(big.Int).SetString(v, 10)
+			if !ok || bi.Sign() < 0 {
+				return nil, fmt.Errorf("invalid nat: %s", s)
+			}
+			return idl.NewBigNat(bi), nil
+		}
+		i, err := strconv.ParseUint(strings.TrimPrefix(v, "+"), 10, int(t.Base())*8)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Base() {
+		case 1:
+			return uint8(i), nil
+		case 2:
+			return uint16(i), nil
+		case 4:
+			return uint32(i), nil
+		default:
+			return i, nil
+		}
+	case *idl.IntType:
+		if t.Base() == 0 {
+			bi, ok := new(big.Int).SetString(v, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid int: %s", s)
+			}
+			return idl.NewBigInt(bi), nil
+		}
+		i, err := strconv.ParseInt(v, 10, int(t.Base())*8)
+		if err != nil {
+			return nil, err
+		}
+		switch t.Base() {
+		case 1:
+			return int8(i), nil
+		case 2:
+			return int16(i), nil
+		case 4:
+			return int32(i), nil
+		default:
+			return i, nil
+		}
+	default:
+		return nil, fmt.Errorf("invalid number type: %s", typ)
+	}
+}
+
+func convertText(n *parser.Node) (string, error) {
+	b, err := unescape(n)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("invalid utf8 text: %s", n.Value())
+	}
+	return string(b), nil
+}
+
+func convertPrincipal(n *parser.Node) (principal.Principal, error) {
+	s, err := convertText(n)
+	if err != nil {
+		return principal.Principal{}, err
+	}
+	return principal.Decode(s)
+}
+
+func convertFuncValue(n *parser.Node) (*idl.PrincipalMethod, error) {
+	p, err := convertPrincipal(n.Children()[0])
+	if err != nil {
+		return nil, err
+	}
+	method := n.Children()[1]
+	if method.Name == cvalue.TextValue.Name {
+		m, err := convertText(method)
+		if err != nil {
+			return nil, err
+		}
+		return &idl.PrincipalMethod{Principal: p, Method: m}, nil
+	}
+	return &idl.PrincipalMethod{Principal: p, Method: method.Value()}, nil
+}
+
+// fieldValue returns the name and the value of a record field. Fields without
+// a name get the given id, which is the id of the previous field plus one.
+func fieldValue(n *parser.Node, next uint32) (string, *parser.Node) {
+	if n := n.Children(); len(n) == 2 {
+		return fieldName(n[0]), n[1]
+	}
+	return strconv.FormatUint(uint64(next), 10), n.Children()[0]
+}
+
+// fieldName returns the name of a field, numeric ids are returned without
+// underscores, e.g. "1_000" becomes "1000".
+func fieldName(n *parser.Node) string {
+	name := n.Value()
+	if id := strings.ReplaceAll(name, "_", ""); isNumeric(id) {
+		if i, err := strconv.ParseUint(id, 10, 32); err == nil {
+			return strconv.FormatUint(i, 10)
+		}
+	}
+	return name
+}
+
+// fieldID returns the id of the field with the given name, which is either a
+// number or a name that is hashed.
+func fieldID(name string) uint32 {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id)
+	}
+	return uint32(idl.Hash(name).Uint64())
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || '9' < c {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// unescape resolves the escape sequences of a quoted text value: \n, \r, \t,
+// \\, \", \', \xx and \u{x}.
+func unescape(n *parser.Node) ([]byte, error) {
+	s := strings.TrimSuffix(strings.TrimPrefix(n.Value(), "\""), "\"")
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case '\\', '"', '\'':
+			b = append(b, c)
+		case 'u':
+			end := strings.IndexByte(s[i:], '}')
+			r, err := strconv.ParseUint(strings.ReplaceAll(s[i+2:i+end], "_", ""), 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return nil, fmt.Errorf("invalid unicode escape: %s", s[i-1:i+end+1])
+			}
+			b = utf8.AppendRune(b, rune(r))
+			i += end
+		default:
+			h, err := strconv.ParseUint(s[i:i+2], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid escape sequence: %s", s[i-1:i+2])
+			}
+			b = append(b, byte(h))
+			i++
+		}
+	}
+	return b, nil
+}
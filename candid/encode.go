@@ -18,7 +18,7 @@ func Encode(argumentTypes []idl.Type, arguments []any) ([]byte, error) {
 		Indexes: make(map[string]int),
 	}
 	for _, t := range argumentTypes {
-		if err := t.AddTypeDefinition(tdt); err != nil {
+		if err := tdt.AddType(t); err != nil {
 			return nil, err
 		}
 	}
@@ -42,7 +42,7 @@ func Encode(argumentTypes []idl.Type, arguments []any) ([]byte, error) {
 	)
 	for i, t := range argumentTypes {
 		{ // I
-			t, err := t.EncodeType(tdt)
+			t, err := tdt.EncodeType(t)
 			if err != nil {
 				return nil, err
 			}
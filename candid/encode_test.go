@@ -66,6 +66,39 @@ func TestRecordTupleFields(t *testing.T) {
 	}
 }
 
+func TestRecordNumericFields(t *testing.T) {
+	// Fields named by a number have that number as id, e.g. the header fields
+	// of the HTTP gateway: record { text; text }.
+	type T struct {
+		Field0 string `ic:"0"`
+		Field1 string `ic:"1"`
+	}
+	raw, err := Marshal([]any{
+		T{
+			Field0: "hello",
+			Field1: "world",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := hex.DecodeString("4449444c016c020071017101000568656c6c6f05776f726c64")
+	if !bytes.Equal(raw, expected) {
+		t.Fatalf("expected %x, got %x", expected, raw)
+	}
+	// Values returned by Decode can be encoded again.
+	ts, vs, err := Decode(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err = Encode(ts, vs); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, expected) {
+		t.Fatalf("expected %x, got %x", expected, raw)
+	}
+}
+
 func TestVariantType_default(t *testing.T) {
 	type V = struct {
 		A *idl.Null `ic:"A,variant"`
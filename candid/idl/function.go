@@ -3,8 +3,10 @@ package idl
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math/big"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/niccolofant/agent-go/leb128"
 	"github.com/niccolofant/agent-go/principal"
@@ -17,7 +19,7 @@ func encodeTypes(ts []Type, tdt *TypeDefinitionTable) ([]byte, error) {
 	}
 	var vs []byte
 	for _, t := range ts {
-		v, err := t.EncodeType(tdt)
+		v, err := tdt.EncodeType(t)
 		if err != nil {
 			return nil, err
 		}
@@ -52,12 +54,12 @@ func NewFunctionType(argumentTypes []FunctionParameter, returnTypes []FunctionPa
 
 func (f FunctionType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 	for _, t := range f.ArgumentParameters {
-		if err := t.Type.AddTypeDefinition(tdt); err != nil {
+		if err := tdt.AddType(t.Type); err != nil {
 			return err
 		}
 	}
 	for _, t := range f.ReturnParameters {
-		if err := t.Type.AddTypeDefinition(tdt); err != nil {
+		if err := tdt.AddType(t.Type); err != nil {
 			return err
 		}
 	}
@@ -82,9 +84,11 @@ func (f FunctionType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 	for _, t := range f.Annotations {
 		switch t {
 		case "query":
-			vs = []byte{0x01}
+			vs = append(vs, 0x01)
 		case "oneway":
-			vs = []byte{0x02}
+			vs = append(vs, 0x02)
+		case "composite_query":
+			vs = append(vs, 0x03)
 		default:
 			return fmt.Errorf("invalid function annotation: %s", t)
 		}
@@ -109,7 +113,7 @@ func (f FunctionType) Decode(r *bytes.Reader) (any, error) {
 	}
 	pid := make([]byte, l)
 	{
-		n, err := r.Read(pid)
+		n, err := io.ReadFull(r, pid)
 		if err != nil {
 			return nil, err
 		}
@@ -123,7 +127,7 @@ func (f FunctionType) Decode(r *bytes.Reader) (any, error) {
 	}
 	m := make([]byte, ml)
 	{
-		n, err := r.Read(m)
+		n, err := io.ReadFull(r, m)
 		if err != nil {
 			return nil, err
 		}
@@ -131,6 +135,9 @@ func (f FunctionType) Decode(r *bytes.Reader) (any, error) {
 			return nil, fmt.Errorf("invalid method: %s", m)
 		}
 	}
+	if !utf8.Valid(m) {
+		return nil, fmt.Errorf("invalid utf8 method: %s", m)
+	}
 	return &PrincipalMethod{
 		Principal: principal.Principal{Raw: pid},
 		Method:    string(m),
@@ -184,7 +191,7 @@ func (f FunctionType) Read(r *bytes.Reader) ([]byte, error) {
 	}
 	pid := make([]byte, l)
 	{
-		n, err := r.Read(pid)
+		n, err := io.ReadFull(r, pid)
 		if err != nil {
 			return nil, err
 		}
@@ -206,7 +213,7 @@ func (f FunctionType) Read(r *bytes.Reader) ([]byte, error) {
 	}
 	m := make([]byte, ml)
 	{
-		n, err := r.Read(m)
+		n, err := io.ReadFull(r, m)
 		if err != nil {
 			return nil, err
 		}
@@ -214,6 +221,9 @@ func (f FunctionType) Read(r *bytes.Reader) ([]byte, error) {
 			return nil, fmt.Errorf("invalid method: %s", m)
 		}
 	}
+	if !utf8.Valid(m) {
+		return nil, fmt.Errorf("invalid utf8 method: %s", m)
+	}
 	return concat(bs, raw, pid, rawl, m), nil
 }
 
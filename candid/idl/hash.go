@@ -15,6 +15,15 @@ func HashString(s string) string {
 	return strconv.FormatUint(uint64(hashUint32(s)), 10)
 }
 
+// fieldID returns the id of the field with the given name, which is either a
+// number, e.g. "0" for the first field of a tuple, or a name that is hashed.
+func fieldID(name string) uint32 {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id)
+	}
+	return hashUint32(name)
+}
+
 func hashUint32(s string) uint32 {
 	var hash uint32
 	for i := 0; i < len(s); i++ {
@@ -352,12 +352,17 @@ func (n NatType) UnmarshalGo(raw any, _v any) error {
 		if !ok {
 			return NewUnmarshalGoError(raw, _v)
 		}
-		v, ok := _v.(*Nat)
-		if !ok {
+		switch v := _v.(type) {
+		case *Nat:
+			*v = n
+			return nil
+		case *Int:
+			// nat <: int
+			*v = NewBigInt(n.BigInt())
+			return nil
+		default:
 			return NewUnmarshalGoError(raw, _v)
 		}
-		*v = n
-		return nil
 	case 8:
 		u64, ok := anyToUint64(raw)
 		if !ok {
@@ -96,6 +96,15 @@ func TestNatType_UnmarshalGo(t *testing.T) {
 			}
 		}
 
+		// nat <: int
+		var i idl.Int
+		if err := idl.UnmarshalGo(nt, idl.NewNat(uint(42)), &i); err != nil {
+			t.Fatal(err)
+		}
+		if i.BigInt().Int64() != 42 {
+			t.Error(i)
+		}
+
 		var a any
 		expectErr(t, idl.UnmarshalGo(nt, 0, &a))
 	})
@@ -2,6 +2,7 @@ package idl
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -28,7 +29,7 @@ func NewOptionalType(t Type) *OptionalType {
 
 // AddTypeDefinition adds the type definition to the table.
 func (o OptionalType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
-	if err := o.Type.AddTypeDefinition(tdt); err != nil {
+	if err := tdt.AddType(o.Type); err != nil {
 		return err
 	}
 
@@ -36,7 +37,7 @@ func (o OptionalType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 	if err != nil {
 		return err
 	}
-	v, err := o.Type.EncodeType(tdt)
+	v, err := tdt.EncodeType(o.Type)
 	if err != nil {
 		return err
 	}
@@ -45,6 +46,8 @@ func (o OptionalType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 }
 
 // Decode decodes the value from the given reader into either `nil` or a value (of the subtype of the optional type).
+// If null is a value of the subtype, e.g. `opt null`, the value is returned as a pointer (`*any`), so that it is not
+// mistaken for `nil`.
 func (o OptionalType) Decode(r *bytes.Reader) (any, error) {
 	b, err := r.ReadByte()
 	if err != nil {
@@ -54,7 +57,14 @@ func (o OptionalType) Decode(r *bytes.Reader) (any, error) {
 	case 0x00:
 		return nil, nil
 	case 0x01:
-		return o.Type.Decode(r)
+		v, err := o.Type.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		if ContainsNull(o.Type) {
+			return &v, nil
+		}
+		return v, nil
 	default:
 		return nil, fmt.Errorf("invalid option value: %x", b)
 	}
@@ -75,11 +85,13 @@ func (o OptionalType) EncodeValue(v any) ([]byte, error) {
 	if v == nil {
 		return []byte{0x00}, nil
 	}
-	if v := reflect.ValueOf(v); v.Kind() == reflect.Pointer {
-		if v.IsNil() {
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
 			return []byte{0x00}, nil
 		}
-		return o.EncodeValue(v.Elem().Interface())
+		// The pointer is the optional value, so that the value of a nested
+		// optional type can be null, e.g. `opt opt nat`.
+		v = rv.Elem().Interface()
 	}
 	v_, err := o.Type.EncodeValue(v)
 	if err != nil {
@@ -107,6 +119,12 @@ func (o OptionalType) Read(r *bytes.Reader) ([]byte, error) {
 	}
 }
 
+// ContainsNull reports whether null is a value of type t, i.e. whether t is
+// opt, null or reserved.
+func ContainsNull(t Type) bool {
+	return isOptionalField(t)
+}
+
 // String returns the string representation of the type.
 func (o OptionalType) String() string {
 	return fmt.Sprintf("opt %s", o.Type)
@@ -117,18 +135,27 @@ func (o OptionalType) UnmarshalGo(raw any, _v any) error {
 		// Optional value is `nil`.
 		return nil
 	}
+	if v, ok := raw.(*any); ok && ContainsNull(o.Type) {
+		// As returned by Decode.
+		raw = *v
+	}
 	if v := reflect.ValueOf(_v); v.Kind() == reflect.Pointer {
 		v := v.Elem() // Dereference the pointer.
 		if k := v.Kind(); k != reflect.Pointer {
 			return NewUnmarshalGoError(raw, _v)
 		}
-		if !v.IsNil() {
-			// No need to allocate a new pointer.
-			return UnmarshalGo(o.Type, raw, v.Interface())
+		ptr := v
+		if v.IsNil() {
+			ptr = reflect.New(v.Type().Elem()) // Create a new pointer.
 		}
-		ptr := reflect.New(v.Type().Elem()) // Create a new pointer.
 		if err := UnmarshalGo(o.Type, raw, ptr.Interface()); err != nil {
-			return err
+			var unmarshalGoError *UnmarshalGoError
+			if !errors.As(err, &unmarshalGoError) {
+				return err
+			}
+			// Values that do not match the optional value become null.
+			v.Set(reflect.Zero(v.Type()))
+			return nil
 		}
 		v.Set(ptr)
 		return nil
@@ -7,7 +7,7 @@ import (
 	"github.com/niccolofant/agent-go/candid/idl"
 )
 
-func ExampleOpt() {
+func ExampleOptionalType() {
 	var optNat = idl.NewOptionalType(new(idl.NatType))
 	test([]idl.Type{optNat}, []any{nil})
 	test([]idl.Type{optNat}, []any{idl.NewNat(uint(1))})
@@ -16,7 +16,7 @@ func ExampleOpt() {
 	// 4449444c016e7d01000101
 }
 
-func ExampleOpt_blob() {
+func ExampleOptionalType_blob() {
 	var optNatArray = idl.NewOptionalType(idl.VectorType{Type: idl.Nat8Type()})
 	test([]idl.Type{optNatArray}, []any{nil})
 	test([]idl.Type{optNatArray}, []any{[]byte{0x00}})
@@ -25,6 +25,19 @@ func ExampleOpt_blob() {
 	// 4449444c026d7b6e000101010100
 }
 
+func ExampleOptionalType_nested() {
+	var optOptNat = idl.NewOptionalType(idl.NewOptionalType(new(idl.NatType)))
+	var none *idl.Nat
+	one := new(idl.NewNat(uint(1)))
+	test_([]idl.Type{optOptNat}, []any{nil})
+	test_([]idl.Type{optOptNat}, []any{&none})
+	test_([]idl.Type{optOptNat}, []any{&one})
+	// Output:
+	// 4449444c026e7d6e00010100
+	// 4449444c026e7d6e0001010100
+	// 4449444c026e7d6e000101010101
+}
+
 func TestOptionalType_UnmarshalGo(t *testing.T) {
 	if err := idl.UnmarshalGo(idl.OptionalType{
 		Type: new(idl.NullType),
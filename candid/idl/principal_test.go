@@ -42,3 +42,28 @@ func TestPrincipalType_UnmarshalGo(t *testing.T) {
 		}
 	}
 }
+
+func TestPrincipalType_Read(t *testing.T) {
+	for _, p := range []principal.Principal{principal.AnonymousID, {Raw: []byte{}}} {
+		bs, err := idl.PrincipalType{}.EncodeValue(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bytes.NewReader(append(bs, 0xff))
+		raw, err := idl.PrincipalType{}.Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, bs) || r.Len() != 1 {
+			t.Errorf("got %x, want %x", raw, bs)
+		}
+	}
+}
+
+func TestPrincipalType_Decode_overshoot(t *testing.T) {
+	// The length is 4 GiB, while only 3 bytes remain.
+	r := bytes.NewReader([]byte{0x01, 0x80, 0x80, 0x80, 0x80, 0x10, 0xca, 0xff, 0xee})
+	if _, err := (idl.PrincipalType{}).Decode(r); err == nil {
+		t.Fatal("expected error")
+	}
+}
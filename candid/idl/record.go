@@ -46,14 +46,14 @@ func NewRecordType(fields map[string]Type) *RecordType {
 		})
 	}
 	sort.Slice(rec.Fields, func(i, j int) bool {
-		return Hash(rec.Fields[i].Name).Cmp(Hash(rec.Fields[j].Name)) < 0
+		return fieldID(rec.Fields[i].Name) < fieldID(rec.Fields[j].Name)
 	})
 	return &rec
 }
 
 func (record RecordType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 	for _, f := range record.Fields {
-		if err := f.Type.AddTypeDefinition(tdt); err != nil {
+		if err := tdt.AddType(f.Type); err != nil {
 			return err
 		}
 	}
@@ -72,13 +72,13 @@ func (record RecordType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 		if record.IsTuple {
 			h = big.NewInt(int64(i))
 		} else {
-			h = Hash(f.Name)
+			h = new(big.Int).SetUint64(uint64(fieldID(f.Name)))
 		}
 		l, err := leb128.EncodeUnsigned(h)
 		if err != nil {
 			return nil
 		}
-		t, err := f.Type.EncodeType(tdt)
+		t, err := tdt.EncodeType(f.Type)
 		if err != nil {
 			return nil
 		}
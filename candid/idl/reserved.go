@@ -33,5 +33,9 @@ func (ReservedType) String() string {
 }
 
 func (ReservedType) UnmarshalGo(raw any, _v any) error {
+	// Any value can be decoded as reserved.
+	if _, ok := _v.(*Reserved); ok {
+		return nil
+	}
 	return NewUnmarshalGoError(raw, _v)
 }
@@ -3,6 +3,7 @@ package idl
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math/big"
 	"sort"
 	"strings"
@@ -36,7 +37,7 @@ func NewServiceType(methods map[string]*FunctionType) *Service {
 
 func (s Service) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 	for _, f := range s.Methods {
-		if err := f.Func.AddTypeDefinition(tdt); err != nil {
+		if err := tdt.AddType(f.Func); err != nil {
 			return err
 		}
 	}
@@ -56,7 +57,7 @@ func (s Service) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 		if err != nil {
 			return nil
 		}
-		t, err := f.Func.EncodeType(tdt)
+		t, err := tdt.EncodeType(f.Func)
 		if err != nil {
 			return nil
 		}
@@ -83,7 +84,7 @@ func (s Service) Decode(r *bytes.Reader) (any, error) {
 		return nil, err
 	}
 	pid := make([]byte, l)
-	n, err := r.Read(pid)
+	n, err := io.ReadFull(r, pid)
 	if err != nil {
 		return nil, err
 	}
@@ -102,6 +103,10 @@ func (s Service) EncodeType(tdt *TypeDefinitionTable) ([]byte, error) {
 }
 
 func (s Service) EncodeValue(v any) ([]byte, error) {
+	if p, ok := v.(*principal.Principal); ok && p != nil {
+		// As returned by Decode.
+		v = *p
+	}
 	p, ok := v.(principal.Principal)
 	if !ok {
 		return nil, NewEncodeValueError(v, ServiceOpCode)
@@ -135,7 +140,7 @@ func (s Service) Read(r *bytes.Reader) ([]byte, error) {
 	}
 	pid := make([]byte, l)
 	{
-		n, err := r.Read(pid)
+		n, err := io.ReadFull(r, pid)
 		if err != nil {
 			return nil, err
 		}
@@ -155,5 +160,19 @@ func (s Service) String() string {
 }
 
 func (Service) UnmarshalGo(raw any, _v any) error {
+	v, ok := _v.(*principal.Principal)
+	if !ok {
+		return NewUnmarshalGoError(raw, _v)
+	}
+	switch p := raw.(type) {
+	case principal.Principal:
+		*v = p
+		return nil
+	case *principal.Principal:
+		if p != nil {
+			*v = *p
+			return nil
+		}
+	}
 	return NewUnmarshalGoError(raw, _v)
 }
@@ -0,0 +1,322 @@
+package idl
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// IsSubtype reports whether t1 is a subtype of t2, i.e. whether a value of
+// type t1 can be decoded as a value of type t2, according to the subtyping
+// rules of the Candid specification:
+//   - every type is a subtype of reserved, empty is a subtype of every type.
+//   - nat is a subtype of int.
+//   - a record is a subtype of a record with fewer fields, or with additional
+//     fields of type opt, null or reserved.
+//   - a variant is a subtype of a variant with additional tags.
+//   - every type is a subtype of opt t, values that do not match t are decoded
+//     as null.
+//   - a function is a subtype of a function with the same annotations, if its
+//     arguments are supertypes and its results are subtypes.
+//   - a service is a subtype of a service with fewer methods.
+//
+// Recursive types are compared coinductively.
+func IsSubtype(t1, t2 Type) bool {
+	return CheckSubtype(t1, t2) == nil
+}
+
+// SubtypeError is returned by CheckSubtype if a type is not a subtype of
+// another type.
+type SubtypeError struct {
+	// Path is the location of the mismatch within the types, e.g.
+	// "args[0].owner", or empty if the types themselves do not match.
+	Path string
+	// Description describes the mismatch.
+	Description string
+}
+
+func (e SubtypeError) Error() string {
+	if e.Path == "" {
+		return e.Description
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Description)
+}
+
+// CheckSubtype returns a *SubtypeError describing where t1 is not a subtype of
+// t2, or nil if it is. See IsSubtype for the subtyping rules.
+func CheckSubtype(t1, t2 Type) error {
+	if err := checkSubtype(t1, t2, "", newSubtypeState()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// OptionalCoercions returns where t1 is only a subtype of t2 by the special opt
+// rule, i.e. where values of type t1 are decoded as null because they do not
+// match the type of an opt in t2, e.g. "opt nat" and "opt text". These changes
+// do not fail to decode, but lose data. The result is only meaningful if t1 is
+// a subtype of t2.
+func OptionalCoercions(t1, t2 Type) []SubtypeError {
+	s := newSubtypeState()
+	checkSubtype(t1, t2, "", s)
+	return s.coercions
+}
+
+// subtypeState is the state of a subtype check.
+type subtypeState struct {
+	// seen are the pairs of types that are being compared, to compare
+	// recursive types coinductively.
+	seen map[[2]uintptr]bool
+	// coercions are the mismatches that were accepted by the special opt rule.
+	coercions []SubtypeError
+}
+
+func newSubtypeState() *subtypeState {
+	return &subtypeState{seen: make(map[[2]uintptr]bool)}
+}
+
+func checkSubtype(t1, t2 Type, path string, s *subtypeState) *SubtypeError {
+	if key, ok := subtypeKey(t1, t2); ok {
+		if s.seen[key] {
+			return nil
+		}
+		s.seen[key] = true
+		defer delete(s.seen, key)
+	}
+
+	t1, t2 = derefType(t1), derefType(t2)
+	if _, ok := t2.(ReservedType); ok {
+		return nil
+	}
+	if _, ok := t1.(EmptyType); ok {
+		return nil
+	}
+	if o, ok := t2.(OptionalType); ok {
+		// The special opt rule: if the value does not match, it becomes null.
+		return s.checkOptional(t1, o, path)
+	}
+
+	mismatch := &SubtypeError{
+		Path:        path,
+		Description: fmt.Sprintf("%s is not a subtype of %s", typeName(t1), typeName(t2)),
+	}
+	switch t2 := t2.(type) {
+	case NullType, BoolType, TextType, PrincipalType:
+		if reflect.TypeOf(t1) == reflect.TypeOf(t2) {
+			return nil
+		}
+	case NatType:
+		if n, ok := t1.(NatType); ok && n.size == t2.size {
+			return nil
+		}
+	case IntType:
+		switch t1 := t1.(type) {
+		case IntType:
+			if t1.size == t2.size {
+				return nil
+			}
+		case NatType:
+			if t1.size == 0 && t2.size == 0 {
+				return nil
+			}
+		}
+	case FloatType:
+		if f, ok := t1.(FloatType); ok && f.size == t2.size {
+			return nil
+		}
+	case VectorType:
+		if v, ok := t1.(VectorType); ok {
+			return checkSubtype(v.Type, t2.Type, path+"[]", s)
+		}
+	case RecordType:
+		if r, ok := t1.(RecordType); ok {
+			return checkFieldsSubtype(recordFields(r), recordFields(t2), path, "", s)
+		}
+	case VariantType:
+		if v, ok := t1.(VariantType); ok {
+			expected := recordFields(RecordType{Fields: t2.Fields})
+			for _, f := range recordFields(RecordType{Fields: v.Fields}) {
+				i := slices.IndexFunc(expected, func(e field) bool { return e.id == f.id })
+				if i < 0 {
+					return &SubtypeError{Path: path, Description: fmt.Sprintf("unexpected tag %s", f.name)}
+				}
+				if err := checkSubtype(f.typ, expected[i].typ, joinPath(path, f.name), s); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case FunctionType:
+		if f, ok := t1.(FunctionType); ok {
+			return checkFunctionSubtype(f, t2, path, s)
+		}
+	case Service:
+		if svc, ok := t1.(Service); ok {
+			for _, m2 := range t2.Methods {
+				i := slices.IndexFunc(svc.Methods, func(m Method) bool { return m.Name == m2.Name })
+				if i < 0 {
+					return &SubtypeError{Path: path, Description: fmt.Sprintf("missing method %s", m2.Name)}
+				}
+				if err := checkSubtype(svc.Methods[i].Func, m2.Func, joinPath(path, m2.Name), s); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case FutureType:
+		if f, ok := t1.(FutureType); ok && f.OpCode == t2.OpCode {
+			return nil
+		}
+	}
+	return mismatch
+}
+
+// checkOptional checks whether t1 is a subtype of the type of the opt t2, and
+// records a coercion if it is not. It never fails.
+func (s *subtypeState) checkOptional(t1 Type, t2 OptionalType, path string) *SubtypeError {
+	switch t := t1.(type) {
+	case NullType:
+		return nil
+	case OptionalType:
+		t1 = t.Type
+	}
+	n := len(s.coercions)
+	if err := checkSubtype(t1, t2.Type, path, s); err != nil {
+		// The coercions within the value that becomes null do not matter.
+		s.coercions = append(s.coercions[:n], SubtypeError{
+			Path:        err.Path,
+			Description: err.Description + ", the value is decoded as null",
+		})
+	}
+	return nil
+}
+
+// checkFieldsSubtype checks whether a record with fields fs1 is a subtype of a
+// record with fields fs2. The prefix is prepended to the field names.
+func checkFieldsSubtype(fs1, fs2 []field, path, prefix string, s *subtypeState) *SubtypeError {
+	for _, f2 := range fs2 {
+		i := slices.IndexFunc(fs1, func(f field) bool { return f.id == f2.id })
+		if i < 0 {
+			if !isOptionalField(f2.typ) {
+				return &SubtypeError{
+					Path:        path,
+					Description: fmt.Sprintf("%s%s of type %s is missing", prefix, f2.name, typeName(f2.typ)),
+				}
+			}
+			continue
+		}
+		if err := checkSubtype(fs1[i].typ, f2.typ, joinPath(path, prefix+f2.name), s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFunctionSubtype(f1, f2 FunctionType, path string, s *subtypeState) *SubtypeError {
+	a1, a2 := slices.Clone(f1.Annotations), slices.Clone(f2.Annotations)
+	slices.Sort(a1)
+	slices.Sort(a2)
+	if !slices.Equal(a1, a2) {
+		return &SubtypeError{
+			Path:        path,
+			Description: fmt.Sprintf("annotations %v and %v differ", a1, a2),
+		}
+	}
+	// Arguments are contravariant, results are covariant.
+	if err := checkFieldsSubtype(parameters(f2.ArgumentParameters), parameters(f1.ArgumentParameters), path, "args", s); err != nil {
+		return err
+	}
+	return checkFieldsSubtype(parameters(f1.ReturnParameters), parameters(f2.ReturnParameters), path, "results", s)
+}
+
+// field is a field of a record or variant, or a parameter of a function.
+type field struct {
+	id   uint32
+	name string
+	typ  Type
+}
+
+// isOptionalField reports whether a record field of the given type may be
+// missing, i.e. whether it is of type opt, null or reserved.
+func isOptionalField(t Type) bool {
+	switch derefType(t).(type) {
+	case OptionalType, NullType, ReservedType:
+		return true
+	default:
+		return false
+	}
+}
+
+// recordFields returns the fields of the record with their ids.
+func recordFields(record RecordType) []field {
+	fields := make([]field, len(record.Fields))
+	for i, f := range record.Fields {
+		if record.IsTuple {
+			fields[i] = field{id: uint32(i), name: strconv.Itoa(i), typ: f.Type}
+			continue
+		}
+		fields[i] = field{id: fieldID(f.Name), name: f.Name, typ: f.Type}
+	}
+	return fields
+}
+
+// parameters returns the parameters as fields, by their position.
+func parameters(parameters []FunctionParameter) []field {
+	fields := make([]field, len(parameters))
+	for i, p := range parameters {
+		fields[i] = field{id: uint32(i), name: fmt.Sprintf("[%d]", i), typ: p.Type}
+	}
+	return fields
+}
+
+// joinPath appends the name of a field to the path.
+func joinPath(path, name string) string {
+	if path == "" || strings.HasPrefix(name, "[") {
+		return path + name
+	}
+	return path + "." + name
+}
+
+// typeName returns the name of the type, without the types it contains.
+func typeName(t Type) string {
+	switch derefType(t).(type) {
+	case RecordType:
+		return "record"
+	case VariantType:
+		return "variant"
+	case VectorType:
+		return "vec"
+	case OptionalType:
+		return "opt"
+	case FunctionType:
+		return "func"
+	case Service:
+		return "service"
+	default:
+		return t.String()
+	}
+}
+
+// derefType returns the type that a pointer to a type points to.
+func derefType(t Type) Type {
+	v := reflect.ValueOf(t)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return t
+	}
+	if t, ok := v.Elem().Interface().(Type); ok {
+		return t
+	}
+	return t
+}
+
+// subtypeKey returns a key for a pair of pointer types, which is used to
+// detect recursion.
+func subtypeKey(t1, t2 Type) ([2]uintptr, bool) {
+	v1, v2 := reflect.ValueOf(t1), reflect.ValueOf(t2)
+	if v1.Kind() != reflect.Pointer || v2.Kind() != reflect.Pointer {
+		return [2]uintptr{}, false
+	}
+	return [2]uintptr{v1.Pointer(), v2.Pointer()}, true
+}
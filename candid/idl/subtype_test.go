@@ -0,0 +1,215 @@
+package idl_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/niccolofant/agent-go/candid/idl"
+)
+
+func TestIsSubtype(t *testing.T) {
+	text := new(idl.TextType)
+	nat := new(idl.NatType)
+	integer := new(idl.IntType)
+
+	tree := &idl.RecordType{}
+	tree.Fields = []idl.FieldType{
+		{Name: "children", Type: idl.NewVectorType(tree)},
+		{Name: "value", Type: nat},
+	}
+	intTree := &idl.RecordType{}
+	intTree.Fields = []idl.FieldType{
+		{Name: "children", Type: idl.NewVectorType(intTree)},
+		{Name: "value", Type: integer},
+	}
+	textTree := &idl.RecordType{}
+	textTree.Fields = []idl.FieldType{
+		{Name: "children", Type: idl.NewVectorType(textTree)},
+		{Name: "value", Type: text},
+	}
+
+	query := idl.NewFunctionType(
+		[]idl.FunctionParameter{{Type: integer}},
+		[]idl.FunctionParameter{{Type: nat}},
+		[]string{"query"},
+	)
+
+	for _, test := range []struct {
+		name   string
+		t1, t2 idl.Type
+		want   bool
+	}{
+		{"nat <: int", nat, integer, true},
+		{"int </: nat", integer, nat, false},
+		{"nat8 </: nat", idl.Nat8Type(), nat, false},
+		{"nat8 <: nat8", idl.Nat8Type(), idl.Nat8Type(), true},
+		{"float32 </: float64", idl.Float32Type(), idl.Float64Type(), false},
+		{"text <: reserved", text, new(idl.ReservedType), true},
+		{"empty <: text", new(idl.EmptyType), text, true},
+		{"text </: empty", text, new(idl.EmptyType), false},
+		{"null <: opt nat", new(idl.NullType), idl.NewOptionalType(nat), true},
+		{"text <: opt nat", text, idl.NewOptionalType(nat), true},
+		{"opt nat </: nat", idl.NewOptionalType(nat), nat, false},
+		{"vec nat <: vec int", idl.NewVectorType(nat), idl.NewVectorType(integer), true},
+		{"vec int </: vec nat", idl.NewVectorType(integer), idl.NewVectorType(nat), false},
+		{
+			"record width",
+			idl.NewRecordType(map[string]idl.Type{"a": nat, "b": text}),
+			idl.NewRecordType(map[string]idl.Type{"a": integer}),
+			true,
+		},
+		{
+			"record missing opt field",
+			idl.NewRecordType(map[string]idl.Type{"a": nat}),
+			idl.NewRecordType(map[string]idl.Type{"a": nat, "b": idl.NewOptionalType(text)}),
+			true,
+		},
+		{
+			"record missing field",
+			idl.NewRecordType(map[string]idl.Type{"a": nat}),
+			idl.NewRecordType(map[string]idl.Type{"a": nat, "b": text}),
+			false,
+		},
+		{
+			"record field ids",
+			&idl.RecordType{Fields: []idl.FieldType{{Name: idl.HashString("a"), Type: nat}}},
+			idl.NewRecordType(map[string]idl.Type{"a": nat}),
+			true,
+		},
+		{
+			"tuple",
+			idl.NewTupleType(map[string]idl.Type{"0": nat, "1": text}),
+			&idl.RecordType{Fields: []idl.FieldType{{Name: "0", Type: integer}}},
+			true,
+		},
+		{
+			"variant narrowing",
+			idl.NewVariantType(map[string]idl.Type{"a": nat}),
+			idl.NewVariantType(map[string]idl.Type{"a": integer, "b": text}),
+			true,
+		},
+		{
+			"variant widening",
+			idl.NewVariantType(map[string]idl.Type{"a": nat, "b": text}),
+			idl.NewVariantType(map[string]idl.Type{"a": nat}),
+			false,
+		},
+		{"recursive", tree, intTree, true},
+		{"recursive mismatch", tree, textTree, false},
+		{
+			"func",
+			query,
+			idl.NewFunctionType(
+				[]idl.FunctionParameter{{Type: nat}, {Type: idl.NewOptionalType(text)}},
+				[]idl.FunctionParameter{{Type: integer}},
+				[]string{"query"},
+			),
+			true,
+		},
+		{
+			"func arguments",
+			query,
+			idl.NewFunctionType(
+				[]idl.FunctionParameter{{Type: text}},
+				[]idl.FunctionParameter{{Type: integer}},
+				[]string{"query"},
+			),
+			false,
+		},
+		{
+			"func annotations",
+			query,
+			idl.NewFunctionType(
+				[]idl.FunctionParameter{{Type: integer}},
+				[]idl.FunctionParameter{{Type: nat}},
+				nil,
+			),
+			false,
+		},
+		{
+			"service",
+			idl.NewServiceType(map[string]*idl.FunctionType{"get": query, "put": query}),
+			idl.NewServiceType(map[string]*idl.FunctionType{"get": query}),
+			true,
+		},
+		{
+			"service missing method",
+			idl.NewServiceType(map[string]*idl.FunctionType{"get": query}),
+			idl.NewServiceType(map[string]*idl.FunctionType{"get": query, "put": query}),
+			false,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := idl.IsSubtype(test.t1, test.t2); got != test.want {
+				t.Errorf("IsSubtype(%s, %s) = %v, want %v", test.t1, test.t2, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckSubtype(t *testing.T) {
+	nat := new(idl.NatType)
+	text := new(idl.TextType)
+	account := idl.NewRecordType(map[string]idl.Type{"owner": nat})
+	f1 := idl.NewFunctionType(
+		[]idl.FunctionParameter{{Type: idl.NewVectorType(account)}},
+		nil,
+		nil,
+	)
+	f2 := idl.NewFunctionType(
+		[]idl.FunctionParameter{{Type: idl.NewVectorType(idl.NewRecordType(map[string]idl.Type{"owner": text}))}},
+		nil,
+		nil,
+	)
+	err := idl.CheckSubtype(f1, f2)
+	var subtypeError *idl.SubtypeError
+	if !errors.As(err, &subtypeError) {
+		t.Fatalf("expected SubtypeError, got %v", err)
+	}
+	if want := "args[0][].owner: text is not a subtype of nat"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if err := idl.CheckSubtype(f1, f1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOptionalCoercions(t *testing.T) {
+	nat := new(idl.NatType)
+	text := new(idl.TextType)
+	for _, test := range []struct {
+		t1, t2 idl.Type
+		want   []string
+	}{
+		{idl.NewOptionalType(nat), idl.NewOptionalType(nat), nil},
+		{nat, idl.NewOptionalType(nat), nil},
+		{new(idl.NullType), idl.NewOptionalType(text), nil},
+		{
+			idl.NewOptionalType(nat),
+			idl.NewOptionalType(text),
+			[]string{"nat is not a subtype of text, the value is decoded as null"},
+		},
+		{
+			idl.NewRecordType(map[string]idl.Type{"a": idl.NewOptionalType(nat), "b": new(idl.ReservedType)}),
+			idl.NewRecordType(map[string]idl.Type{"a": idl.NewOptionalType(text), "b": idl.NewOptionalType(nat)}),
+			[]string{
+				"a: nat is not a subtype of text, the value is decoded as null",
+				"b: reserved is not a subtype of nat, the value is decoded as null",
+			},
+		},
+	} {
+		var got []string
+		for _, coercion := range idl.OptionalCoercions(test.t1, test.t2) {
+			got = append(got, coercion.Error())
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s <: %s: got %q, want %q", test.t1, test.t2, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s <: %s: got %q, want %q", test.t1, test.t2, got[i], test.want[i])
+			}
+		}
+	}
+}
@@ -1,23 +1,102 @@
 package idl
 
 import (
+	"math/big"
+	"reflect"
 	"slices"
+
+	"github.com/niccolofant/agent-go/leb128"
 )
 
 type TypeDefinitionTable struct {
 	Types   [][]byte
 	Indexes map[string]int
+
+	// refs contains the indexes of the types that are referred to by pointer,
+	// or -1 if their definitions are being added. Recursive types refer to
+	// themselves through pointers.
+	refs map[uintptr]int
+	// adding is the stack of the pointers of the types of which the
+	// definitions are being added, or 0 for types that are not pointers.
+	adding []uintptr
+}
+
+// AddType adds the definition of the type to the table. Unlike
+// t.AddTypeDefinition, it supports recursive types.
+func (tdt *TypeDefinitionTable) AddType(t Type) error {
+	p, ok := typePointer(t)
+	if ok {
+		if tdt.refs == nil {
+			tdt.refs = make(map[uintptr]int)
+		}
+		if _, ok := tdt.refs[p]; ok {
+			// Already added, or a recursive reference to the type.
+			return nil
+		}
+		tdt.refs[p] = -1
+	}
+	tdt.adding = append(tdt.adding, p)
+	err := t.AddTypeDefinition(tdt)
+	tdt.adding = tdt.adding[:len(tdt.adding)-1]
+	if ok && tdt.refs[p] == -1 {
+		// Primitive types have no definition.
+		delete(tdt.refs, p)
+	}
+	return err
+}
+
+// EncodeType encodes a reference to the type, of which the definition was
+// added with AddType.
+func (tdt *TypeDefinitionTable) EncodeType(t Type) ([]byte, error) {
+	p, ok := typePointer(t)
+	if !ok {
+		return t.EncodeType(tdt)
+	}
+	i, ok := tdt.refs[p]
+	if !ok {
+		return t.EncodeType(tdt)
+	}
+	if i == -1 {
+		// The type refers to itself, so its index is reserved before its
+		// definition is known.
+		i = len(tdt.Types)
+		tdt.Types = append(tdt.Types, nil)
+		tdt.refs[p] = i
+	}
+	return leb128.EncodeSigned(big.NewInt(int64(i)))
 }
 
 func (tdt *TypeDefinitionTable) Add(t Type, bs []byte) {
-	if i := slices.IndexFunc(tdt.Types, func(typ []byte) bool {
-		return slices.Equal(typ, bs)
-	}); i != -1 {
-		tdt.Indexes[t.String()] = i
+	var p uintptr
+	if len(tdt.adding) != 0 {
+		p = tdt.adding[len(tdt.adding)-1]
+	}
+	if i, ok := tdt.refs[p]; ok && p != 0 && i != -1 {
+		tdt.Types[i] = bs
 		return
 	}
 
-	i := len(tdt.Types)
+	i := slices.IndexFunc(tdt.Types, func(typ []byte) bool {
+		return slices.Equal(typ, bs)
+	})
+	if i == -1 {
+		i = len(tdt.Types)
+		tdt.Types = append(tdt.Types, bs)
+	}
+	if p != 0 {
+		// The string of the type is not used, since it does not terminate
+		// for recursive types.
+		tdt.refs[p] = i
+		return
+	}
 	tdt.Indexes[t.String()] = i
-	tdt.Types = append(tdt.Types, bs)
+}
+
+// typePointer returns the address of the type if it is a pointer.
+func typePointer(t Type) (uintptr, bool) {
+	v := reflect.ValueOf(t)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return 0, false
+	}
+	return v.Pointer(), true
 }
@@ -62,16 +62,14 @@ func (TextType) Read(r *bytes.Reader) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if n.Int64() == 0 {
-		return raw, nil
-	}
-	bs := make([]byte, len(raw)+int(n.Int64()))
-	i, err := r.Read(bs[len(raw)+1:])
+	l, err := checkLen(n, r)
 	if err != nil {
 		return nil, err
 	}
-	if i != int(n.Int64()) {
-		return nil, io.EOF
+	bs := make([]byte, len(raw)+l)
+	copy(bs, raw)
+	if _, err := io.ReadFull(r, bs[len(raw):]); err != nil {
+		return nil, err
 	}
 	return bs, nil
 }
@@ -1,12 +1,13 @@
 package idl_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/niccolofant/agent-go/candid/idl"
 )
 
-func ExampleText() {
+func ExampleTextType() {
 	test([]idl.Type{new(idl.TextType)}, []any{""})
 	test([]idl.Type{new(idl.TextType)}, []any{"Motoko"})
 	test([]idl.Type{new(idl.TextType)}, []any{"Hi ☃\n"})
@@ -36,3 +37,20 @@ func TestTextType_UnmarshalGo(t *testing.T) {
 		}
 	}
 }
+
+func TestTextType_Read(t *testing.T) {
+	for _, s := range []string{"", "Motoko"} {
+		bs, err := idl.TextType{}.EncodeValue(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bytes.NewReader(append(bs, 0xff))
+		raw, err := idl.TextType{}.Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, bs) || r.Len() != 1 {
+			t.Errorf("got %x, want %x", raw, bs)
+		}
+	}
+}
@@ -31,6 +31,22 @@ func checkLen(l *big.Int, r *bytes.Reader) (int, error) {
 	return int(l.Int64()), nil
 }
 
+// checkVectorLen validates the length of a vector with elements of type t.
+// Values of null and reserved take up no bytes, so the lengths of their vectors
+// are not limited by the remaining input, but by the MaxZeroSizedElements
+// option of candid.DecodeWithOptions.
+func checkVectorLen(t Type, l *big.Int, r *bytes.Reader) (int, error) {
+	switch t.(type) {
+	case *NullType, *ReservedType, NullType, ReservedType:
+		if !l.IsInt64() || l.Int64() < 0 {
+			return 0, fmt.Errorf("invalid length %s", l)
+		}
+		return int(l.Int64()), nil
+	default:
+		return checkLen(l, r)
+	}
+}
+
 func concat(bs ...[]byte) []byte {
 	var l int
 	for _, b := range bs {
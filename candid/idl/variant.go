@@ -49,14 +49,14 @@ func NewVariantType(fields map[string]Type) *VariantType {
 		})
 	}
 	sort.Slice(variant.Fields, func(i, j int) bool {
-		return Hash(variant.Fields[i].Name).Cmp(Hash(variant.Fields[j].Name)) < 0
+		return fieldID(variant.Fields[i].Name) < fieldID(variant.Fields[j].Name)
 	})
 	return &variant
 }
 
 func (variant VariantType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 	for _, f := range variant.Fields {
-		if err := f.Type.AddTypeDefinition(tdt); err != nil {
+		if err := tdt.AddType(f.Type); err != nil {
 			return err
 		}
 	}
@@ -71,11 +71,11 @@ func (variant VariantType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 	}
 	var vs []byte
 	for _, f := range variant.Fields {
-		id, err := leb128.EncodeUnsigned(Hash(f.Name))
+		id, err := leb128.EncodeUnsigned(new(big.Int).SetUint64(uint64(fieldID(f.Name))))
 		if err != nil {
 			return nil
 		}
-		t, err := f.Type.EncodeType(tdt)
+		t, err := tdt.EncodeType(f.Type)
 		if err != nil {
 			return nil
 		}
@@ -115,6 +115,10 @@ func (variant VariantType) EncodeType(tdt *TypeDefinitionTable) ([]byte, error)
 }
 
 func (variant VariantType) EncodeValue(value any) ([]byte, error) {
+	if v, ok := value.(*Variant); ok && v != nil {
+		// As returned by Decode.
+		return variant.EncodeValue(*v)
+	}
 	fs, ok := value.(Variant)
 	if !ok {
 		v, err := variant.structToVariant(value)
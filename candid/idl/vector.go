@@ -20,7 +20,7 @@ func NewVectorType(t Type) *VectorType {
 }
 
 func (vec VectorType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
-	if err := vec.Type.AddTypeDefinition(tdt); err != nil {
+	if err := tdt.AddType(vec.Type); err != nil {
 		return err
 	}
 
@@ -28,7 +28,7 @@ func (vec VectorType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 	if err != nil {
 		return err
 	}
-	v_, err := vec.Type.EncodeType(tdt)
+	v_, err := tdt.EncodeType(vec.Type)
 	if err != nil {
 		return err
 	}
@@ -37,7 +37,11 @@ func (vec VectorType) AddTypeDefinition(tdt *TypeDefinitionTable) error {
 }
 
 func (vec VectorType) Decode(r *bytes.Reader) (any, error) {
-	n, err := decodeLen(r)
+	l, err := leb128.DecodeUnsigned(r)
+	if err != nil {
+		return nil, err
+	}
+	n, err := checkVectorLen(vec.Type, l, r)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +101,7 @@ func (vec VectorType) Read(r *bytes.Reader) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	n, err := checkLen(l, r)
+	n, err := checkVectorLen(vec.Type, l, r)
 	if err != nil {
 		return nil, err
 	}
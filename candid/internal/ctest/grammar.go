@@ -7,42 +7,38 @@ import (
 )
 
 var (
-	TestData      = op.Capture{Name: "TestData", Value: op.OneOrMore{Value: op.Or{Comment, Test, EndLine}}}
+	TestData      = op.Capture{Name: "TestData", Value: op.OneOrMore{Value: op.Or{Comment, Definition, Test, EndLine, ' ', rune(0x09)}}}
 	Comment       = op.Or{op.And{"/*", Ws, MultiComment, Ws, "*/"}, op.And{op.And{"//", op.Optional{Value: CommentText}}, EndLine}}
 	CommentText   = op.Capture{Name: "CommentText", Value: op.ZeroOrMore{Value: op.Or{op.RuneRange{Min: 0x00, Max: 0x09}, op.RuneRange{Min: 0x0B, Max: 0x0C}, op.RuneRange{Min: 0x0E, Max: 0xD7FF}, op.RuneRange{Min: 0xE000, Max: 0x10FFFF}}}}
 	MultiComment  = op.ZeroOrMore{Value: op.Or{op.RuneRange{Min: 0x00, Max: 0x29}, op.RuneRange{Min: 0x2B, Max: 0x10FFFF}, op.And{rune(0x2A), op.Or{op.RuneRange{Min: 0x00, Max: 0x2E}, op.RuneRange{Min: 0x30, Max: 0x10FFFF}}}, EndLine}}
 	Ws            = op.ZeroOrMore{Value: op.Or{' ', rune(0x09), EndLine}}
 	EndLine       = op.Or{rune(0x0A), rune(0x0D), op.And{rune(0x0D), rune(0x0A)}}
-	Test          = op.Capture{Name: "Test", Value: op.And{"assert ", Input, Ws, op.Or{TestGoodTmpl, TestBadTmpl, TestTest}, op.Optional{Value: op.And{op.OneOrMore{Value: ' '}, Description}}, ';'}}
+	Definition    = op.Capture{Name: "Definition", Value: op.And{"type ", TypeText, ';'}}
+	Test          = op.Capture{Name: "Test", Value: op.And{"assert ", Input, Ws, op.Or{TestGoodTmpl, TestBadTmpl, TestTest, TestNotEqual}, op.Optional{Value: op.And{Ws, Description}}, Ws, ';'}}
 	TestGoodTmpl  = op.And{':', Ws, TestGood}
-	TestGood      = op.Capture{Name: "TestGood", Value: ValuesBr}
+	TestGood      = op.Capture{Name: "TestGood", Value: ArgTypes}
 	TestBadTmpl   = op.And{"!:", Ws, TestBad}
-	TestBad       = op.Capture{Name: "TestBad", Value: ValuesBr}
-	TestTest      = op.Capture{Name: "TestTest", Value: op.And{"==", Ws, Input, Ws, ':', Ws, ValuesBr}}
-	ValuesBr      = op.Or{"()", op.And{'(', Values, op.ZeroOrMore{Value: op.And{", ", Values}}, ')'}}
-	Values        = op.Or{Null, Bool, Nat, Int, Float, Text, Reserved, Empty, Opt}
-	Null          = op.Capture{Name: "Null", Value: "null"}
-	Bool          = op.Capture{Name: "Bool", Value: "bool"}
-	Nat           = op.Capture{Name: "Nat", Value: op.And{"nat", op.Optional{Value: Base}}}
-	Int           = op.Capture{Name: "Int", Value: op.And{"int", op.Optional{Value: Base}}}
-	Float         = op.Capture{Name: "Float", Value: op.And{"float", Base}}
-	Base          = op.Capture{Name: "Base", Value: op.OneOrMore{Value: Digit}}
-	Text          = op.Capture{Name: "Text", Value: "text"}
-	Reserved      = op.Capture{Name: "Reserved", Value: "reserved"}
-	Empty         = op.Capture{Name: "Empty", Value: "empty"}
-	Opt           = op.Capture{Name: "Opt", Value: op.And{"opt ", op.Reference{Name: "Values"}}}
+	TestBad       = op.Capture{Name: "TestBad", Value: ArgTypes}
+	TestTest      = op.Capture{Name: "TestTest", Value: op.And{"==", Ws, Input, Ws, ':', Ws, ArgTypes}}
+	TestNotEqual  = op.Capture{Name: "TestNotEqual", Value: op.And{"!=", Ws, Input, Ws, ':', Ws, ArgTypes}}
+	ArgTypes      = op.Capture{Name: "ArgTypes", Value: op.And{'(', NestedText, ')'}}
+	TypeText      = op.ZeroOrMore{Value: op.Or{TopChar, op.And{'(', NestedText, ')'}, op.And{'{', NestedText, '}'}, QuotedText}}
+	NestedText    = op.ZeroOrMore{Value: op.Or{NestedChar, op.And{'(', op.Reference{Name: "NestedText"}, ')'}, op.And{'{', op.Reference{Name: "NestedText"}, '}'}, QuotedText}}
+	TopChar       = op.Or{op.RuneRange{Min: 0x09, Max: 0x0D}, op.RuneRange{Min: 0x20, Max: 0x21}, op.RuneRange{Min: 0x23, Max: 0x27}, op.RuneRange{Min: 0x2A, Max: 0x3A}, op.RuneRange{Min: 0x3C, Max: 0x7A}, rune(0x7C), op.RuneRange{Min: 0x7E, Max: 0x10FFFF}}
+	NestedChar    = op.Or{op.RuneRange{Min: 0x09, Max: 0x0D}, op.RuneRange{Min: 0x20, Max: 0x21}, op.RuneRange{Min: 0x23, Max: 0x27}, op.RuneRange{Min: 0x2A, Max: 0x7A}, rune(0x7C), op.RuneRange{Min: 0x7E, Max: 0x10FFFF}}
+	QuotedText    = op.And{rune(0x22), String, rune(0x22)}
 	Input         = op.Or{BlobInputTmpl, TextInputTmpl}
 	TextInputTmpl = op.And{rune(0x22), TextInput, rune(0x22)}
 	TextInput     = op.Capture{Name: "TextInput", Value: String}
 	BlobInputTmpl = op.And{"blob ", rune(0x22), BlobInput, rune(0x22)}
 	BlobInput     = op.Capture{Name: "BlobInput", Value: op.ZeroOrMore{Value: op.Or{BlobAlpha, op.And{'\\', BlobHex}}}}
-	BlobAlpha     = op.Capture{Name: "BlobAlpha", Value: op.OneOrMore{Value: op.Or{op.RuneRange{Min: 0x41, Max: 0x5A}, op.RuneRange{Min: 0x61, Max: 0x7A}}}}
+	BlobAlpha     = op.Capture{Name: "BlobAlpha", Value: op.OneOrMore{Value: op.Or{op.RuneRange{Min: 0x20, Max: 0x21}, op.RuneRange{Min: 0x23, Max: 0x5B}, op.RuneRange{Min: 0x5D, Max: 0x7E}}}}
 	BlobHex       = op.Capture{Name: "BlobHex", Value: op.Repeat{Min: 2, Max: 2, Value: op.Or{op.RuneRange{Min: 0x30, Max: 0x39}, op.RuneRange{Min: 0x41, Max: 0x46}, op.RuneRange{Min: 0x61, Max: 0x66}}}}
 	Description   = op.Capture{Name: "Description", Value: op.And{rune(0x22), String, rune(0x22)}}
 	String        = op.ZeroOrMore{Value: Char}
-	Char          = op.Or{EscapedDQuote, UChar}
-	UChar         = op.Or{op.RuneRange{Min: 0x20, Max: 0x21}, op.RuneRange{Min: 0x23, Max: 0x10FFFF}}
-	EscapedDQuote = op.And{rune(0x5C), rune(0x22)}
+	Char          = op.Or{Escaped, UChar}
+	UChar         = op.Or{op.RuneRange{Min: 0x20, Max: 0x21}, op.RuneRange{Min: 0x23, Max: 0x5B}, op.RuneRange{Min: 0x5D, Max: 0x10FFFF}}
+	Escaped       = op.And{rune(0x5C), op.RuneRange{Min: 0x20, Max: 0x10FFFF}}
 	Digit         = op.RuneRange{Min: 0x30, Max: 0x39}
 	Hex           = op.Or{Digit, op.RuneRange{Min: 0x41, Max: 0x46}, op.RuneRange{Min: 0x61, Max: 0x66}}
 )
@@ -52,6 +48,6 @@ func NewParser(input []rune) (*parser.Parser, error) {
 	if err != nil {
 		return nil, err
 	}
-	p.Rules["Values"] = Values
+	p.Rules["NestedText"] = NestedText
 	return p, nil
 }
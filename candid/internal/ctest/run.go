@@ -0,0 +1,282 @@
+package ctest
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/niccolofant/agent-go/candid"
+	"github.com/niccolofant/agent-go/candid/idl"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// maxUnroll is the number of times that a recursive type is unrolled into a Go
+// type, values that are nested deeper are kept as raw messages.
+const maxUnroll = 8
+
+// Run runs the test. It returns an error if the input does not behave as
+// asserted.
+//
+// Textual inputs are encoded with candid.EncodeValuesString at the types of
+// the test, which gives numbers without annotation their type. The messages
+// are unmarshalled with candid.Unmarshal into Go values of the types of the
+// test, so that the decoder applies the subtyping rules, and the values of
+// both inputs are compared. Messages that decode are also decoded with
+// candid.Decode and encoded again with candid.Encode, which has to result in
+// the same values.
+func (s *Suite) Run(test Assertion) error {
+	types, err := s.parseTypes(test.Types)
+	if err != nil {
+		return err
+	}
+	v, err := value(test.Input, types)
+	switch test.Kind {
+	case Accept:
+		if err != nil {
+			return fmt.Errorf("expected input to decode: %w", err)
+		}
+		return checkEncode(test.Input, types, v)
+	case Reject:
+		if err == nil {
+			return fmt.Errorf("expected input not to decode, got %v", v)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("expected input to decode: %w", err)
+	}
+	other, err := value(test.Other, types)
+	if err != nil {
+		return fmt.Errorf("expected other input to decode: %w", err)
+	}
+	switch equal := equal(reflect.ValueOf(v), reflect.ValueOf(other)); {
+	case test.Kind == Equal && !equal:
+		return fmt.Errorf("expected equal values, got %v and %v", v, other)
+	case test.Kind == NotEqual && equal:
+		return fmt.Errorf("expected different values, got %v", v)
+	}
+	if err := checkEncode(test.Input, types, v); err != nil {
+		return err
+	}
+	return checkEncode(test.Other, types, other)
+}
+
+// message returns the binary message of the input.
+func message(input Value, types []idl.Type) ([]byte, error) {
+	if input.Blob {
+		return input.Data, nil
+	}
+	return candid.EncodeValuesString(types, string(input.Data))
+}
+
+// value unmarshals the input into Go values of the given types.
+func value(input Value, types []idl.Type) ([]any, error) {
+	data, err := message(input, types)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshal(data, types)
+}
+
+func unmarshal(data []byte, types []idl.Type) ([]any, error) {
+	ptrs := make([]any, len(types))
+	for i, t := range types {
+		typ, err := goType(t, make(map[idl.Type]int))
+		if err != nil {
+			return nil, err
+		}
+		ptrs[i] = reflect.New(typ).Interface()
+	}
+	if err := candid.Unmarshal(data, ptrs); err != nil {
+		return nil, err
+	}
+	vs := make([]any, len(ptrs))
+	for i, ptr := range ptrs {
+		vs[i] = reflect.ValueOf(ptr).Elem().Interface()
+	}
+	return vs, nil
+}
+
+// checkEncode decodes the input, encodes it again, and checks whether it
+// unmarshals to the same values.
+func checkEncode(input Value, types []idl.Type, expected []any) error {
+	data, err := message(input, types)
+	if err != nil {
+		return err
+	}
+	ts, vs, err := candid.Decode(data)
+	if err != nil {
+		return err
+	}
+	raw, err := candid.Encode(ts, vs)
+	if err != nil {
+		return fmt.Errorf("failed to encode decoded input: %w", err)
+	}
+	v, err := unmarshal(raw, types)
+	if err != nil {
+		return fmt.Errorf("failed to decode encoded input %q: %w", raw, err)
+	}
+	if !equal(reflect.ValueOf(v), reflect.ValueOf(expected)) {
+		return fmt.Errorf("encoded input decodes to %v, expected %v", v, expected)
+	}
+	return nil
+}
+
+// equal returns whether the values are equal. Unlike reflect.DeepEqual, NaN
+// is equal to NaN, and function references are equal if they refer to the
+// same method, whatever their types.
+func equal(x, y reflect.Value) bool {
+	if x.Type() != y.Type() {
+		return false
+	}
+	switch x.Kind() {
+	case reflect.Float32, reflect.Float64:
+		a, b := x.Float(), y.Float()
+		return a == b || math.IsNaN(a) && math.IsNaN(b)
+	case reflect.Pointer, reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return equal(x.Elem(), y.Elem())
+	case reflect.Slice:
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if !equal(x.Index(i), y.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if x.Type() == functionType {
+			return reflect.DeepEqual(x.FieldByName("Method").Interface(), y.FieldByName("Method").Interface())
+		}
+		if x.Type().PkgPath() != "" {
+			// Values of other packages, e.g. idl.Nat.
+			return reflect.DeepEqual(x.Interface(), y.Interface())
+		}
+		for i := 0; i < x.NumField(); i++ {
+			if !equal(x.Field(i), y.Field(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(x.Interface(), y.Interface())
+	}
+}
+
+var (
+	emptyType     = reflect.TypeOf(struct{}{})
+	natType       = reflect.TypeOf(idl.Nat{})
+	intType       = reflect.TypeOf(idl.Int{})
+	nullType      = reflect.TypeOf(idl.Null{})
+	reservedType  = reflect.TypeOf(idl.Reserved{})
+	principalType = reflect.TypeOf(principal.Principal{})
+	functionType  = reflect.TypeOf(idl.Function{})
+	rawType       = reflect.TypeOf(idl.RawMessage{})
+)
+
+// goType returns the Go type that values of type t are unmarshalled into.
+// Records and variants become structs with a field per field of the type,
+// variant fields are pointers, of which only the one of the tag is set.
+// Recursive types are unrolled up to maxUnroll times, the counts are kept in
+// unrolled.
+func goType(t idl.Type, unrolled map[idl.Type]int) (reflect.Type, error) {
+	if reflect.ValueOf(t).Kind() == reflect.Pointer {
+		if unrolled[t] == maxUnroll {
+			return rawType, nil
+		}
+		unrolled[t]++
+		defer func() { unrolled[t]-- }()
+	}
+	switch t := t.(type) {
+	case *idl.NullType:
+		return nullType, nil
+	case *idl.ReservedType:
+		return reservedType, nil
+	case *idl.EmptyType:
+		// There are no values of type empty.
+		return emptyType, nil
+	case *idl.BoolType:
+		return reflect.TypeOf(false), nil
+	case *idl.TextType:
+		return reflect.TypeOf(""), nil
+	case *idl.NatType:
+		switch t.Base() {
+		case 0:
+			return natType, nil
+		case 1:
+			return reflect.TypeOf(uint8(0)), nil
+		case 2:
+			return reflect.TypeOf(uint16(0)), nil
+		case 4:
+			return reflect.TypeOf(uint32(0)), nil
+		default:
+			return reflect.TypeOf(uint64(0)), nil
+		}
+	case *idl.IntType:
+		switch t.Base() {
+		case 0:
+			return intType, nil
+		case 1:
+			return reflect.TypeOf(int8(0)), nil
+		case 2:
+			return reflect.TypeOf(int16(0)), nil
+		case 4:
+			return reflect.TypeOf(int32(0)), nil
+		default:
+			return reflect.TypeOf(int64(0)), nil
+		}
+	case *idl.FloatType:
+		if t.Base() == 4 {
+			return reflect.TypeOf(float32(0)), nil
+		}
+		return reflect.TypeOf(float64(0)), nil
+	case *idl.PrincipalType, *idl.Service:
+		return principalType, nil
+	case *idl.FunctionType:
+		return functionType, nil
+	case *idl.OptionalType:
+		elem, err := goType(t.Type, unrolled)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.PointerTo(elem), nil
+	case *idl.VectorType:
+		elem, err := goType(t.Type, unrolled)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	case *idl.RecordType:
+		return structType(t.Fields, false, unrolled)
+	case *idl.VariantType:
+		return structType(t.Fields, true, unrolled)
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// structType returns a struct type with a field per field of a record or
+// variant, tagged with the name of the field.
+func structType(fs []idl.FieldType, variant bool, unrolled map[idl.Type]int) (reflect.Type, error) {
+	fields := make([]reflect.StructField, len(fs))
+	for i, f := range fs {
+		typ, err := goType(f.Type, unrolled)
+		if err != nil {
+			return nil, err
+		}
+		if variant {
+			typ = reflect.PointerTo(typ)
+		}
+		fields[i] = reflect.StructField{
+			Name: "F" + strconv.Itoa(i),
+			Type: typ,
+			Tag:  reflect.StructTag(fmt.Sprintf("ic:%q", f.Name)),
+		}
+	}
+	return reflect.StructOf(fields), nil
+}
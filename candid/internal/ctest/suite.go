@@ -0,0 +1,293 @@
+package ctest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/0x51-dev/upeg/parser"
+	"github.com/niccolofant/agent-go/candid/did"
+	"github.com/niccolofant/agent-go/candid/idl"
+)
+
+// Kind is the kind of assertion of a test.
+type Kind int
+
+const (
+	// Accept asserts that the input decodes as a value of the types: `:`.
+	Accept Kind = iota
+	// Reject asserts that the input does not decode as a value of the types:
+	// `!:`.
+	Reject
+	// Equal asserts that both inputs decode as the same value: `==`.
+	Equal
+	// NotEqual asserts that both inputs decode as different values: `!=`.
+	NotEqual
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Accept:
+		return ":"
+	case Reject:
+		return "!:"
+	case Equal:
+		return "=="
+	case NotEqual:
+		return "!="
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Value is the input of a test, either a binary or a textual Candid value.
+type Value struct {
+	// Blob reports whether the input is binary.
+	Blob bool
+	// Data is the binary value, or the unescaped textual value.
+	Data []byte
+}
+
+func (v Value) String() string {
+	if v.Blob {
+		return fmt.Sprintf("blob %q", v.Data)
+	}
+	return fmt.Sprintf("%q", v.Data)
+}
+
+// Assertion is a single assertion of a test file.
+type Assertion struct {
+	Kind  Kind
+	Input Value
+	// Other is the second input of Equal and NotEqual tests.
+	Other Value
+	// Types are the argument types, in Candid type syntax without the
+	// enclosing parentheses.
+	Types string
+	// Description is the optional description of the test.
+	Description string
+}
+
+func (t Assertion) String() string {
+	var s strings.Builder
+	s.WriteString(t.Input.String())
+	if t.Kind == Equal || t.Kind == NotEqual {
+		fmt.Fprintf(&s, " %s %s :", t.Kind, t.Other)
+	} else {
+		fmt.Fprintf(&s, " %s", t.Kind)
+	}
+	fmt.Fprintf(&s, " (%s)", t.Types)
+	if t.Description != "" {
+		fmt.Fprintf(&s, " %q", t.Description)
+	}
+	return s.String()
+}
+
+// Suite is a test file of the Candid test suite, e.g. "prim.test.did".
+type Suite struct {
+	// Definitions are the type definitions that can be used in the types of
+	// the tests, e.g. "type list = opt record { int; list };".
+	Definitions []string
+	Assertions  []Assertion
+}
+
+// ParseFile parses the test file at the given path.
+func ParseFile(path string) (*Suite, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(raw)
+}
+
+// Parse parses a test file.
+func Parse(raw []byte) (*Suite, error) {
+	p, err := NewParser(bytes.Runes(raw))
+	if err != nil {
+		return nil, err
+	}
+	n, err := p.ParseEOF(TestData)
+	if err != nil {
+		return nil, err
+	}
+	var s Suite
+	for _, n := range n.Children() {
+		switch n.Name {
+		case CommentText.Name:
+		case Definition.Name:
+			s.Definitions = append(s.Definitions, n.Value())
+		case Test.Name:
+			test, err := convertAssertion(n)
+			if err != nil {
+				return nil, err
+			}
+			s.Assertions = append(s.Assertions, *test)
+		default:
+			return nil, fmt.Errorf("unexpected node: %s", n.Name)
+		}
+	}
+	return &s, nil
+}
+
+func convertAssertion(n *parser.Node) (*Assertion, error) {
+	var (
+		test   Assertion
+		inputs []Value
+	)
+	convertTypes := func(n *parser.Node) error {
+		for _, n := range n.Children() {
+			switch n.Name {
+			case ArgTypes.Name:
+				test.Types = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(n.Value(), "("), ")"))
+			case BlobInput.Name, TextInput.Name:
+				input, err := convertInput(n)
+				if err != nil {
+					return err
+				}
+				inputs = append(inputs, *input)
+			default:
+				return fmt.Errorf("unexpected node: %s", n.Name)
+			}
+		}
+		return nil
+	}
+	for _, n := range n.Children() {
+		switch n.Name {
+		case BlobInput.Name, TextInput.Name:
+			input, err := convertInput(n)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, *input)
+		case TestGood.Name, TestBad.Name, TestTest.Name, TestNotEqual.Name:
+			switch n.Name {
+			case TestGood.Name:
+				test.Kind = Accept
+			case TestBad.Name:
+				test.Kind = Reject
+			case TestTest.Name:
+				test.Kind = Equal
+			case TestNotEqual.Name:
+				test.Kind = NotEqual
+			}
+			if err := convertTypes(n); err != nil {
+				return nil, err
+			}
+		case Description.Name:
+			desc, err := unescape(strings.TrimSuffix(strings.TrimPrefix(n.Value(), `"`), `"`))
+			if err != nil {
+				return nil, err
+			}
+			test.Description = string(desc)
+		default:
+			return nil, fmt.Errorf("unexpected node: %s", n.Name)
+		}
+	}
+	switch {
+	case len(inputs) == 0:
+		return nil, fmt.Errorf("test without input")
+	case test.Kind == Equal || test.Kind == NotEqual:
+		if len(inputs) != 2 {
+			return nil, fmt.Errorf("expected two inputs")
+		}
+		test.Other = inputs[1]
+	}
+	test.Input = inputs[0]
+	return &test, nil
+}
+
+func convertInput(n *parser.Node) (*Value, error) {
+	if n.Name == TextInput.Name {
+		data, err := unescape(n.Value())
+		if err != nil {
+			return nil, err
+		}
+		return &Value{Data: data}, nil
+	}
+	input := Value{Blob: true, Data: []byte{}}
+	for _, n := range n.Children() {
+		switch n.Name {
+		case BlobAlpha.Name:
+			input.Data = append(input.Data, n.Value()...)
+		case BlobHex.Name:
+			h, err := hex.DecodeString(n.Value())
+			if err != nil {
+				return nil, err
+			}
+			input.Data = append(input.Data, h...)
+		default:
+			return nil, fmt.Errorf("unexpected node: %s", n.Name)
+		}
+	}
+	return &input, nil
+}
+
+// parseTypes parses a comma separated list of types, which can refer to the
+// definitions of the suite.
+func (s *Suite) parseTypes(types string) ([]idl.Type, error) {
+	src := fmt.Sprintf("%s\nservice : { test : (%s) -> () }", strings.Join(s.Definitions, "\n"), types)
+	desc, err := did.ParseDID([]rune(src))
+	if err != nil {
+		return nil, fmt.Errorf("invalid types %q: %w", types, err)
+	}
+	service, err := desc.ServiceType()
+	if err != nil {
+		return nil, err
+	}
+	var ts []idl.Type
+	for _, p := range service.Methods[0].Func.ArgumentParameters {
+		ts = append(ts, p.Type)
+	}
+	return ts, nil
+}
+
+// unescape resolves the escape sequences of a Candid text literal: \n, \r,
+// \t, \\, \", \', \xx and \u{x}.
+func unescape(s string) ([]byte, error) {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i++; len(s) <= i {
+			return nil, fmt.Errorf("invalid escape sequence at end of %q", s)
+		}
+		switch c := s[i]; c {
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case '\\', '"', '\'':
+			b = append(b, c)
+		case 'u':
+			end := strings.IndexByte(s[i:], '}')
+			if !strings.HasPrefix(s[i:], "u{") || end < 0 {
+				return nil, fmt.Errorf("invalid unicode escape in %q", s)
+			}
+			r, err := strconv.ParseUint(strings.ReplaceAll(s[i+2:i+end], "_", ""), 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return nil, fmt.Errorf("invalid unicode escape in %q", s)
+			}
+			b = utf8.AppendRune(b, rune(r))
+			i += end
+		default:
+			if len(s) < i+2 {
+				return nil, fmt.Errorf("invalid escape sequence in %q", s)
+			}
+			h, err := strconv.ParseUint(s[i:i+2], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid escape sequence in %q", s)
+			}
+			b = append(b, byte(h))
+			i++
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,57 @@
+package ctest_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/niccolofant/agent-go/candid/internal/ctest"
+)
+
+// knownFailures are the tests of the test suite that candid.Unmarshal, or
+// candid.Decode and candid.Encode, do not pass, by file and description, with
+// the reason. They are skipped, so that they show up in the output of
+// go test -v.
+var knownFailures = map[string]map[string]string{
+	"construct.test.did": {
+		"record: missing field": "fields of Go structs that are missing in the message keep their zero value",
+	},
+	"reference.test.did": {
+		"service: missing method":        "Go values of service references have no type to check the message against",
+		"func: missing annotation":       "Go values of func references have no type to check the message against",
+		"func: missing query annotation": "Go values of func references have no type to check the message against",
+	},
+	"subtypes.test.did": {
+		"nat8 </: nat":                                "fixed size numbers can be unmarshalled into wider Go types",
+		"int8 </: int16":                              "fixed size numbers can be unmarshalled into wider Go types",
+		"float32 </: float64":                         "fixed size numbers can be unmarshalled into wider Go types",
+		"record {} </: record { a : int }":            "fields of Go structs that are missing in the message keep their zero value",
+		"func (nat) -> (int) </: func (int) -> (nat)": "Go values of func references have no type to check the message against",
+		"func (int) -> () </: func () -> ()":          "Go values of func references have no type to check the message against",
+	},
+}
+
+func TestSuite(t *testing.T) {
+	files, err := filepath.Glob("../../idl/testdata/*.test.did")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			s, err := ctest.ParseFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			known := knownFailures[filepath.Base(file)]
+			for _, a := range s.Assertions {
+				t.Run(a.Description, func(t *testing.T) {
+					if reason, ok := known[a.Description]; ok {
+						t.Skipf("known failure: %s", reason)
+					}
+					if err := s.Run(a); err != nil {
+						t.Errorf("%s: %v", a, err)
+					}
+				})
+			}
+		})
+	}
+}
@@ -29,15 +29,21 @@ func TestValues(t *testing.T) {
 		"(\"Hello world.\" : text)",
 
 		"opt 0",
+		"opt opt null",
 
 		"record{}",
 		"record{ f0 = 0; f1 = opt 0 }",
 		"record{\n\tf0 = 0;\n\tf1 = opt 0;\n}",
+		"record{ 0; true }",
+		"record{ 0 = 0; 1_000 = 1 }",
 
 		"variant{ e }",
 		"variant{ e = 0; }",
 
 		"principal \"aaaaa-aaa\"",
+		"service \"aaaaa-aaa\"",
+		"func \"aaaaa-aaa\".foo",
+		"blob \"\\00\\ff\"",
 
 		"vec{}",
 		"vec{ 0; 1; 2 }",
@@ -2,36 +2,74 @@ package ii
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"time"
+
 	"github.com/niccolofant/agent-go/certification"
-	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/identity"
 	"github.com/niccolofant/agent-go/principal"
-	"github.com/fxamacker/cbor/v2"
 )
 
 type BEHexUint64 uint64
 
+// MarshalJSON encodes the number as 8 big-endian bytes in hexadecimal.
+func (b BEHexUint64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(binary.BigEndian.AppendUint64(nil, uint64(b))))
+}
+
 func (b *BEHexUint64) UnmarshalJSON(bytes []byte) error {
 	var s string
 	if err := json.Unmarshal(bytes, &s); err != nil {
 		return err
 	}
+	// agent-js does not pad the expiration to an even number of digits.
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
 	bb, err := hex.DecodeString(s)
 	if err != nil {
 		return err
 	}
-	*b = BEHexUint64(binary.BigEndian.Uint64(bb))
+	if len(bb) > 8 {
+		return fmt.Errorf("invalid big-endian uint64: %q", s)
+	}
+	*b = BEHexUint64(binary.BigEndian.Uint64(append(make([]byte, 8-len(bb)), bb...)))
 	return nil
 }
 
 type Delegation struct {
 	PublicKey  HexString   `json:"pubkey"`
 	Expiration BEHexUint64 `json:"expiration"`
-	Targets    []HexString `json:"targets"`
+	Targets    []HexString `json:"targets,omitempty"`
+}
+
+// SignDelegation signs a delegation from the given identity to the given DER
+// encoded public key. The delegation expires at the given time and is
+// restricted to the given targets, if any.
+func SignDelegation(id identity.Identity, publicKey []byte, expiration time.Time, targets ...principal.Principal) (SignedDelegation, error) {
+	delegation := Delegation{
+		PublicKey:  HexString(publicKey),
+		Expiration: BEHexUint64(expiration.UnixNano()),
+	}
+	for _, target := range targets {
+		delegation.Targets = append(delegation.Targets, HexString(target.Raw))
+	}
+	msg, err := delegation.SignatureMessage()
+	if err != nil {
+		return SignedDelegation{}, err
+	}
+	sig, err := id.Sign(msg)
+	if err != nil {
+		return SignedDelegation{}, err
+	}
+	return SignedDelegation{
+		Delegation: delegation,
+		Signature:  HexString(sig),
+	}, nil
 }
 
 func (d Delegation) SignatureMessage() ([]byte, error) {
@@ -58,20 +96,75 @@ type DelegationChain struct {
 	PublicKey   HexString          `json:"publicKey"`
 }
 
+// NewDelegationChain creates a chain with a delegation from the given identity
+// to the given DER encoded session public key, see SignDelegation.
+//
+// Example:
+//
+//	session, _ := identity.NewRandomEd25519Identity()
+//	chain, _ := ii.NewDelegationChain(root, session.PublicKey(), time.Now().Add(time.Hour))
+//	data, _ := json.Marshal(chain)
+func NewDelegationChain(id identity.Identity, publicKey []byte, expiration time.Time, targets ...principal.Principal) (*DelegationChain, error) {
+	delegation, err := SignDelegation(id, publicKey, expiration, targets...)
+	if err != nil {
+		return nil, err
+	}
+	return &DelegationChain{
+		Delegations: []SignedDelegation{delegation},
+		PublicKey:   HexString(id.PublicKey()),
+	}, nil
+}
+
+// Delegate returns a new chain that is extended with a delegation from the
+// given identity, which has to be the session key of the chain, to the given
+// public key.
+func (d DelegationChain) Delegate(id identity.Identity, publicKey []byte, expiration time.Time, targets ...principal.Principal) (*DelegationChain, error) {
+	if len(d.Delegations) == 0 {
+		return nil, fmt.Errorf("no delegations")
+	}
+	last := d.Delegations[len(d.Delegations)-1].Delegation
+	if !bytes.Equal([]byte(last.PublicKey), id.PublicKey()) {
+		return nil, fmt.Errorf("the identity is not the session key of the chain")
+	}
+	delegation, err := SignDelegation(id, publicKey, expiration, targets...)
+	if err != nil {
+		return nil, err
+	}
+	return &DelegationChain{
+		Delegations: append(slices.Clone(d.Delegations), delegation),
+		PublicKey:   d.PublicKey,
+	}, nil
+}
+
+// Identity returns an identity that signs with the given session key on behalf
+// of the delegating key of the chain.
+func (d DelegationChain) Identity(session identity.Identity) (*identity.DelegatedIdentity, error) {
+	delegations := make([]identity.SignedDelegation, len(d.Delegations))
+	for i, signed := range d.Delegations {
+		var targets []principal.Principal
+		for _, target := range signed.Delegation.Targets {
+			targets = append(targets, principal.Principal{Raw: []byte(target)})
+		}
+		delegations[i] = identity.SignedDelegation{
+			Delegation: identity.Delegation{
+				PublicKey:  []byte(signed.Delegation.PublicKey),
+				Expiration: uint64(signed.Delegation.Expiration),
+				Targets:    targets,
+			},
+			Signature: []byte(signed.Signature),
+		}
+	}
+	return identity.NewDelegatedIdentity(session, []byte(d.PublicKey), delegations)
+}
+
+// VerifyChallenge verifies that the chain delegates from a canister signature
+// of the given canister to the challenge, see DelegationChain.Verify.
 func (d DelegationChain) VerifyChallenge(
 	challenge []byte,
 	currentTimeNS uint64,
 	canisterID principal.Principal,
 	rootPublicKey []byte,
 ) error {
-	if len(d.Delegations) != 1 {
-		return fmt.Errorf("expected exactly one delegation")
-	}
-	signedDelegation := d.Delegations[0]
-	delegation := signedDelegation.Delegation
-	if !bytes.Equal(challenge, []byte(delegation.PublicKey)) {
-		return fmt.Errorf("invalid challenge")
-	}
 	canisterSig, err := CanisterSigPublicKeyFromDER([]byte(d.PublicKey))
 	if err != nil {
 		return err
@@ -79,45 +172,21 @@ func (d DelegationChain) VerifyChallenge(
 	if !bytes.Equal(canisterSig.CanisterID.Raw, canisterID.Raw) {
 		return fmt.Errorf("invalid canister ID")
 	}
-	if uint64(delegation.Expiration) < currentTimeNS {
-		return fmt.Errorf("delegation expired")
-	}
-
-	sig := []byte(signedDelegation.Signature)
-	message, err := delegation.SignatureMessage()
-	if err != nil {
-		return err
-	}
-	var wrapper struct {
-		Certificate []byte            `cbor:"certificate"`
-		Tree        hashtree.HashTree `cbor:"tree"`
-	}
-	if err := cbor.Unmarshal(sig, &wrapper); err != nil {
-		return err
-	}
-	var certificate certification.Certificate
-	if err := cbor.Unmarshal(wrapper.Certificate, &certificate); err != nil {
-		return err
-	}
-	tree := wrapper.Tree.Digest()
-	if err := certification.VerifyCertifiedData(
-		certificate,
-		canisterSig.CanisterID,
-		rootPublicKey,
-		tree[:],
-	); err != nil {
-		return err
-	}
-	seed := sha256.Sum256(canisterSig.Seed)
-	msg := sha256.Sum256(message)
-	if _, err := wrapper.Tree.Lookup(hashtree.Label("sig"), seed[:], msg[:]); err != nil {
-		return err
-	}
-	return nil
+	_, err = d.Verify(VerifyOptions{
+		SessionKey:  challenge,
+		CurrentTime: time.Unix(0, int64(currentTimeNS)),
+		RootKey:     rootPublicKey,
+	})
+	return err
 }
 
 type HexString string
 
+// MarshalJSON encodes the bytes in hexadecimal.
+func (h HexString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString([]byte(h)))
+}
+
 func (h *HexString) UnmarshalJSON(bytes []byte) error {
 	var s string
 	if err := json.Unmarshal(bytes, &s); err != nil {
@@ -1,11 +1,15 @@
 package ii
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"testing"
+	"time"
+
 	"github.com/niccolofant/agent-go/certification"
+	"github.com/niccolofant/agent-go/identity"
 	"github.com/niccolofant/agent-go/principal"
-	"testing"
 )
 
 func TestVerifyChallenge(t *testing.T) {
@@ -42,3 +46,88 @@ func TestVerifyChallenge(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBEHexUint64_UnmarshalJSON(t *testing.T) {
+	for _, test := range []struct {
+		json string
+		want uint64
+	}{
+		{`"17a5c9c3d6a20e21"`, 0x17a5c9c3d6a20e21},
+		{`"7a5c9c3d6a20e21"`, 0x7a5c9c3d6a20e21},
+		{`"0100"`, 0x100},
+		{`"1"`, 1},
+	} {
+		var b BEHexUint64
+		if err := json.Unmarshal([]byte(test.json), &b); err != nil {
+			t.Fatal(err)
+		}
+		if uint64(b) != test.want {
+			t.Errorf("%s: got %x, want %x", test.json, uint64(b), test.want)
+		}
+	}
+	for _, invalid := range []string{`"0117a5c9c3d6a20e21"`, `"xyz"`, `1`} {
+		var b BEHexUint64
+		if err := json.Unmarshal([]byte(invalid), &b); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestDelegationChain(t *testing.T) {
+	root, _ := identity.NewRandomEd25519Identity()
+	worker, _ := identity.NewRandomSecp256k1Identity()
+	session, _ := identity.NewRandomEd25519Identity()
+	target := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	expiration := time.Now().Add(time.Hour)
+
+	chain, err := NewDelegationChain(root, worker.PublicKey(), expiration, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.Delegate(session, session.PublicKey(), expiration); err == nil {
+		t.Error("expected an error for a key that is not the session key")
+	}
+	chain, err = chain.Delegate(worker, session.PublicKey(), expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded DelegationChain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte(decoded.PublicKey), root.PublicKey()) {
+		t.Error("unexpected public key")
+	}
+	signers := []identity.Identity{root, worker}
+	for i, d := range decoded.Delegations {
+		if uint64(d.Delegation.Expiration) != uint64(expiration.UnixNano()) {
+			t.Errorf("unexpected expiration %d", d.Delegation.Expiration)
+		}
+		msg, err := d.Delegation.SignatureMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !signers[i].Verify(msg, []byte(d.Signature)) {
+			t.Errorf("invalid signature of delegation %d", i)
+		}
+	}
+	if len(decoded.Delegations[0].Delegation.Targets) != 1 || len(decoded.Delegations[1].Delegation.Targets) != 0 {
+		t.Error("unexpected targets")
+	}
+
+	id, err := decoded.Identity(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.Sender().Equal(root.Sender()) {
+		t.Errorf("got sender %s, want %s", id.Sender(), root.Sender())
+	}
+	if err := id.Check(target, time.Now()); err != nil {
+		t.Error(err)
+	}
+}
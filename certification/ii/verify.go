@@ -0,0 +1,126 @@
+package ii
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/niccolofant/agent-go/certification"
+	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/identity"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// MaxDelegations is the maximum number of delegations in a chain that is
+// accepted by the IC.
+const MaxDelegations = 20
+
+// VerifyOptions are the options of DelegationChain.Verify.
+type VerifyOptions struct {
+	// SessionKey is the DER encoded public key to which the chain has to
+	// delegate. If empty, any session key is accepted.
+	SessionKey []byte
+	// CurrentTime is the time at which the delegations have to be valid.
+	// Defaults to the current time.
+	CurrentTime time.Time
+	// Target is a canister to which the delegations have to apply. If empty,
+	// the targets of the delegations are not checked.
+	Target principal.Principal
+	// RootKey is the DER encoded public key of the IC, used to verify
+	// canister signatures.
+	RootKey []byte
+}
+
+// Verify verifies the signatures, expirations and targets of the delegations
+// of the chain, and returns the principal on behalf of which the session key
+// acts. Every key in the chain can be an Ed25519, ECDSA P-256, ECDSA secp256k1
+// or canister signature public key.
+func (d DelegationChain) Verify(options VerifyOptions) (principal.Principal, error) {
+	if len(d.Delegations) == 0 {
+		return principal.Principal{}, fmt.Errorf("no delegations")
+	}
+	if MaxDelegations < len(d.Delegations) {
+		return principal.Principal{}, fmt.Errorf("too many delegations: %d", len(d.Delegations))
+	}
+	now := options.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	signer := []byte(d.PublicKey)
+	seen := [][]byte{signer}
+	for i, signedDelegation := range d.Delegations {
+		delegation := signedDelegation.Delegation
+		if uint64(delegation.Expiration) < uint64(now.UnixNano()) {
+			return principal.Principal{}, fmt.Errorf("delegation %d expired", i)
+		}
+		if len(options.Target.Raw) != 0 && len(delegation.Targets) != 0 && !slices.ContainsFunc(delegation.Targets, func(target HexString) bool {
+			return bytes.Equal([]byte(target), options.Target.Raw)
+		}) {
+			return principal.Principal{}, fmt.Errorf("delegation %d does not apply to canister %s", i, options.Target)
+		}
+		message, err := delegation.SignatureMessage()
+		if err != nil {
+			return principal.Principal{}, err
+		}
+		if err := verifySignature(signer, message, []byte(signedDelegation.Signature), options.RootKey); err != nil {
+			return principal.Principal{}, fmt.Errorf("invalid signature of delegation %d: %w", i, err)
+		}
+		signer = []byte(delegation.PublicKey)
+		if slices.ContainsFunc(seen, func(key []byte) bool { return bytes.Equal(key, signer) }) {
+			return principal.Principal{}, fmt.Errorf("delegation %d forms a cycle", i)
+		}
+		seen = append(seen, signer)
+	}
+	if len(options.SessionKey) != 0 && !bytes.Equal(signer, options.SessionKey) {
+		return principal.Principal{}, fmt.Errorf("the chain does not delegate to the session key")
+	}
+	return principal.NewSelfAuthenticating([]byte(d.PublicKey)), nil
+}
+
+// verifySignature verifies the signature of the message by the DER encoded
+// public key, which is either a canister signature public key or a key that is
+// supported by identity.VerifySignature.
+func verifySignature(der, message, sig, rootKey []byte) error {
+	if publicKey, err := CanisterSigPublicKeyFromDER(der); err == nil {
+		return verifyCanisterSignature(publicKey, message, sig, rootKey)
+	}
+	if !identity.VerifySignature(der, message, sig) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// verifyCanisterSignature verifies a canister signature, which is a
+// certificate of the canister together with a hash tree that contains the
+// hash of the message under the hash of the seed.
+func verifyCanisterSignature(publicKey *CanisterSigPublicKey, message, sig, rootKey []byte) error {
+	var wrapper struct {
+		Certificate []byte            `cbor:"certificate"`
+		Tree        hashtree.HashTree `cbor:"tree"`
+	}
+	if err := cbor.Unmarshal(sig, &wrapper); err != nil {
+		return err
+	}
+	var certificate certification.Certificate
+	if err := cbor.Unmarshal(wrapper.Certificate, &certificate); err != nil {
+		return err
+	}
+	tree := wrapper.Tree.Digest()
+	if err := certification.VerifyCertifiedData(
+		certificate,
+		publicKey.CanisterID,
+		rootKey,
+		tree[:],
+	); err != nil {
+		return err
+	}
+	seed := sha256.Sum256(publicKey.Seed)
+	msg := sha256.Sum256(message)
+	if _, err := wrapper.Tree.Lookup(hashtree.Label("sig"), seed[:], msg[:]); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package ii_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go/certification/ii"
+	"github.com/niccolofant/agent-go/identity"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestDelegationChain_Verify(t *testing.T) {
+	root, _ := identity.NewRandomPrime256v1Identity()
+	wallet, _ := identity.NewRandomSecp256k1Identity()
+	session, _ := identity.NewRandomEd25519Identity()
+	target := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	expiration := time.Now().Add(time.Hour)
+
+	chain, err := ii.NewDelegationChain(root, wallet.PublicKey(), expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err = chain.Delegate(wallet, session.PublicKey(), expiration.Add(-time.Minute), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dc ii.DelegationChain
+	if err := json.Unmarshal(data, &dc); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := dc.Verify(ii.VerifyOptions{
+		SessionKey: session.PublicKey(),
+		Target:     target,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Equal(root.Sender()) {
+		t.Errorf("got %s, want %s", p, root.Sender())
+	}
+
+	for _, test := range []struct {
+		name    string
+		options ii.VerifyOptions
+	}{
+		{"session key", ii.VerifyOptions{SessionKey: wallet.PublicKey()}},
+		{"expired", ii.VerifyOptions{CurrentTime: expiration.Add(-time.Second)}},
+		{"target", ii.VerifyOptions{Target: principal.AnonymousID}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := dc.Verify(test.options); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	t.Run("signature", func(t *testing.T) {
+		invalid := dc
+		invalid.Delegations = []ii.SignedDelegation{dc.Delegations[0], dc.Delegations[1]}
+		invalid.Delegations[1].Signature = invalid.Delegations[0].Signature
+		if _, err := invalid.Verify(ii.VerifyOptions{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+	t.Run("hops", func(t *testing.T) {
+		short := dc
+		short.Delegations = dc.Delegations[1:]
+		if _, err := short.Verify(ii.VerifyOptions{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sync/atomic"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/niccolofant/agent-go/principal"
@@ -22,7 +23,9 @@ var icp0, _ = url.Parse("https://icp0.io/")
 // Client is a client for the IC agent.
 type Client struct {
 	client *http.Client
-	routes RouteProvider
+	// routes is shared between copies of the client, so that the route
+	// provider can be replaced at runtime.
+	routes *atomic.Pointer[RouteProvider]
 	logger Logger
 	// callVersion / readStateVersion select the API version segment of the
 	// call and read_state endpoints. The defaults certify canister ranges
@@ -30,17 +33,21 @@ type Client struct {
 	// deprecated /subnet/<subnet_id>/canister_ranges layout.
 	callVersion      string
 	readStateVersion string
+	retryPolicy      RetryPolicy
+	interceptors     []Interceptor
 }
 
 // NewClient creates a new client based on the given configuration.
 func NewClient(options ...ClientOption) Client {
 	c := Client{
 		client:           http.DefaultClient,
-		routes:           StaticRoute(icp0),
+		routes:           new(atomic.Pointer[RouteProvider]),
 		logger:           new(NoopLogger),
 		callVersion:      "v4",
 		readStateVersion: "v3",
+		retryPolicy:      DefaultRetryPolicy,
 	}
+	c.SetRouteProvider(StaticRoute(icp0))
 	for _, o := range options {
 		o(&c)
 	}
@@ -48,30 +55,19 @@ func NewClient(options ...ClientOption) Client {
 }
 
 func (c Client) Call(ctx context.Context, canisterID principal.Principal, data []byte) ([]byte, error) {
-	u, err := c.url(fmt.Sprintf("/api/%s/canister/%s/call", c.callVersion, canisterID.Encode()))
-	if err != nil {
-		return nil, err
-	}
-	c.logger.Printf("[CLIENT] CALL %s", u)
-	req, err := c.newRequest(ctx, "POST", u, bytes.NewReader(data))
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	switch resp.StatusCode {
-	case http.StatusAccepted:
-		return nil, nil
-	case http.StatusOK:
-		body, err := io.ReadAll(resp.Body)
+	op := &Operation{Type: RequestTypeCall, EffectiveCanisterID: canisterID, Envelope: data}
+	return c.intercept(ctx, op, c.call)
+}
+
+func (c Client) call(ctx context.Context, op *Operation) ([]byte, error) {
+	return c.retryPolicy.retry(ctx, RequestTypeCall, c.logger, func() ([]byte, error) {
+		statusCode, body, err := c.send(ctx, fmt.Sprintf("/api/%s/canister/%s/call", c.callVersion, op.EffectiveCanisterID.Encode()), op)
 		if err != nil {
 			return nil, err
 		}
+		if statusCode == http.StatusAccepted {
+			return nil, nil
+		}
 		var reply struct {
 			Status      string `cbor:"status"`
 			Certificate []byte `cbor:"certificate"`
@@ -86,41 +82,50 @@ func (c Client) Call(ctx context.Context, canisterID principal.Principal, data [
 		case "replied":
 			return reply.Certificate, nil
 		case "non_replicated_rejection":
-			return nil, preprocessingError{
-				RejectCode: reply.RejectCode,
+			return nil, &RejectError{
+				RejectCode: RejectCode(reply.RejectCode),
 				Message:    reply.Message,
 				ErrorCode:  reply.ErrorCode,
 			}
 		default:
 			return nil, fmt.Errorf("unknown status: %s", reply.Status)
 		}
-	default:
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("(%d) %s: %s", resp.StatusCode, resp.Status, body)
-	}
+	})
 }
 
 func (c Client) Query(ctx context.Context, canisterID principal.Principal, data []byte) ([]byte, error) {
-	return c.post(ctx, "v2", "query", canisterID, data)
+	op := &Operation{Type: RequestTypeQuery, EffectiveCanisterID: canisterID, Envelope: data}
+	return c.intercept(ctx, op, func(ctx context.Context, op *Operation) ([]byte, error) {
+		return c.post(ctx, fmt.Sprintf("/api/v2/canister/%s/query", op.EffectiveCanisterID.Encode()), op)
+	})
 }
 
 func (c Client) ReadState(ctx context.Context, canisterID principal.Principal, data []byte) ([]byte, error) {
-	return c.post(ctx, c.readStateVersion, "read_state", canisterID, data)
+	op := &Operation{Type: RequestTypeReadState, EffectiveCanisterID: canisterID, Envelope: data}
+	return c.intercept(ctx, op, func(ctx context.Context, op *Operation) ([]byte, error) {
+		return c.post(ctx, fmt.Sprintf("/api/%s/canister/%s/read_state", c.readStateVersion, op.EffectiveCanisterID.Encode()), op)
+	})
 }
 
 func (c Client) ReadSubnetState(ctx context.Context, subnetID principal.Principal, data []byte) ([]byte, error) {
-	return c.postSubnet(ctx, "read_state", subnetID, data)
+	op := &Operation{Type: RequestTypeReadState, SubnetID: subnetID, Envelope: data}
+	return c.intercept(ctx, op, func(ctx context.Context, op *Operation) ([]byte, error) {
+		return c.post(ctx, fmt.Sprintf("/api/v2/subnet/%s/read_state", op.SubnetID.Encode()), op)
+	})
 }
 
 // SetRouteProvider replaces the route provider used to pick a host URL for each
 // outgoing request. Intended for runtime boundary-node selection (e.g. via
-// DiscoverRoutes + RoundRobinRoute); not safe to call concurrently with
-// in-flight requests.
+// NewDiscoveryRoute); safe to call concurrently with in-flight requests, which
+// keep using the previous provider. The provider is shared with all copies of
+// the client, including the one of the agent.
 func (c *Client) SetRouteProvider(rp RouteProvider) {
-	c.routes = rp
+	c.routes.Store(&rp)
+}
+
+// routeProvider returns the current route provider.
+func (c Client) routeProvider() RouteProvider {
+	return *c.routes.Load()
 }
 
 // Status returns the status of the IC.
@@ -134,19 +139,28 @@ func (c Client) Status() (*Status, error) {
 }
 
 func (c Client) get(path string) ([]byte, error) {
-	u, err := c.url(path)
+	host, u, err := c.url(nil, path)
 	if err != nil {
 		return nil, err
 	}
 	c.logger.Printf("[CLIENT] GET %s", u)
 	resp, err := c.client.Get(u)
 	if err != nil {
+		c.report(host, err)
 		return nil, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
-	return io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+	}
+	c.report(host, err)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
 }
 
 func (c Client) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
@@ -158,79 +172,105 @@ func (c Client) newRequest(ctx context.Context, method, url string, body io.Read
 	return req, nil
 }
 
-func (c Client) post(ctx context.Context, version, path string, canisterID principal.Principal, data []byte) ([]byte, error) {
-	u, err := c.url(fmt.Sprintf("/api/%s/canister/%s/%s", version, canisterID.Encode(), path))
-	if err != nil {
-		return nil, err
-	}
-	c.logger.Printf("[CLIENT] POST %s", u)
-	req, err := c.newRequest(ctx, "POST", u, bytes.NewReader(data))
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-	switch resp.StatusCode {
-	case http.StatusOK:
-		return io.ReadAll(resp.Body)
-	default:
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("(%d) %s: %s", resp.StatusCode, resp.Status, body)
-	}
+// post sends the envelope of the operation to the given path and returns the
+// body of the response, retrying according to the retry policy of the client.
+func (c Client) post(ctx context.Context, path string, op *Operation) ([]byte, error) {
+	return c.retryPolicy.retry(ctx, op.Type, c.logger, func() ([]byte, error) {
+		_, body, err := c.send(ctx, path, op)
+		return body, err
+	})
 }
 
-func (c Client) postSubnet(ctx context.Context, path string, subnetID principal.Principal, data []byte) ([]byte, error) {
-	u, err := c.url(fmt.Sprintf("/api/v2/subnet/%s/%s", subnetID.Encode(), path))
+// send sends the envelope of the operation to the given path once. Responses
+// other than 200 OK and 202 Accepted are returned as an HTTPError.
+func (c Client) send(ctx context.Context, path string, op *Operation) (int, []byte, error) {
+	host, u, err := c.url(op, path)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
+	statusCode, body, err := c.do(ctx, u, op)
+	c.report(host, err)
+	return statusCode, body, err
+}
+
+// do posts the envelope of the operation to the given URL.
+func (c Client) do(ctx context.Context, u string, op *Operation) (int, []byte, error) {
 	c.logger.Printf("[CLIENT] POST %s", u)
-	req, err := c.newRequest(ctx, "POST", u, bytes.NewReader(data))
+	req, err := c.newRequest(ctx, "POST", u, bytes.NewReader(op.Envelope))
 	if err != nil {
-		return nil, err
+		return 0, nil, err
+	}
+	for k, v := range op.Header {
+		req.Header[k] = v
 	}
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
 	switch resp.StatusCode {
-	case http.StatusOK:
-		return io.ReadAll(resp.Body)
+	case http.StatusOK, http.StatusAccepted:
+		return resp.StatusCode, body, nil
 	default:
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("(%d) %s: %s", resp.StatusCode, resp.Status, body)
+		return 0, nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
 	}
 }
 
-func (c Client) url(p string) (string, error) {
-	host, err := c.routes.Route()
+// url returns the host that is selected by the route provider and the URL of
+// the given path on that host. The operation is nil for requests that are not
+// sent to a canister or subnet, like status requests.
+func (c Client) url(op *Operation, p string) (*url.URL, string, error) {
+	var (
+		host *url.URL
+		err  error
+	)
+	if rp, ok := c.routeProvider().(CanisterRouteProvider); ok && op != nil && op.SubnetID.Raw == nil {
+		host, err = rp.RouteCanister(op.EffectiveCanisterID)
+	} else {
+		host, err = c.routeProvider().Route()
+	}
 	if err != nil {
-		return "", fmt.Errorf("route: %w", err)
+		return nil, "", fmt.Errorf("route: %w", err)
 	}
 	u := *host
 	u.Path = path.Join(u.Path, p)
-	return u.String(), nil
+	return host, u.String(), nil
+}
+
+// untrusted returns whether the route provider sends requests to untrusted
+// hosts.
+func (c Client) untrusted() bool {
+	rp, ok := c.routeProvider().(UntrustedRouteProvider)
+	return ok && rp.Untrusted()
+}
+
+// report reports the result of a request to the route provider, if it
+// implements RouteFeedback.
+func (c Client) report(host *url.URL, err error) {
+	if feedback, ok := c.routeProvider().(RouteFeedback); ok {
+		feedback.ReportResult(host, err)
+	}
 }
 
 type ClientOption func(c *Client)
 
 func WithHostURL(host *url.URL) ClientOption {
 	return func(c *Client) {
-		c.routes = StaticRoute(host)
+		c.SetRouteProvider(StaticRoute(host))
+	}
+}
+
+// WithRouteProvider sets the route provider that picks the host URL for each
+// request, e.g. a HealthAwareRoute.
+func WithRouteProvider(rp RouteProvider) ClientOption {
+	return func(c *Client) {
+		c.SetRouteProvider(rp)
 	}
 }
 
@@ -246,6 +286,13 @@ func WithLogger(logger Logger) ClientOption {
 	}
 }
 
+// WithRetryPolicy sets the policy used to retry requests on transient failures.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
 // WithLegacyAPI uses the deprecated /api/v3 call and /api/v2 read_state
 // endpoints instead of the defaults (/api/v4 call, /api/v3 read_state).
 func WithLegacyAPI() ClientOption {
@@ -254,16 +301,3 @@ func WithLegacyAPI() ClientOption {
 		c.readStateVersion = "v2"
 	}
 }
-
-type preprocessingError struct {
-	// The reject code.
-	RejectCode uint64 `cbor:"reject_code"`
-	// A textual diagnostic message.
-	Message string `cbor:"reject_message"`
-	// An optional implementation-specific textual error code.
-	ErrorCode string `cbor:"error_code"`
-}
-
-func (e preprocessingError) Error() string {
-	return fmt.Sprintf("(%d) %s: %s", e.RejectCode, e.Message, e.ErrorCode)
-}
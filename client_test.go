@@ -71,3 +71,46 @@ func TestClientLegacyAPI(t *testing.T) {
 		t.Fatalf("read_state: got %q, want %q", *readPath, want)
 	}
 }
+
+func TestClientCanisterRouteProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := cbor.Marshal(map[string]any{"status": "replied", "certificate": []byte{}})
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	host, _ := url.Parse(srv.URL)
+	rp := &canisterRoute{host: host}
+	c := agent.NewClient(agent.WithRouteProvider(rp))
+
+	cid := principal.MustDecode("aaaaa-aa")
+	if _, err := c.Call(context.Background(), cid, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(rp.canisters) != 1 || !rp.canisters[0].Equal(cid) {
+		t.Fatalf("expected the effective canister ID to be routed, got %v", rp.canisters)
+	}
+	subnetID := principal.MustDecode("tdb26-jop6k-aogll-7ltgs-eruif-6kk7m-qpktf-gdiqx-mxtrf-vb5e6-eqe")
+	if _, err := c.ReadSubnetState(context.Background(), subnetID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(rp.canisters) != 1 || rp.routes != 1 {
+		t.Fatalf("expected subnet requests to use Route, got %d canister routes and %d routes", len(rp.canisters), rp.routes)
+	}
+}
+
+// canisterRoute records the routed requests.
+type canisterRoute struct {
+	host      *url.URL
+	canisters []principal.Principal
+	routes    int
+}
+
+func (r *canisterRoute) Route() (*url.URL, error) {
+	r.routes++
+	return r.host, nil
+}
+
+func (r *canisterRoute) RouteCanister(ecID principal.Principal) (*url.URL, error) {
+	r.canisters = append(r.canisters, ecID)
+	return r.host, nil
+}
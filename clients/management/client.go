@@ -0,0 +1,161 @@
+package management
+
+import (
+	"context"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// MANAGEMENT_PRINCIPAL is the principal of the management canister (aaaaa-aa).
+var MANAGEMENT_PRINCIPAL = principal.MustDecode("aaaaa-aa")
+
+// Client is a client for the management canister.
+//
+// The management canister is not hosted on a single subnet, so every request
+// has to be routed by an effective canister ID. Methods whose argument carries
+// the target canister derive it from that argument (canister_id, or
+// target_canister for install_chunked_code); the others take it explicitly.
+type Client struct {
+	a *agent.Agent
+}
+
+// New creates a new management canister client on top of the given agent.
+func New(a *agent.Agent) *Client {
+	return &Client{a: a}
+}
+
+// CanisterInfo calls the "canister_info" method.
+func (c *Client) CanisterInfo(ctx context.Context, args CanisterInfoArgs) (*CanisterInfoResult, error) {
+	var r CanisterInfoResult
+	if err := c.call(ctx, args.CanisterId, "canister_info", args, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CanisterStatus calls the "canister_status" method.
+func (c *Client) CanisterStatus(ctx context.Context, args CanisterStatusArgs) (*CanisterStatusResult, error) {
+	var r CanisterStatusResult
+	if err := c.call(ctx, args.CanisterId, "canister_status", args, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ClearChunkStore calls the "clear_chunk_store" method.
+func (c *Client) ClearChunkStore(ctx context.Context, args ClearChunkStoreArgs) error {
+	return c.call(ctx, args.CanisterId, "clear_chunk_store", args)
+}
+
+// CreateCanister calls the "create_canister" method. The effective canister ID
+// can be any canister on the subnet the new canister should be created on.
+func (c *Client) CreateCanister(ctx context.Context, effectiveCanisterID principal.Principal, args CreateCanisterArgs) (*CreateCanisterResult, error) {
+	var r CreateCanisterResult
+	if err := c.call(ctx, effectiveCanisterID, "create_canister", args, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// DeleteCanister calls the "delete_canister" method.
+func (c *Client) DeleteCanister(ctx context.Context, args DeleteCanisterArgs) error {
+	return c.call(ctx, args.CanisterId, "delete_canister", args)
+}
+
+// DepositCycles calls the "deposit_cycles" method.
+func (c *Client) DepositCycles(ctx context.Context, args DepositCyclesArgs) error {
+	return c.call(ctx, args.CanisterId, "deposit_cycles", args)
+}
+
+// InstallChunkedCode calls the "install_chunked_code" method. The request is
+// routed to the target canister.
+func (c *Client) InstallChunkedCode(ctx context.Context, args InstallChunkedCodeArgs) error {
+	return c.call(ctx, args.TargetCanister, "install_chunked_code", args)
+}
+
+// InstallCode calls the "install_code" method.
+func (c *Client) InstallCode(ctx context.Context, args InstallCodeArgs) error {
+	return c.call(ctx, args.CanisterId, "install_code", args)
+}
+
+// ProvisionalCreateCanisterWithCycles calls the "provisional_create_canister_with_cycles" method.
+// If a specified ID is given, it is used as the effective canister ID; otherwise
+// the given effective canister ID is used.
+func (c *Client) ProvisionalCreateCanisterWithCycles(ctx context.Context, effectiveCanisterID principal.Principal, args ProvisionalCreateCanisterWithCyclesArgs) (*ProvisionalCreateCanisterWithCyclesResult, error) {
+	if args.SpecifiedId != nil {
+		effectiveCanisterID = *args.SpecifiedId
+	}
+	var r ProvisionalCreateCanisterWithCyclesResult
+	if err := c.call(ctx, effectiveCanisterID, "provisional_create_canister_with_cycles", args, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ProvisionalTopUpCanister calls the "provisional_top_up_canister" method.
+func (c *Client) ProvisionalTopUpCanister(ctx context.Context, args ProvisionalTopUpCanisterArgs) error {
+	return c.call(ctx, args.CanisterId, "provisional_top_up_canister", args)
+}
+
+// RawRand calls the "raw_rand" method. The effective canister ID selects the
+// subnet that generates the randomness.
+func (c *Client) RawRand(ctx context.Context, effectiveCanisterID principal.Principal) (RawRandResult, error) {
+	var r RawRandResult
+	req, err := c.a.CreateCandidAPIRequest(agent.RequestTypeCall, MANAGEMENT_PRINCIPAL, "raw_rand")
+	if err != nil {
+		return nil, err
+	}
+	if err := req.WithEffectiveCanisterID(effectiveCanisterID).CallAndWaitWithContext(ctx, []any{&r}); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// StartCanister calls the "start_canister" method.
+func (c *Client) StartCanister(ctx context.Context, args StartCanisterArgs) error {
+	return c.call(ctx, args.CanisterId, "start_canister", args)
+}
+
+// StopCanister calls the "stop_canister" method.
+func (c *Client) StopCanister(ctx context.Context, args StopCanisterArgs) error {
+	return c.call(ctx, args.CanisterId, "stop_canister", args)
+}
+
+// StoredChunks calls the "stored_chunks" method.
+func (c *Client) StoredChunks(ctx context.Context, args StoredChunksArgs) (StoredChunksResult, error) {
+	var r StoredChunksResult
+	if err := c.call(ctx, args.CanisterId, "stored_chunks", args, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UninstallCode calls the "uninstall_code" method.
+func (c *Client) UninstallCode(ctx context.Context, args UninstallCodeArgs) error {
+	return c.call(ctx, args.CanisterId, "uninstall_code", args)
+}
+
+// UpdateSettings calls the "update_settings" method.
+func (c *Client) UpdateSettings(ctx context.Context, args UpdateSettingsArgs) error {
+	return c.call(ctx, args.CanisterId, "update_settings", args)
+}
+
+// UploadChunk calls the "upload_chunk" method.
+func (c *Client) UploadChunk(ctx context.Context, args UploadChunkArgs) (*UploadChunkResult, error) {
+	var r UploadChunkResult
+	if err := c.call(ctx, args.CanisterId, "upload_chunk", args, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// call sends an update call with a single argument to the management canister,
+// routed through the given effective canister ID.
+func (c *Client) call(ctx context.Context, effectiveCanisterID principal.Principal, methodName string, arg any, out ...any) error {
+	req, err := c.a.CreateCandidAPIRequest(agent.RequestTypeCall, MANAGEMENT_PRINCIPAL, methodName, arg)
+	if err != nil {
+		return err
+	}
+	return req.WithEffectiveCanisterID(effectiveCanisterID).CallAndWaitWithContext(ctx, out)
+}
@@ -0,0 +1,163 @@
+package management_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/candid"
+	"github.com/niccolofant/agent-go/candid/idl"
+	"github.com/niccolofant/agent-go/clients/management"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestClient_effectiveCanisterID(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	ecID := principal.MustDecode("rwlgt-iiaaa-aaaaa-aaaaa-cai")
+	for _, test := range []struct {
+		method string
+		ecID   principal.Principal
+		call   func(c *management.Client) error
+	}{
+		{
+			method: "canister_status",
+			ecID:   canisterID,
+			call: func(c *management.Client) error {
+				_, err := c.CanisterStatus(context.Background(), management.CanisterStatusArgs{CanisterId: canisterID})
+				return err
+			},
+		},
+		{
+			method: "install_chunked_code",
+			ecID:   canisterID,
+			call: func(c *management.Client) error {
+				return c.InstallChunkedCode(context.Background(), management.InstallChunkedCodeArgs{
+					Mode:           management.CanisterInstallMode{Install: new(idl.Null)},
+					TargetCanister: canisterID,
+					StoreCanister:  &ecID,
+				})
+			},
+		},
+		{
+			method: "create_canister",
+			ecID:   ecID,
+			call: func(c *management.Client) error {
+				_, err := c.CreateCanister(context.Background(), ecID, management.CreateCanisterArgs{})
+				return err
+			},
+		},
+		{
+			method: "provisional_create_canister_with_cycles",
+			ecID:   canisterID,
+			call: func(c *management.Client) error {
+				_, err := c.ProvisionalCreateCanisterWithCycles(context.Background(), ecID, management.ProvisionalCreateCanisterWithCyclesArgs{
+					SpecifiedId: &canisterID,
+				})
+				return err
+			},
+		},
+		{
+			method: "raw_rand",
+			ecID:   ecID,
+			call: func(c *management.Client) error {
+				_, err := c.RawRand(context.Background(), ecID)
+				return err
+			},
+		},
+	} {
+		t.Run(test.method, func(t *testing.T) {
+			var (
+				gotPath   string
+				gotMethod string
+				gotTarget []byte
+				gotArg    []byte
+			)
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				var envelope struct {
+					Content struct {
+						CanisterID []byte `cbor:"canister_id"`
+						MethodName string `cbor:"method_name"`
+						Arg        []byte `cbor:"arg"`
+					} `cbor:"content"`
+				}
+				if err := cbor.NewDecoder(r.Body).Decode(&envelope); err != nil {
+					t.Error(err)
+				}
+				gotTarget = envelope.Content.CanisterID
+				gotMethod = envelope.Content.MethodName
+				gotArg = envelope.Content.Arg
+				raw, _ := cbor.Marshal(map[string]any{
+					"status":         "non_replicated_rejection",
+					"reject_code":    uint64(3),
+					"reject_message": "test",
+				})
+				_, _ = w.Write(raw)
+			})
+			if err := test.call(c); err == nil || !strings.Contains(err.Error(), "test") {
+				t.Fatalf("expected rejection, got %v", err)
+			}
+			if want := "/api/v4/canister/" + test.ecID.Encode() + "/call"; gotPath != want {
+				t.Errorf("path = %s, want %s", gotPath, want)
+			}
+			if gotMethod != test.method {
+				t.Errorf("method = %s, want %s", gotMethod, test.method)
+			}
+			if gotTarget == nil || len(gotTarget) != 0 {
+				t.Errorf("canister ID = %x, want aaaaa-aa", gotTarget)
+			}
+			if _, _, err := candid.Decode(gotArg); err != nil {
+				t.Errorf("invalid candid argument: %v", err)
+			}
+		})
+	}
+}
+
+func TestInstallCodeArgs(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	args := management.InstallCodeArgs{
+		Mode:       management.CanisterInstallMode{Reinstall: new(idl.Null)},
+		CanisterId: canisterID,
+		WasmModule: []byte{0x00, 0x61, 0x73, 0x6d},
+		Arg:        []byte{},
+	}
+	raw, err := candid.Marshal([]any{args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got management.InstallCodeArgs
+	if err := candid.Unmarshal(raw, []any{&got}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode.Reinstall == nil || got.Mode.Install != nil || got.Mode.Upgrade != nil {
+		t.Errorf("unexpected mode: %+v", got.Mode)
+	}
+	if !got.CanisterId.Equal(canisterID) {
+		t.Errorf("canister ID = %s, want %s", got.CanisterId, canisterID)
+	}
+	if string(got.WasmModule) != string(args.WasmModule) {
+		t.Errorf("wasm module = %x, want %x", got.WasmModule, args.WasmModule)
+	}
+}
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *management.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	host, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := agent.New(agent.Config{
+		ClientConfig: []agent.ClientOption{agent.WithHostURL(host)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return management.New(a)
+}
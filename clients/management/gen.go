@@ -0,0 +1,4 @@
+package management
+
+//go:generate go run ../../cmd/goic generate did testdata/ic.did management --typesOnly --output=types.go
+//go:generate gofmt -s -w types.go
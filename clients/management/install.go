@@ -0,0 +1,151 @@
+package management
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/niccolofant/agent-go/principal"
+)
+
+const (
+	// ChunkSize is the maximum size of a single chunk in the chunk store of a canister.
+	ChunkSize = 1 << 20
+	// uploadConcurrency is the maximum number of chunks that are uploaded in parallel.
+	uploadConcurrency = 4
+)
+
+// InstallWasm installs the given Wasm module on the given canister.
+//
+// Modules that fit in a single chunk are installed directly with install_code.
+// Larger modules are split into chunks of ChunkSize, uploaded in parallel to
+// the chunk store of the canister and installed with install_chunked_code.
+// Chunks that are already present in the chunk store are not uploaded again,
+// so a failed installation can be retried without re-uploading everything.
+//
+// After the installation the module hash of the canister is verified against
+// the hash of the given module, and the chunk store is cleared.
+func (c *Client) InstallWasm(ctx context.Context, canisterID principal.Principal, wasm []byte, mode CanisterInstallMode, arg []byte) error {
+	if arg == nil {
+		arg = []byte{}
+	}
+	moduleHash := sha256.Sum256(wasm)
+	if len(wasm) <= ChunkSize {
+		if err := c.InstallCode(ctx, InstallCodeArgs{
+			Mode:       mode,
+			CanisterId: canisterID,
+			WasmModule: wasm,
+			Arg:        arg,
+		}); err != nil {
+			return err
+		}
+		return c.verifyModuleHash(canisterID, moduleHash[:])
+	}
+
+	chunks := splitChunks(wasm, ChunkSize)
+	if err := c.uploadChunks(ctx, canisterID, chunks); err != nil {
+		return err
+	}
+	hashes := make([]ChunkHash, len(chunks))
+	for i, chunk := range chunks {
+		h := sha256.Sum256(chunk)
+		hashes[i] = ChunkHash{Hash: h[:]}
+	}
+	if err := c.InstallChunkedCode(ctx, InstallChunkedCodeArgs{
+		Mode:            mode,
+		TargetCanister:  canisterID,
+		ChunkHashesList: hashes,
+		WasmModuleHash:  moduleHash[:],
+		Arg:             arg,
+	}); err != nil {
+		return err
+	}
+	if err := c.verifyModuleHash(canisterID, moduleHash[:]); err != nil {
+		return err
+	}
+	return c.ClearChunkStore(ctx, ClearChunkStoreArgs{CanisterId: canisterID})
+}
+
+// uploadChunks uploads the chunks that are not yet in the chunk store of the
+// given canister.
+func (c *Client) uploadChunks(ctx context.Context, canisterID principal.Principal, chunks [][]byte) error {
+	stored, err := c.StoredChunks(ctx, StoredChunksArgs{CanisterId: canisterID})
+	if err != nil {
+		return fmt.Errorf("failed to get stored chunks: %w", err)
+	}
+	storedHashes := make(map[[32]byte]struct{}, len(stored))
+	for _, h := range stored {
+		if len(h.Hash) == sha256.Size {
+			storedHashes[[32]byte(h.Hash)] = struct{}{}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		sem      = make(chan struct{}, uploadConcurrency)
+	)
+	for i, chunk := range chunks {
+		hash := sha256.Sum256(chunk)
+		if _, ok := storedHashes[hash]; ok {
+			continue
+		}
+		storedHashes[hash] = struct{}{} // Identical chunks only need to be uploaded once.
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			r, err := c.UploadChunk(ctx, UploadChunkArgs{CanisterId: canisterID, Chunk: chunk})
+			if err == nil && !bytes.Equal(r.Hash, hash[:]) {
+				err = fmt.Errorf("invalid hash: got %x, expected %x", r.Hash, hash)
+			}
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("failed to upload chunk %d: %w", i, err)
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func (c *Client) verifyModuleHash(canisterID principal.Principal, moduleHash []byte) error {
+	h, err := c.a.GetCanisterModuleHash(canisterID)
+	if err != nil {
+		return fmt.Errorf("failed to get module hash: %w", err)
+	}
+	if !bytes.Equal(h, moduleHash) {
+		return fmt.Errorf("invalid module hash: got %x, expected %x", h, moduleHash)
+	}
+	return nil
+}
+
+// splitChunks splits the given data into chunks of at most size bytes.
+func splitChunks(data []byte, size int) [][]byte {
+	chunks := make([][]byte, 0, (len(data)+size-1)/size)
+	for size < len(data) {
+		chunks = append(chunks, data[:size:size])
+		data = data[size:]
+	}
+	return append(chunks, data)
+}
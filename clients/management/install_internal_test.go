@@ -0,0 +1,33 @@
+package management
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitChunks(t *testing.T) {
+	for _, test := range []struct {
+		size int
+		want []int
+	}{
+		{size: 0, want: []int{0}},
+		{size: 3, want: []int{3}},
+		{size: 4, want: []int{4}},
+		{size: 5, want: []int{4, 1}},
+		{size: 12, want: []int{4, 4, 4}},
+	} {
+		data := bytes.Repeat([]byte{0x01}, test.size)
+		chunks := splitChunks(data, 4)
+		if len(chunks) != len(test.want) {
+			t.Fatalf("size %d: got %d chunks, want %d", test.size, len(chunks), len(test.want))
+		}
+		for i, chunk := range chunks {
+			if len(chunk) != test.want[i] {
+				t.Errorf("size %d: chunk %d has length %d, want %d", test.size, i, len(chunk), test.want[i])
+			}
+		}
+		if got := bytes.Join(chunks, nil); !bytes.Equal(got, data) {
+			t.Errorf("size %d: chunks do not add up to the original data", test.size)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package management_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/candid/idl"
+	"github.com/niccolofant/agent-go/clients/management"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestClient_InstallWasm(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	for _, test := range []struct {
+		name string
+		size int
+		// stored are the indexes of the chunks that are already in the chunk
+		// store.
+		stored  []int
+		uploads int
+	}{
+		{name: "small", size: 1024},
+		// Three chunks, the first two are identical.
+		{name: "chunked", size: 2*management.ChunkSize + 1, uploads: 2},
+		// Stored chunks are not uploaded again.
+		{name: "resumed", size: 2*management.ChunkSize + 1, stored: []int{2}, uploads: 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := agenttest.NewReplica()
+			defer r.Close()
+
+			var (
+				mu      sync.Mutex
+				store   = make(map[[32]byte][]byte)
+				uploads int
+			)
+			wasm := make([]byte, test.size)
+			wasm[len(wasm)-1] = 0x01
+			for _, i := range test.stored {
+				chunk := wasm[i*management.ChunkSize : min((i+1)*management.ChunkSize, len(wasm))]
+				store[sha256.Sum256(chunk)] = chunk
+			}
+			install := func(canister principal.Principal, wasm []byte) {
+				h := sha256.Sum256(wasm)
+				r.SetModuleHash(canister, h[:])
+			}
+			r.HandleUpdate(management.MANAGEMENT_PRINCIPAL, "install_code", func(call agenttest.Call) ([]any, error) {
+				var args management.InstallCodeArgs
+				if err := call.Decode(&args); err != nil {
+					return nil, err
+				}
+				install(args.CanisterId, args.WasmModule)
+				return nil, nil
+			})
+			r.HandleUpdate(management.MANAGEMENT_PRINCIPAL, "stored_chunks", func(call agenttest.Call) ([]any, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				hashes := management.StoredChunksResult{}
+				for h := range store {
+					hashes = append(hashes, management.ChunkHash{Hash: h[:]})
+				}
+				return []any{hashes}, nil
+			})
+			r.HandleUpdate(management.MANAGEMENT_PRINCIPAL, "upload_chunk", func(call agenttest.Call) ([]any, error) {
+				var args management.UploadChunkArgs
+				if err := call.Decode(&args); err != nil {
+					return nil, err
+				}
+				h := sha256.Sum256(args.Chunk)
+				mu.Lock()
+				defer mu.Unlock()
+				store[h] = args.Chunk
+				uploads++
+				return []any{management.UploadChunkResult{Hash: h[:]}}, nil
+			})
+			r.HandleUpdate(management.MANAGEMENT_PRINCIPAL, "install_chunked_code", func(call agenttest.Call) ([]any, error) {
+				var args management.InstallChunkedCodeArgs
+				if err := call.Decode(&args); err != nil {
+					return nil, err
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				var wasm []byte
+				for _, h := range args.ChunkHashesList {
+					chunk, ok := store[[32]byte(h.Hash)]
+					if !ok {
+						return nil, fmt.Errorf("chunk not found: %x", h.Hash)
+					}
+					wasm = append(wasm, chunk...)
+				}
+				if h := sha256.Sum256(wasm); !bytes.Equal(h[:], args.WasmModuleHash) {
+					return nil, fmt.Errorf("invalid module hash")
+				}
+				install(args.TargetCanister, wasm)
+				return nil, nil
+			})
+			r.HandleUpdate(management.MANAGEMENT_PRINCIPAL, "clear_chunk_store", func(call agenttest.Call) ([]any, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				clear(store)
+				return nil, nil
+			})
+
+			a, err := agent.New(r.AgentConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := management.New(a).InstallWasm(
+				context.Background(),
+				canisterID,
+				wasm,
+				management.CanisterInstallMode{Install: new(idl.Null)},
+				nil,
+			); err != nil {
+				t.Fatal(err)
+			}
+			if uploads != test.uploads {
+				t.Errorf("uploads = %d, want %d", uploads, test.uploads)
+			}
+			if len(store) != 0 {
+				t.Errorf("chunk store not cleared: %d chunks", len(store))
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+// Package management provides the types of the "management" canister.
+// Do NOT edit this file. It was automatically generated by https://github.com/niccolofant/agent-go.
+package management
+
+import (
+	"github.com/niccolofant/agent-go/candid/idl"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+type CanisterId = principal.Principal
+
+type WasmModule = []byte
+
+type LogVisibility struct {
+	Controllers    *idl.Null              `ic:"controllers,variant" json:"controllers,omitempty"`
+	Public         *idl.Null              `ic:"public,variant" json:"public,omitempty"`
+	AllowedViewers *[]principal.Principal `ic:"allowed_viewers,variant" json:"allowed_viewers,omitempty"`
+}
+
+type CanisterSettings struct {
+	Controllers         *[]principal.Principal `ic:"controllers,omitempty" json:"controllers,omitempty"`
+	ComputeAllocation   *idl.Nat               `ic:"compute_allocation,omitempty" json:"compute_allocation,omitempty"`
+	MemoryAllocation    *idl.Nat               `ic:"memory_allocation,omitempty" json:"memory_allocation,omitempty"`
+	FreezingThreshold   *idl.Nat               `ic:"freezing_threshold,omitempty" json:"freezing_threshold,omitempty"`
+	ReservedCyclesLimit *idl.Nat               `ic:"reserved_cycles_limit,omitempty" json:"reserved_cycles_limit,omitempty"`
+	LogVisibility       *LogVisibility         `ic:"log_visibility,omitempty" json:"log_visibility,omitempty"`
+	WasmMemoryLimit     *idl.Nat               `ic:"wasm_memory_limit,omitempty" json:"wasm_memory_limit,omitempty"`
+}
+
+type DefiniteCanisterSettings struct {
+	Controllers         []principal.Principal `ic:"controllers" json:"controllers"`
+	ComputeAllocation   idl.Nat               `ic:"compute_allocation" json:"compute_allocation"`
+	MemoryAllocation    idl.Nat               `ic:"memory_allocation" json:"memory_allocation"`
+	FreezingThreshold   idl.Nat               `ic:"freezing_threshold" json:"freezing_threshold"`
+	ReservedCyclesLimit idl.Nat               `ic:"reserved_cycles_limit" json:"reserved_cycles_limit"`
+	LogVisibility       LogVisibility         `ic:"log_visibility" json:"log_visibility"`
+	WasmMemoryLimit     idl.Nat               `ic:"wasm_memory_limit" json:"wasm_memory_limit"`
+}
+
+type ChangeOrigin struct {
+	FromUser *struct {
+		UserId principal.Principal `ic:"user_id" json:"user_id"`
+	} `ic:"from_user,variant" json:"from_user,omitempty"`
+	FromCanister *struct {
+		CanisterId      principal.Principal `ic:"canister_id" json:"canister_id"`
+		CanisterVersion *uint64             `ic:"canister_version,omitempty" json:"canister_version,omitempty"`
+	} `ic:"from_canister,variant" json:"from_canister,omitempty"`
+}
+
+type ChangeDetails struct {
+	Creation *struct {
+		Controllers []principal.Principal `ic:"controllers" json:"controllers"`
+	} `ic:"creation,variant" json:"creation,omitempty"`
+	CodeUninstall  *idl.Null `ic:"code_uninstall,variant" json:"code_uninstall,omitempty"`
+	CodeDeployment *struct {
+		Mode struct {
+			Install   *idl.Null `ic:"install,variant" json:"install,omitempty"`
+			Reinstall *idl.Null `ic:"reinstall,variant" json:"reinstall,omitempty"`
+			Upgrade   *idl.Null `ic:"upgrade,variant" json:"upgrade,omitempty"`
+		} `ic:"mode" json:"mode"`
+		ModuleHash []byte `ic:"module_hash" json:"module_hash"`
+	} `ic:"code_deployment,variant" json:"code_deployment,omitempty"`
+	ControllersChange *struct {
+		Controllers []principal.Principal `ic:"controllers" json:"controllers"`
+	} `ic:"controllers_change,variant" json:"controllers_change,omitempty"`
+}
+
+type Change struct {
+	TimestampNanos  uint64        `ic:"timestamp_nanos" json:"timestamp_nanos"`
+	CanisterVersion uint64        `ic:"canister_version" json:"canister_version"`
+	Origin          ChangeOrigin  `ic:"origin" json:"origin"`
+	Details         ChangeDetails `ic:"details" json:"details"`
+}
+
+type ChunkHash struct {
+	Hash []byte `ic:"hash" json:"hash"`
+}
+
+type HttpHeader struct {
+	Name  string `ic:"name" json:"name"`
+	Value string `ic:"value" json:"value"`
+}
+
+type HttpRequestResult struct {
+	Status  idl.Nat      `ic:"status" json:"status"`
+	Headers []HttpHeader `ic:"headers" json:"headers"`
+	Body    []byte       `ic:"body" json:"body"`
+}
+
+type EcdsaCurve struct {
+	Secp256k1 *idl.Null `ic:"secp256k1,variant" json:"secp256k1,omitempty"`
+}
+
+type SchnorrAlgorithm struct {
+	Bip340secp256k1 *idl.Null `ic:"bip340secp256k1,variant" json:"bip340secp256k1,omitempty"`
+	Ed25519         *idl.Null `ic:"ed25519,variant" json:"ed25519,omitempty"`
+}
+
+type CreateCanisterArgs struct {
+	Settings              *CanisterSettings `ic:"settings,omitempty" json:"settings,omitempty"`
+	SenderCanisterVersion *uint64           `ic:"sender_canister_version,omitempty" json:"sender_canister_version,omitempty"`
+}
+
+type CreateCanisterResult struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type UpdateSettingsArgs struct {
+	CanisterId            principal.Principal `ic:"canister_id" json:"canister_id"`
+	Settings              CanisterSettings    `ic:"settings" json:"settings"`
+	SenderCanisterVersion *uint64             `ic:"sender_canister_version,omitempty" json:"sender_canister_version,omitempty"`
+}
+
+type UploadChunkArgs struct {
+	CanisterId principal.Principal `ic:"canister_id" json:"canister_id"`
+	Chunk      []byte              `ic:"chunk" json:"chunk"`
+}
+
+type ClearChunkStoreArgs struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type StoredChunksArgs struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type CanisterInstallMode struct {
+	Install   *idl.Null `ic:"install,variant" json:"install,omitempty"`
+	Reinstall *idl.Null `ic:"reinstall,variant" json:"reinstall,omitempty"`
+	Upgrade   **struct {
+		SkipPreUpgrade        *bool `ic:"skip_pre_upgrade,omitempty" json:"skip_pre_upgrade,omitempty"`
+		WasmMemoryPersistence *struct {
+			Keep    *idl.Null `ic:"keep,variant" json:"keep,omitempty"`
+			Replace *idl.Null `ic:"replace,variant" json:"replace,omitempty"`
+		} `ic:"wasm_memory_persistence,omitempty" json:"wasm_memory_persistence,omitempty"`
+	} `ic:"upgrade,variant" json:"upgrade,omitempty"`
+}
+
+type InstallCodeArgs struct {
+	Mode                  CanisterInstallMode `ic:"mode" json:"mode"`
+	CanisterId            CanisterId          `ic:"canister_id" json:"canister_id"`
+	WasmModule            WasmModule          `ic:"wasm_module" json:"wasm_module"`
+	Arg                   []byte              `ic:"arg" json:"arg"`
+	SenderCanisterVersion *uint64             `ic:"sender_canister_version,omitempty" json:"sender_canister_version,omitempty"`
+}
+
+type InstallChunkedCodeArgs struct {
+	Mode                  CanisterInstallMode `ic:"mode" json:"mode"`
+	TargetCanister        CanisterId          `ic:"target_canister" json:"target_canister"`
+	StoreCanister         *CanisterId         `ic:"store_canister,omitempty" json:"store_canister,omitempty"`
+	ChunkHashesList       []ChunkHash         `ic:"chunk_hashes_list" json:"chunk_hashes_list"`
+	WasmModuleHash        []byte              `ic:"wasm_module_hash" json:"wasm_module_hash"`
+	Arg                   []byte              `ic:"arg" json:"arg"`
+	SenderCanisterVersion *uint64             `ic:"sender_canister_version,omitempty" json:"sender_canister_version,omitempty"`
+}
+
+type UninstallCodeArgs struct {
+	CanisterId            CanisterId `ic:"canister_id" json:"canister_id"`
+	SenderCanisterVersion *uint64    `ic:"sender_canister_version,omitempty" json:"sender_canister_version,omitempty"`
+}
+
+type StartCanisterArgs struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type StopCanisterArgs struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type CanisterStatusArgs struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type CanisterStatusResult struct {
+	Status struct {
+		Running  *idl.Null `ic:"running,variant" json:"running,omitempty"`
+		Stopping *idl.Null `ic:"stopping,variant" json:"stopping,omitempty"`
+		Stopped  *idl.Null `ic:"stopped,variant" json:"stopped,omitempty"`
+	} `ic:"status" json:"status"`
+	Settings               DefiniteCanisterSettings `ic:"settings" json:"settings"`
+	ModuleHash             *[]byte                  `ic:"module_hash,omitempty" json:"module_hash,omitempty"`
+	MemorySize             idl.Nat                  `ic:"memory_size" json:"memory_size"`
+	Cycles                 idl.Nat                  `ic:"cycles" json:"cycles"`
+	ReservedCycles         idl.Nat                  `ic:"reserved_cycles" json:"reserved_cycles"`
+	IdleCyclesBurnedPerDay idl.Nat                  `ic:"idle_cycles_burned_per_day" json:"idle_cycles_burned_per_day"`
+	QueryStats             struct {
+		NumCallsTotal             idl.Nat `ic:"num_calls_total" json:"num_calls_total"`
+		NumInstructionsTotal      idl.Nat `ic:"num_instructions_total" json:"num_instructions_total"`
+		RequestPayloadBytesTotal  idl.Nat `ic:"request_payload_bytes_total" json:"request_payload_bytes_total"`
+		ResponsePayloadBytesTotal idl.Nat `ic:"response_payload_bytes_total" json:"response_payload_bytes_total"`
+	} `ic:"query_stats" json:"query_stats"`
+}
+
+type CanisterInfoArgs struct {
+	CanisterId          CanisterId `ic:"canister_id" json:"canister_id"`
+	NumRequestedChanges *uint64    `ic:"num_requested_changes,omitempty" json:"num_requested_changes,omitempty"`
+}
+
+type CanisterInfoResult struct {
+	TotalNumChanges uint64                `ic:"total_num_changes" json:"total_num_changes"`
+	RecentChanges   []Change              `ic:"recent_changes" json:"recent_changes"`
+	ModuleHash      *[]byte               `ic:"module_hash,omitempty" json:"module_hash,omitempty"`
+	Controllers     []principal.Principal `ic:"controllers" json:"controllers"`
+}
+
+type DeleteCanisterArgs struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type DepositCyclesArgs struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type HttpRequestArgs struct {
+	Url              string  `ic:"url" json:"url"`
+	MaxResponseBytes *uint64 `ic:"max_response_bytes,omitempty" json:"max_response_bytes,omitempty"`
+	Method           struct {
+		Get  *idl.Null `ic:"get,variant" json:"get,omitempty"`
+		Head *idl.Null `ic:"head,variant" json:"head,omitempty"`
+		Post *idl.Null `ic:"post,variant" json:"post,omitempty"`
+	} `ic:"method" json:"method"`
+	Headers   []HttpHeader `ic:"headers" json:"headers"`
+	Body      *[]byte      `ic:"body,omitempty" json:"body,omitempty"`
+	Transform *struct {
+		Function idl.Function `ic:"function" json:"function"`
+		Context  []byte       `ic:"context" json:"context"`
+	} `ic:"transform,omitempty" json:"transform,omitempty"`
+}
+
+type EcdsaPublicKeyArgs struct {
+	CanisterId     *CanisterId `ic:"canister_id,omitempty" json:"canister_id,omitempty"`
+	DerivationPath [][]byte    `ic:"derivation_path" json:"derivation_path"`
+	KeyId          struct {
+		Curve EcdsaCurve `ic:"curve" json:"curve"`
+		Name  string     `ic:"name" json:"name"`
+	} `ic:"key_id" json:"key_id"`
+}
+
+type EcdsaPublicKeyResult struct {
+	PublicKey []byte `ic:"public_key" json:"public_key"`
+	ChainCode []byte `ic:"chain_code" json:"chain_code"`
+}
+
+type SignWithEcdsaArgs struct {
+	MessageHash    []byte   `ic:"message_hash" json:"message_hash"`
+	DerivationPath [][]byte `ic:"derivation_path" json:"derivation_path"`
+	KeyId          struct {
+		Curve EcdsaCurve `ic:"curve" json:"curve"`
+		Name  string     `ic:"name" json:"name"`
+	} `ic:"key_id" json:"key_id"`
+}
+
+type SignWithEcdsaResult struct {
+	Signature []byte `ic:"signature" json:"signature"`
+}
+
+type SchnorrPublicKeyArgs struct {
+	CanisterId     *CanisterId `ic:"canister_id,omitempty" json:"canister_id,omitempty"`
+	DerivationPath [][]byte    `ic:"derivation_path" json:"derivation_path"`
+	KeyId          struct {
+		Algorithm SchnorrAlgorithm `ic:"algorithm" json:"algorithm"`
+		Name      string           `ic:"name" json:"name"`
+	} `ic:"key_id" json:"key_id"`
+}
+
+type SchnorrPublicKeyResult struct {
+	PublicKey []byte `ic:"public_key" json:"public_key"`
+	ChainCode []byte `ic:"chain_code" json:"chain_code"`
+}
+
+type SignWithSchnorrArgs struct {
+	Message        []byte   `ic:"message" json:"message"`
+	DerivationPath [][]byte `ic:"derivation_path" json:"derivation_path"`
+	KeyId          struct {
+		Algorithm SchnorrAlgorithm `ic:"algorithm" json:"algorithm"`
+		Name      string           `ic:"name" json:"name"`
+	} `ic:"key_id" json:"key_id"`
+}
+
+type SignWithSchnorrResult struct {
+	Signature []byte `ic:"signature" json:"signature"`
+}
+
+type ProvisionalCreateCanisterWithCyclesArgs struct {
+	Amount                *idl.Nat          `ic:"amount,omitempty" json:"amount,omitempty"`
+	Settings              *CanisterSettings `ic:"settings,omitempty" json:"settings,omitempty"`
+	SpecifiedId           *CanisterId       `ic:"specified_id,omitempty" json:"specified_id,omitempty"`
+	SenderCanisterVersion *uint64           `ic:"sender_canister_version,omitempty" json:"sender_canister_version,omitempty"`
+}
+
+type ProvisionalCreateCanisterWithCyclesResult struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+}
+
+type ProvisionalTopUpCanisterArgs struct {
+	CanisterId CanisterId `ic:"canister_id" json:"canister_id"`
+	Amount     idl.Nat    `ic:"amount" json:"amount"`
+}
+
+type RawRandResult = []byte
+
+type StoredChunksResult = []ChunkHash
+
+type UploadChunkResult = ChunkHash
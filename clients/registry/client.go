@@ -100,8 +100,10 @@ func (c *Client) GetNodeListSince(version uint64) (NodeMap, error) {
 			dcID = no.DcId
 		}
 		var ipv6 string
+		var httpPort uint32
 		if nodeRecord.Http != nil {
 			ipv6 = nodeRecord.Http.IpAddr
+			httpPort = nodeRecord.Http.Port
 		}
 		var ipv4 *IPv4Interface
 		if nodeRecord.PublicIpv4Config != nil {
@@ -113,6 +115,7 @@ func (c *Client) GetNodeListSince(version uint64) (NodeMap, error) {
 		}
 		nodeDetailsMap[key] = NodeDetails{
 			IPv6:            ipv6,
+			HTTPPort:        httpPort,
 			IPv4:            ipv4,
 			NodeProviderID:  nodeProviderID,
 			NodeOperatorID:  nodeOperatorID,
@@ -124,6 +127,12 @@ func (c *Client) GetNodeListSince(version uint64) (NodeMap, error) {
 	return nodeDetailsMap, nil
 }
 
+// GetSubnetForCanister returns the ID of the subnet that hosts the given
+// canister.
+func (c *Client) GetSubnetForCanister(canisterID principal.Principal) (principal.Principal, error) {
+	return c.dp.GetSubnetForCanister(canisterID)
+}
+
 func (c *Client) GetSubnetDetails(subnetID principal.Principal) (*v1.SubnetRecord, error) {
 	v, _, err := c.dp.GetValueUpdate(fmt.Appendf(nil, "subnet_record_%s", subnetID), nil)
 	if err != nil {
@@ -177,6 +186,7 @@ type IPv4Interface struct {
 
 type NodeDetails struct {
 	IPv6            string
+	HTTPPort        uint32
 	IPv4            *IPv4Interface
 	NodeOperatorID  principal.Principal
 	NodeProviderID  principal.Principal
@@ -0,0 +1,246 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/niccolofant/agent-go"
+	v1 "github.com/niccolofant/agent-go/clients/registry/proto/v1"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// defaultReplicaPort is the port of the HTTP endpoint of a replica node, if
+// the node record does not specify one.
+const defaultReplicaPort = 8080
+
+// ReplicaRouteConfig is the configuration of a ReplicaRoute. The zero value
+// uses the defaults.
+type ReplicaRouteConfig struct {
+	// Fallback is used for requests that are not sent to a canister and for
+	// canisters of which the subnet is not resolved yet. Defaults to
+	// https://icp0.io.
+	Fallback agent.RouteProvider
+	// Scheme is the URL scheme of the replica endpoints. Defaults to "https".
+	//
+	// Replica nodes serve self-signed TLS certificates, which are recorded in
+	// the registry instead of being issued by a certificate authority. The
+	// default transport rejects them, so the client of the agent needs a
+	// transport of which the TLS configuration accepts the certificates of the
+	// nodes, see agent.WithHttpClient.
+	Scheme string
+	// TTL is the time after which the resolved subnets and nodes are
+	// refreshed. Defaults to 1 hour.
+	TTL time.Duration
+	// Logger logs resolutions and their failures.
+	Logger agent.Logger
+}
+
+// ReplicaRoute is an agent.CanisterRouteProvider that sends requests directly
+// to the replica nodes of the subnet of the effective canister, bypassing the
+// boundary nodes. The subnet of a canister, its membership and the endpoints
+// of its nodes are looked up in the registry.
+//
+// The subnet of a canister is resolved in the background on the first request
+// to it, until then the fallback route is used. Resolutions are cached for
+// the configured TTL and stale entries are used while they are refreshed.
+//
+// Replica nodes are not trusted, so the responses must be verified: the agent
+// has to verify query signatures, and queries that skip verification per
+// request fail with agent.ErrUntrustedRoute.
+type ReplicaRoute struct {
+	lookup subnetLookup
+	config ReplicaRouteConfig
+	next   atomic.Uint64
+
+	mu        sync.Mutex
+	canisters map[string]cachedSubnetID
+	subnets   map[string]cachedHosts
+	nodes     NodeMap
+	nodesTime time.Time
+	resolving map[string]bool
+}
+
+// NewReplicaRoute returns a new ReplicaRoute for the given agent, which is
+// also used to query the registry. It fails if the agent does not verify
+// query signatures.
+//
+// Example:
+//
+//	rp, _ := registry.NewReplicaRoute(a, registry.ReplicaRouteConfig{})
+//	a.Client().SetRouteProvider(rp)
+func NewReplicaRoute(a *agent.Agent, config ReplicaRouteConfig) (*ReplicaRoute, error) {
+	if !a.VerifiesQuerySignatures() {
+		return nil, errors.New("replica route: query signature verification must be enabled")
+	}
+	if config.Fallback == nil {
+		icp0, _ := url.Parse("https://icp0.io/")
+		config.Fallback = agent.StaticRoute(icp0)
+	}
+	if config.Scheme == "" {
+		config.Scheme = "https"
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Hour
+	}
+	if config.Logger == nil {
+		config.Logger = new(agent.NoopLogger)
+	}
+	return &ReplicaRoute{
+		lookup:    New(a),
+		config:    config,
+		canisters: make(map[string]cachedSubnetID),
+		subnets:   make(map[string]cachedHosts),
+		resolving: make(map[string]bool),
+	}, nil
+}
+
+// Resolve looks up the replica endpoints of the subnet of the given canister
+// in the registry and caches them.
+func (r *ReplicaRoute) Resolve(canisterID principal.Principal) ([]*url.URL, error) {
+	subnetID, err := r.lookup.GetSubnetForCanister(canisterID)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.canisters[string(canisterID.Raw)] = cachedSubnetID{subnetID: subnetID, time: time.Now()}
+	subnet, ok := r.subnets[string(subnetID.Raw)]
+	r.mu.Unlock()
+	if ok && time.Since(subnet.time) < r.config.TTL {
+		return subnet.hosts, nil
+	}
+	return r.resolveSubnet(subnetID)
+}
+
+// Route returns a host of the fallback route.
+func (r *ReplicaRoute) Route() (*url.URL, error) {
+	return r.config.Fallback.Route()
+}
+
+// RouteCanister returns one of the replica nodes of the subnet of the given
+// canister, in turn.
+func (r *ReplicaRoute) RouteCanister(ecID principal.Principal) (*url.URL, error) {
+	hosts := r.hosts(ecID)
+	if len(hosts) == 0 {
+		return r.config.Fallback.Route()
+	}
+	i := r.next.Add(1) - 1
+	return hosts[int(i%uint64(len(hosts)))], nil
+}
+
+// Untrusted returns true, replica nodes are not trusted.
+func (r *ReplicaRoute) Untrusted() bool {
+	return true
+}
+
+// hosts returns the cached hosts of the subnet of the given canister, and
+// starts resolving them in the background if they are missing or stale.
+func (r *ReplicaRoute) hosts(ecID principal.Principal) []*url.URL {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	canister, ok := r.canisters[string(ecID.Raw)]
+	if !ok {
+		r.resolveLocked(ecID)
+		return nil
+	}
+	subnet, ok := r.subnets[string(canister.subnetID.Raw)]
+	if !ok || time.Since(canister.time) >= r.config.TTL || time.Since(subnet.time) >= r.config.TTL {
+		r.resolveLocked(ecID)
+	}
+	return subnet.hosts
+}
+
+// resolveLocked resolves the canister in the background, unless it is being
+// resolved already.
+func (r *ReplicaRoute) resolveLocked(ecID principal.Principal) {
+	if r.resolving[string(ecID.Raw)] {
+		return
+	}
+	r.resolving[string(ecID.Raw)] = true
+	go func() {
+		hosts, err := r.Resolve(ecID)
+		if err != nil {
+			r.config.Logger.Printf("[ROUTE] RESOLVE %s failed: %v", ecID, err)
+		} else {
+			r.config.Logger.Printf("[ROUTE] RESOLVE %s: %d replicas", ecID, len(hosts))
+		}
+		r.mu.Lock()
+		delete(r.resolving, string(ecID.Raw))
+		r.mu.Unlock()
+	}()
+}
+
+// nodeMap returns the cached list of nodes, refreshing it if it is stale.
+func (r *ReplicaRoute) nodeMap() (NodeMap, error) {
+	r.mu.Lock()
+	nodes, nodesTime := r.nodes, r.nodesTime
+	r.mu.Unlock()
+	if nodes != nil && time.Since(nodesTime) < r.config.TTL {
+		return nodes, nil
+	}
+	nodes, err := r.lookup.GetNodeListSince(0)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.nodes, r.nodesTime = nodes, time.Now()
+	r.mu.Unlock()
+	return nodes, nil
+}
+
+// resolveSubnet looks up the endpoints of the members of the given subnet.
+func (r *ReplicaRoute) resolveSubnet(subnetID principal.Principal) ([]*url.URL, error) {
+	details, err := r.lookup.GetSubnetDetails(subnetID)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := r.nodeMap()
+	if err != nil {
+		return nil, err
+	}
+	var hosts []*url.URL
+	for _, member := range details.Membership {
+		node, ok := nodes[principal.Principal{Raw: member}.String()]
+		if !ok || node.IPv6 == "" {
+			continue
+		}
+		port := node.HTTPPort
+		if port == 0 {
+			port = defaultReplicaPort
+		}
+		hosts = append(hosts, &url.URL{
+			Scheme: r.config.Scheme,
+			Host:   net.JoinHostPort(node.IPv6, strconv.FormatUint(uint64(port), 10)),
+		})
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no replica endpoints found for subnet %s", subnetID)
+	}
+	r.mu.Lock()
+	r.subnets[string(subnetID.Raw)] = cachedHosts{hosts: hosts, time: time.Now()}
+	r.mu.Unlock()
+	return hosts, nil
+}
+
+// subnetLookup looks up the subnets of canisters and the nodes of subnets in
+// the registry.
+type subnetLookup interface {
+	GetSubnetForCanister(canisterID principal.Principal) (principal.Principal, error)
+	GetSubnetDetails(subnetID principal.Principal) (*v1.SubnetRecord, error)
+	GetNodeListSince(version uint64) (NodeMap, error)
+}
+
+type cachedHosts struct {
+	hosts []*url.URL
+	time  time.Time
+}
+
+type cachedSubnetID struct {
+	subnetID principal.Principal
+	time     time.Time
+}
@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	v1 "github.com/niccolofant/agent-go/clients/registry/proto/v1"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestReplicaRoute_routing(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica()
+	defer r.Close()
+	r.HandleQuery(canisterID, "greet", func(call agenttest.Call) ([]any, error) {
+		return []any{"Hello!"}, nil
+	})
+
+	// The replica is both the fallback and the only node of the subnet, under
+	// different host names.
+	ip, port, err := net.SplitHostPort(r.URL().Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback := &url.URL{Scheme: "http", Host: net.JoinHostPort("localhost", port)}
+	p, err := strconv.ParseUint(port, 10, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := testLookup{
+		canisterID: canisterID,
+		subnetID:   principal.MustDecode("tdb26-jop6k-aogll-7ltgs-eruif-6kk7m-qpktf-gdiqx-mxtrf-vb5e6-eqe"),
+		nodeID:     principal.MustDecode("2vxsx-fae"),
+		node:       NodeDetails{IPv6: ip, HTTPPort: uint32(p)},
+	}
+
+	transport := new(hostRecorder)
+	config := r.AgentConfig()
+	config.ClientConfig = append(config.ClientConfig, agent.WithHttpClient(&http.Client{Transport: transport}))
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp, err := NewReplicaRoute(a, ReplicaRouteConfig{
+		Fallback: agent.StaticRoute(fallback),
+		Scheme:   "http",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp.lookup = lookup
+	a.Client().SetRouteProvider(rp)
+
+	if host, err := rp.Route(); err != nil || host.Host != fallback.Host {
+		t.Errorf("got route %v (%v), want the fallback", host, err)
+	}
+	if host, err := rp.RouteCanister(canisterID); err != nil || host.Host != fallback.Host {
+		t.Errorf("got route %v (%v) before resolving, want the fallback", host, err)
+	}
+	hosts, err := rp.Resolve(canisterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].Host != r.URL().Host {
+		t.Fatalf("got hosts %v, want %s", hosts, r.URL().Host)
+	}
+
+	transport.reset()
+	var out string
+	if err := a.Query(canisterID, "greet", nil, []any{&out}); err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range transport.reset() {
+		if host != r.URL().Host {
+			t.Errorf("request sent to %s, want %s", host, r.URL().Host)
+		}
+	}
+
+	// Unverified queries are not sent to the replica nodes.
+	if err := a.Query(canisterID, "greet", nil, []any{&out}, agent.WithSkipVerification()); !errors.Is(err, agent.ErrUntrustedRoute) {
+		t.Errorf("got %v, want %v", err, agent.ErrUntrustedRoute)
+	}
+	if hosts := transport.reset(); len(hosts) != 0 {
+		t.Errorf("unverified query sent to %v", hosts)
+	}
+
+	// Canisters of which the subnet can not be resolved use the fallback.
+	other := principal.MustDecode("rrkah-fqaaa-aaaaa-aaaaq-cai")
+	if _, err := rp.Resolve(other); err == nil {
+		t.Fatal("expected an error")
+	}
+	if host, err := rp.RouteCanister(other); err != nil || host.Host != fallback.Host {
+		t.Errorf("got route %v (%v) for an unresolved canister, want the fallback", host, err)
+	}
+}
+
+// testLookup is a registry with a single canister on a subnet with a single
+// node.
+type testLookup struct {
+	canisterID principal.Principal
+	subnetID   principal.Principal
+	nodeID     principal.Principal
+	node       NodeDetails
+}
+
+func (l testLookup) GetSubnetForCanister(canisterID principal.Principal) (principal.Principal, error) {
+	if !canisterID.Equal(l.canisterID) {
+		return principal.Principal{}, fmt.Errorf("canister %s not found", canisterID)
+	}
+	return l.subnetID, nil
+}
+
+func (l testLookup) GetSubnetDetails(principal.Principal) (*v1.SubnetRecord, error) {
+	return &v1.SubnetRecord{Membership: [][]byte{l.nodeID.Raw}}, nil
+}
+
+func (l testLookup) GetNodeListSince(uint64) (NodeMap, error) {
+	return NodeMap{l.nodeID.String(): l.node}, nil
+}
+
+// hostRecorder records the hosts of the requests that it sends.
+type hostRecorder struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+func (h *hostRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	h.mu.Lock()
+	h.hosts = append(h.hosts, req.URL.Host)
+	h.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// reset returns the recorded hosts and clears them.
+func (h *hostRecorder) reset() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hosts := h.hosts
+	h.hosts = nil
+	return hosts
+}
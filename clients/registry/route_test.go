@@ -0,0 +1,48 @@
+package registry_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/clients/registry"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestNewReplicaRoute(t *testing.T) {
+	a, err := agent.New(agent.Config{DisableSignedQueryVerification: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.NewReplicaRoute(a, registry.ReplicaRouteConfig{}); err == nil {
+		t.Error("expected an error without query signature verification")
+	}
+}
+
+func TestReplicaRoute_Resolve(t *testing.T) {
+	checkEnabled(t)
+
+	a, err := agent.New(agent.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp, err := registry.NewReplicaRoute(a, registry.ReplicaRouteConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledgerID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	hosts, err := rp.Resolve(ledgerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) == 0 {
+		t.Fatal("no replicas resolved")
+	}
+	host, err := rp.RouteCanister(ledgerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(hosts, host) {
+		t.Errorf("unexpected host %s", host)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/candid/did"
 	"github.com/niccolofant/agent-go/cmd/goic/internal/cmd"
 	"github.com/niccolofant/agent-go/gen"
 	"github.com/niccolofant/agent-go/principal"
@@ -59,6 +60,45 @@ var root = cmd.NewCommandFork(
 			return nil
 		},
 	),
+	cmd.NewCommand(
+		"compat",
+		"Check whether a new DID is a backward compatible upgrade of an old DID.",
+		[]string{"old", "new"},
+		[]cmd.CommandOption{
+			{
+				Name:        "strict",
+				Description: "Also fail on changes that make values decode as null.",
+				HasValue:    false,
+			},
+		},
+		func(args []string, options map[string]string) error {
+			prev, err := did.ParseDIDFile(args[0])
+			if err != nil {
+				return err
+			}
+			next, err := did.ParseDIDFile(args[1])
+			if err != nil {
+				return err
+			}
+			incompatibilities, err := did.CheckCompatibility(*prev, *next)
+			if err != nil {
+				return err
+			}
+			_, strict := options["strict"]
+			var failed int
+			for _, i := range incompatibilities {
+				fmt.Println(i)
+				if !i.Warning || strict {
+					failed++
+				}
+			}
+			if failed != 0 {
+				return fmt.Errorf("%d incompatible methods", failed)
+			}
+			fmt.Println("compatible")
+			return nil
+		},
+	),
 	cmd.NewCommandFork(
 		"generate",
 		"Generate a new Agent from a DID file or a canister ID.",
@@ -92,6 +132,11 @@ var root = cmd.NewCommandFork(
 					Description: "Generate indirect (boxed) call wrappers.",
 					HasValue:    false,
 				},
+				{
+					Name:        "typesOnly",
+					Description: "Only generate the type definitions, without an Agent.",
+					HasValue:    false,
+				},
 			},
 			func(args []string, options map[string]string) error {
 				inputPath := args[0]
@@ -110,7 +155,7 @@ var root = cmd.NewCommandFork(
 				if err != nil {
 					return err
 				}
-				return writeGenerated(g, canisterID, o.output, o.indirect)
+				return writeGenerated(g, canisterID, o)
 			},
 		),
 		cmd.NewCommand(
@@ -138,6 +183,11 @@ var root = cmd.NewCommandFork(
 					Description: "Generate indirect (boxed) call wrappers.",
 					HasValue:    false,
 				},
+				{
+					Name:        "typesOnly",
+					Description: "Only generate the type definitions, without an Agent.",
+					HasValue:    false,
+				},
 			},
 			func(args []string, options map[string]string) error {
 				id := args[0]
@@ -151,7 +201,7 @@ var root = cmd.NewCommandFork(
 				}
 
 				o := parseGenOptions(args[1], options)
-				return writeDID(o.agentName, o.canisterName, &canisterID, o.packageName, o.output, []rune(string(rawDID)), o.indirect)
+				return writeDID(&canisterID, []rune(string(rawDID)), o)
 			},
 		),
 	),
@@ -179,18 +229,21 @@ func main() {
 	}
 }
 
-func writeDID(agentName, canisterName string, canisterID *principal.Principal, packageName, outputPath string, rawDID []rune, indirect bool) error {
-	g, err := gen.NewGenerator(agentName, canisterName, packageName, rawDID)
+func writeDID(canisterID *principal.Principal, rawDID []rune, o genOptions) error {
+	g, err := gen.NewGenerator(o.agentName, o.canisterName, o.packageName, rawDID)
 	if err != nil {
 		return err
 	}
-	return writeGenerated(g, canisterID, outputPath, indirect)
+	return writeGenerated(g, canisterID, o)
 }
 
-func writeGenerated(g *gen.Generator, canisterID *principal.Principal, outputPath string, indirect bool) error {
-	if indirect {
+func writeGenerated(g *gen.Generator, canisterID *principal.Principal, o genOptions) error {
+	if o.indirect {
 		g.Indirect()
 	}
+	if o.typesOnly {
+		g.TypesOnly()
+	}
 	if canisterID != nil {
 		g.WithCanisterID(canisterID)
 	}
@@ -199,8 +252,8 @@ func writeGenerated(g *gen.Generator, canisterID *principal.Principal, outputPat
 		return err
 	}
 
-	if outputPath != "" {
-		return os.WriteFile(outputPath, raw, outputPerm)
+	if o.output != "" {
+		return os.WriteFile(o.output, raw, outputPerm)
 	}
 	fmt.Println(string(raw))
 	return nil
@@ -212,6 +265,7 @@ type genOptions struct {
 	agentName    string
 	output       string
 	indirect     bool
+	typesOnly    bool
 }
 
 // parseGenOptions reads the options shared by the generate subcommands.
@@ -230,5 +284,6 @@ func parseGenOptions(canisterName string, options map[string]string) genOptions
 		o.agentName = a
 	}
 	_, o.indirect = options["indirect"]
+	_, o.typesOnly = options["typesOnly"]
 	return o
 }
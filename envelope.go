@@ -1,8 +1,13 @@
 package agent
 
+import "github.com/niccolofant/agent-go/identity"
+
 // Envelope is a wrapper for a Request that includes the sender's public key and signature.
 type Envelope struct {
 	Content      Request `cbor:"content,omitempty"`
 	SenderPubKey []byte  `cbor:"sender_pubkey,omitempty"`
 	SenderSig    []byte  `cbor:"sender_sig,omitempty"`
+	// SenderDelegation is the chain of delegations from the public key to the
+	// key that signed the request, if any.
+	SenderDelegation []identity.SignedDelegation `cbor:"sender_delegation,omitempty"`
 }
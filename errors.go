@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// ErrUntrustedRoute is returned by queries that skip the verification of
+// signatures while the route provider sends them to untrusted hosts, see
+// UntrustedRouteProvider.
+var ErrUntrustedRoute = errors.New("verification can not be skipped on an untrusted route")
+
+// RejectCode is the reject code of a rejected call, as defined in the
+// interface specification of the Internet Computer.
+type RejectCode uint64
+
+const (
+	// RejectCodeSysFatal is a fatal system error, retrying is unlikely to help.
+	RejectCodeSysFatal RejectCode = 1
+	// RejectCodeSysTransient is a transient system error, retrying might help.
+	RejectCodeSysTransient RejectCode = 2
+	// RejectCodeDestinationInvalid means that the canister or method does not exist.
+	RejectCodeDestinationInvalid RejectCode = 3
+	// RejectCodeCanisterReject means that the canister explicitly rejected the call.
+	RejectCodeCanisterReject RejectCode = 4
+	// RejectCodeCanisterError means that the canister trapped or ran out of resources.
+	RejectCodeCanisterError RejectCode = 5
+)
+
+// String returns the name of the reject code.
+func (c RejectCode) String() string {
+	switch c {
+	case RejectCodeSysFatal:
+		return "SYS_FATAL"
+	case RejectCodeSysTransient:
+		return "SYS_TRANSIENT"
+	case RejectCodeDestinationInvalid:
+		return "DESTINATION_INVALID"
+	case RejectCodeCanisterReject:
+		return "CANISTER_REJECT"
+	case RejectCodeCanisterError:
+		return "CANISTER_ERROR"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", uint64(c))
+	}
+}
+
+// RejectError is returned when a call or query is rejected, either by the
+// canister itself or by the system.
+type RejectError struct {
+	// CanisterID is the canister that was called.
+	CanisterID principal.Principal
+	// MethodName is the name of the method that was called.
+	MethodName string
+	// RejectCode is the reject code.
+	RejectCode RejectCode
+	// Message is a textual diagnostic message.
+	Message string
+	// ErrorCode is an optional implementation-specific textual error code.
+	ErrorCode string
+}
+
+func (e *RejectError) Error() string {
+	if e.ErrorCode == "" {
+		return fmt.Sprintf("(%d) %s", uint64(e.RejectCode), e.Message)
+	}
+	return fmt.Sprintf("(%d) %s: %s", uint64(e.RejectCode), e.Message, e.ErrorCode)
+}
+
+// UnknownOutcomeError is returned when the outcome of a call can not be known
+// anymore, so that waiting longer does not help. Either the IC removed the
+// reply of the call, i.e. its status is "done", or the call is unknown to the
+// IC after its ingress expiry, i.e. it was never executed or its status was
+// removed.
+type UnknownOutcomeError struct {
+	// RequestID is the ID of the call.
+	RequestID RequestID
+	// Status is the last status of the call, "done" or "unknown".
+	Status string
+}
+
+func (e *UnknownOutcomeError) Error() string {
+	if e.Status == "done" {
+		return fmt.Sprintf("the reply of request %x was removed", e.RequestID[:])
+	}
+	return fmt.Sprintf("request %x is unknown after its ingress expiry", e.RequestID[:])
+}
+
+// HTTPError is returned when the replica or boundary node responds with an
+// unexpected HTTP status code.
+type HTTPError struct {
+	// StatusCode is the HTTP status code, e.g. 429.
+	StatusCode int
+	// Status is the HTTP status line, e.g. "429 Too Many Requests".
+	Status string
+	// Body is the body of the response.
+	Body []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("(%d) %s: %s", e.StatusCode, e.Status, e.Body)
+}
+
+// VerificationError is returned when a certificate or a query response
+// signature could not be verified.
+type VerificationError struct {
+	Err error
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("verification failed: %v", e.Err)
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// withCall adds the called canister and method to reject errors.
+func withCall(err error, canisterID principal.Principal, methodName string) error {
+	var rejectErr *RejectError
+	if errors.As(err, &rejectErr) {
+		rejectErr.CanisterID = canisterID
+		rejectErr.MethodName = methodName
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package agent_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestRejectError(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	for _, test := range []struct {
+		name    string
+		options []agenttest.Option
+	}{
+		{name: "sync"},
+		{name: "async", options: []agenttest.Option{agenttest.WithAsynchronousCalls()}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := agenttest.NewReplica(test.options...)
+			defer r.Close()
+			r.HandleQuery(canisterID, "fail", func(call agenttest.Call) ([]any, error) {
+				return nil, &agenttest.Reject{Code: 4, Message: "no access", ErrorCode: "IC0406"}
+			})
+			a, err := agent.New(r.AgentConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, err := range []error{
+				a.Call(canisterID, "fail", nil, nil),
+				a.Query(canisterID, "fail", nil, nil),
+			} {
+				var rejectErr *agent.RejectError
+				if !errors.As(err, &rejectErr) {
+					t.Fatalf("expected reject error, got %v", err)
+				}
+				if rejectErr.RejectCode != agent.RejectCodeCanisterReject {
+					t.Errorf("reject code = %s, want %s", rejectErr.RejectCode, agent.RejectCodeCanisterReject)
+				}
+				if rejectErr.Message != "no access" || rejectErr.ErrorCode != "IC0406" {
+					t.Errorf("unexpected reject: %v", rejectErr)
+				}
+				if !rejectErr.CanisterID.Equal(canisterID) || rejectErr.MethodName != "fail" {
+					t.Errorf("unexpected call: %s %s", rejectErr.CanisterID, rejectErr.MethodName)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	a, err := agent.New(agent.Config{
+		ClientConfig: []agent.ClientOption{agent.WithHostURL(u)},
+		RetryPolicy:  &agent.RetryPolicy{InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	for _, err := range []error{
+		a.Call(canisterID, "greet", nil, nil),
+		a.Query(canisterID, "greet", nil, nil),
+		func() error { _, err := a.GetCanisterModuleHash(canisterID); return err }(),
+	} {
+		var httpErr *agent.HTTPError
+		if !errors.As(err, &httpErr) {
+			t.Fatalf("expected HTTP error, got %v", err)
+		}
+		if httpErr.StatusCode != http.StatusTooManyRequests {
+			t.Errorf("status code = %d, want %d", httpErr.StatusCode, http.StatusTooManyRequests)
+		}
+	}
+}
+
+func TestVerificationError(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica()
+	defer r.Close()
+	r.HandleQuery(canisterID, "greet", func(call agenttest.Call) ([]any, error) {
+		return []any{"Hello!"}, nil
+	})
+
+	// Do not fetch the root key of the replica, so that all certificates are
+	// verified against the mainnet root key.
+	config := r.AgentConfig()
+	config.FetchRootKey = false
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, err := range []error{
+		a.Query(canisterID, "greet", nil, []any{new(string)}),
+		func() error { _, err := a.GetCanisterModuleHash(canisterID); return err }(),
+	} {
+		var verificationErr *agent.VerificationError
+		if !errors.As(err, &verificationErr) {
+			t.Fatalf("expected verification error, got %v", err)
+		}
+	}
+}
@@ -80,8 +80,10 @@ type Generator struct {
 	PackageName        string
 	ServiceDescription did.Description
 	usedIDL            bool
+	usedPrincipal      bool
 
-	indirect bool
+	indirect  bool
+	typesOnly bool
 }
 
 // NewGenerator creates a new generator for the given service description.
@@ -172,6 +174,9 @@ func (g *Generator) Generate() ([]byte, error) {
 	if g.indirect {
 		tmplName = "agent_indirect"
 	}
+	if g.typesOnly {
+		tmplName = "types"
+	}
 	t, ok := templates[tmplName]
 	if !ok {
 		return nil, fmt.Errorf("template not found")
@@ -184,6 +189,7 @@ func (g *Generator) Generate() ([]byte, error) {
 		CanisterID:     g.CanisterID,
 		PackageName:    g.PackageName,
 		UsedIDL:        g.usedIDL,
+		UsedPrincipal:  g.usedPrincipal || g.CanisterID != nil,
 		Definitions:    definitions,
 		Methods:        methods,
 	}); err != nil {
@@ -198,6 +204,13 @@ func (g *Generator) Indirect() *Generator {
 	return g
 }
 
+// TypesOnly sets the generator to only generate the type definitions, without
+// an agent. Use this when the calls are wrapped by a hand-written client.
+func (g *Generator) TypesOnly() *Generator {
+	g.typesOnly = true
+	return g
+}
+
 func (g *Generator) WithCanisterID(canisterID *principal.Principal) *Generator {
 	g.CanisterID = canisterID
 	return g
@@ -210,6 +223,7 @@ func (g *Generator) dataToString(prefix string, data did.Data) string {
 	case did.DataId:
 		return funcName(prefix, string(t))
 	case did.Func:
+		g.usedIDL = true
 		return "idl.Function"
 	case did.Optional:
 		return fmt.Sprintf("*%s", g.dataToString(prefix, t.Data))
@@ -234,6 +248,7 @@ func (g *Generator) dataToString(prefix string, data did.Data) string {
 			panic(fmt.Sprintf("unknown primitive: %s", t))
 		}
 	case did.Principal:
+		g.usedPrincipal = true
 		return "principal.Principal"
 	case did.Record:
 		var sizeName int
@@ -359,6 +374,7 @@ type agentArgs struct {
 	CanisterID     *principal.Principal
 	PackageName    string
 	UsedIDL        bool
+	UsedPrincipal  bool
 	Definitions    []agentArgsDefinition
 	Methods        []agentArgsMethod
 }
@@ -184,3 +184,31 @@ func ExampleNewGenerator_tags() {
 	//     return &r0, nil
 	// }
 }
+
+func ExampleNewGenerator_typesOnly() {
+	g, err := gen.NewGenerator("test", "test", "test", []rune("type id = principal; type resp = record { id : id; n : nat }; service : { test: () -> (resp) }"))
+	if err != nil {
+		panic(err)
+	}
+	raw, err := g.TypesOnly().Generate()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(raw))
+	// Output:
+	// // Package test provides the types of the "test" canister.
+	// // Do NOT edit this file. It was automatically generated by https://github.com/niccolofant/agent-go.
+	// package test
+	//
+	// import (
+	//     "github.com/niccolofant/agent-go/candid/idl"
+	//     "github.com/niccolofant/agent-go/principal"
+	// )
+	//
+	// type Id = principal.Principal
+	//
+	// type Resp struct {
+	// 	Id Id      `ic:"id" json:"id"`
+	// 	N  idl.Nat `ic:"n" json:"n"`
+	// }
+}
@@ -6,6 +6,7 @@ require (
 	github.com/0x51-dev/upeg v0.1.5
 	github.com/consensys/gnark-crypto v0.15.0
 	github.com/fxamacker/cbor/v2 v2.7.0
+	golang.org/x/crypto v0.32.0
 	google.golang.org/protobuf v1.36.3
 )
 
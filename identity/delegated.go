@@ -0,0 +1,123 @@
+package identity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/niccolofant/agent-go/principal"
+)
+
+var (
+	// ErrDelegationExpired is returned if a delegation of a DelegatedIdentity
+	// has expired.
+	ErrDelegationExpired = errors.New("delegation expired")
+	// ErrDelegationTarget is returned if a canister is not a target of the
+	// delegations of a DelegatedIdentity.
+	ErrDelegationTarget = errors.New("canister is not a delegation target")
+)
+
+// DelegatedIdentity is an identity that signs with a session key, to which the
+// authority of another key was delegated through a chain of delegations. The
+// sender of its requests is the principal of the delegating key, e.g. the key
+// of an Internet Identity user.
+type DelegatedIdentity struct {
+	key         Identity
+	publicKey   []byte
+	delegations []SignedDelegation
+}
+
+// NewDelegatedIdentity creates a new identity that signs with the given
+// session key on behalf of the given DER encoded public key. The delegations
+// are ordered from the delegating key to the session key.
+func NewDelegatedIdentity(key Identity, publicKey []byte, delegations []SignedDelegation) (*DelegatedIdentity, error) {
+	if len(delegations) == 0 {
+		return nil, fmt.Errorf("no delegations")
+	}
+	last := delegations[len(delegations)-1].Delegation
+	if !bytes.Equal(last.PublicKey, key.PublicKey()) {
+		return nil, fmt.Errorf("the last delegation is not to the session key")
+	}
+	return &DelegatedIdentity{
+		key:         key,
+		publicKey:   slices.Clone(publicKey),
+		delegations: slices.Clone(delegations),
+	}, nil
+}
+
+// Check returns an error if a delegation has expired at the given time, or if
+// the given canister is not one of the targets of the delegations. An empty
+// canister ID, e.g. of a read_state request, is not checked against the
+// targets.
+func (id DelegatedIdentity) Check(canisterID principal.Principal, now time.Time) error {
+	for _, d := range id.delegations {
+		if d.Delegation.Expiration < uint64(now.UnixNano()) {
+			return fmt.Errorf("%w at %s", ErrDelegationExpired, time.Unix(0, int64(d.Delegation.Expiration)).UTC())
+		}
+		if len(canisterID.Raw) != 0 && len(d.Delegation.Targets) != 0 && !slices.ContainsFunc(d.Delegation.Targets, canisterID.Equal) {
+			return fmt.Errorf("%w: %s", ErrDelegationTarget, canisterID)
+		}
+	}
+	return nil
+}
+
+// Delegations returns the chain of delegations.
+func (id DelegatedIdentity) Delegations() []SignedDelegation {
+	return slices.Clone(id.delegations)
+}
+
+// Expiration returns the time at which the first delegation expires.
+func (id DelegatedIdentity) Expiration() time.Time {
+	expiration := id.delegations[0].Delegation.Expiration
+	for _, d := range id.delegations[1:] {
+		expiration = min(expiration, d.Delegation.Expiration)
+	}
+	return time.Unix(0, int64(expiration))
+}
+
+// PublicKey returns the public key of the delegating key.
+func (id DelegatedIdentity) PublicKey() []byte {
+	return id.publicKey
+}
+
+// Sender returns the principal of the delegating key.
+func (id DelegatedIdentity) Sender() principal.Principal {
+	return principal.NewSelfAuthenticating(id.publicKey)
+}
+
+// Sign signs the given message with the session key.
+func (id DelegatedIdentity) Sign(msg []byte) ([]byte, error) {
+	return id.key.Sign(msg)
+}
+
+// ToPEM returns an error, the delegations can not be encoded as PEM.
+func (id DelegatedIdentity) ToPEM() ([]byte, error) {
+	return nil, fmt.Errorf("delegated identities can not be encoded as PEM")
+}
+
+// Verify verifies the signature of the session key.
+func (id DelegatedIdentity) Verify(msg, sig []byte) bool {
+	return id.key.Verify(msg, sig)
+}
+
+// Delegation delegates the authority of a key to another key, optionally
+// restricted to a set of canisters. Delegations are signed and encoded as JSON
+// with ii.SignDelegation and ii.DelegationChain.
+type Delegation struct {
+	// PublicKey is the DER encoded public key to which is delegated.
+	PublicKey []byte `cbor:"pubkey"`
+	// Expiration is the time at which the delegation expires, in nanoseconds
+	// since the epoch.
+	Expiration uint64 `cbor:"expiration"`
+	// Targets are the canisters to which the delegation is restricted. No
+	// targets means the delegation is not restricted.
+	Targets []principal.Principal `cbor:"targets,omitempty"`
+}
+
+// SignedDelegation is a delegation with the signature of the delegating key.
+type SignedDelegation struct {
+	Delegation Delegation `cbor:"delegation"`
+	Signature  []byte     `cbor:"signature"`
+}
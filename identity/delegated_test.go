@@ -0,0 +1,62 @@
+package identity
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestDelegatedIdentity(t *testing.T) {
+	root, _ := NewRandomEd25519Identity()
+	session, _ := NewRandomEd25519Identity()
+	target := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	delegation := Delegation{
+		PublicKey:  session.PublicKey(),
+		Expiration: uint64(time.Now().Add(time.Hour).UnixNano()),
+		Targets:    []principal.Principal{target},
+	}
+	// The delegation is not verified by the identity.
+	sig := []byte("signature")
+	id, err := NewDelegatedIdentity(session, root.PublicKey(), []SignedDelegation{
+		{Delegation: delegation, Signature: sig},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.Sender().Equal(root.Sender()) {
+		t.Errorf("got sender %s, want %s", id.Sender(), root.Sender())
+	}
+	if !bytes.Equal(id.Delegations()[0].Signature, sig) {
+		t.Error("unexpected delegation signature")
+	}
+	data := []byte("hello")
+	sig, err = id.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.Verify(data, sig) {
+		t.Error("expected the session key to sign")
+	}
+
+	if err := id.Check(target, time.Now()); err != nil {
+		t.Error(err)
+	}
+	if err := id.Check(principal.Principal{}, time.Now()); err != nil {
+		t.Error(err)
+	}
+	if err := id.Check(principal.AnonymousID, time.Now()); !errors.Is(err, ErrDelegationTarget) {
+		t.Errorf("got %v, want %v", err, ErrDelegationTarget)
+	}
+	if err := id.Check(target, id.Expiration().Add(time.Second)); !errors.Is(err, ErrDelegationExpired) {
+		t.Errorf("got %v, want %v", err, ErrDelegationExpired)
+	}
+
+	if _, err := NewDelegatedIdentity(root, root.PublicKey(), []SignedDelegation{
+		{Delegation: delegation, Signature: sig},
+	}); err == nil {
+		t.Error("expected an error for a delegation to another key")
+	}
+}
@@ -0,0 +1,278 @@
+package identity
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	dfxConfigFile       = "identity.json"
+	dfxPEMFile          = "identity.pem"
+	dfxEncryptedPEMFile = "identity.pem.encrypted"
+)
+
+// DfxIdentityDir returns the directory of the dfx identity with the given
+// name, i.e. $DFX_CONFIG_ROOT/.config/dfx/identity/<name>. If DFX_CONFIG_ROOT
+// is not set, the home directory is used.
+func DfxIdentityDir(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid identity name %q", name)
+	}
+	root := os.Getenv("DFX_CONFIG_ROOT")
+	if root == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		root = home
+	}
+	return filepath.Join(root, ".config", "dfx", "identity", name), nil
+}
+
+// LoadDfxIdentity loads the dfx identity with the given name. The password
+// is only requested if the PEM file of the identity is encrypted, and may be
+// nil otherwise. Identities stored in the system keyring or on a hardware
+// security module are not supported.
+//
+// dfx derives the key of encrypted PEM files from the password with Argon2id,
+// not scrypt, and encrypts them with AES-256-GCM.
+//
+// Example:
+//
+//	id, err := identity.LoadDfxIdentity("default", func() ([]byte, error) {
+//		return []byte(os.Getenv("DFX_IDENTITY_PASSWORD")), nil
+//	})
+func LoadDfxIdentity(name string, password func() ([]byte, error)) (Identity, error) {
+	dir, err := DfxIdentityDir(name)
+	if err != nil {
+		return nil, err
+	}
+	config, err := readDfxIdentityConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(config.HSM) != 0 && string(config.HSM) != "null":
+		return nil, fmt.Errorf("identity %q is stored on a hardware security module", name)
+	case config.KeyringIdentitySuffix != "":
+		return nil, fmt.Errorf("identity %q is stored in the system keyring", name)
+	case config.Encryption != nil:
+		if password == nil {
+			return nil, fmt.Errorf("identity %q is encrypted", name)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, dfxEncryptedPEMFile))
+		if err != nil {
+			return nil, err
+		}
+		pw, err := password()
+		if err != nil {
+			return nil, err
+		}
+		aead, err := config.Encryption.aead(pw)
+		if err != nil {
+			return nil, err
+		}
+		data, err = aead.Open(nil, config.Encryption.FileNonce, data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt identity %q: wrong password?", name)
+		}
+		return NewIdentityFromPEM(data)
+	default:
+		data, err := os.ReadFile(filepath.Join(dir, dfxPEMFile))
+		if err != nil {
+			return nil, err
+		}
+		return NewIdentityFromPEM(data)
+	}
+}
+
+// WriteDfxIdentity writes the identity as a dfx identity with the given name.
+// If password is not nil, the PEM file is encrypted with the returned
+// password like "dfx identity new --storage password-protected" does.
+func WriteDfxIdentity(name string, id Identity, password func() ([]byte, error)) error {
+	dir, err := DfxIdentityDir(name)
+	if err != nil {
+		return err
+	}
+	data, err := id.ToPEM()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("identity has no private key")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	var config dfxIdentityConfig
+	file := dfxPEMFile
+	if password != nil {
+		pw, err := password()
+		if err != nil {
+			return err
+		}
+		encryption, err := newDfxEncryptionConfig()
+		if err != nil {
+			return err
+		}
+		aead, err := encryption.aead(pw)
+		if err != nil {
+			return err
+		}
+		data = aead.Seal(nil, encryption.FileNonce, data, nil)
+		config.Encryption = encryption
+		file = dfxEncryptedPEMFile
+	}
+	if err := os.WriteFile(filepath.Join(dir, file), data, 0o600); err != nil {
+		return err
+	}
+	// Remove the other PEM file, so that it is not used instead.
+	for _, stale := range []string{dfxPEMFile, dfxEncryptedPEMFile} {
+		if stale != file {
+			if err := os.Remove(filepath.Join(dir, stale)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	raw, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, dfxConfigFile), raw, 0o600)
+}
+
+// NewIdentityFromPEM creates a new identity from the given PEM file, detecting
+// whether it contains an Ed25519, secp256k1 or prime256v1 key.
+func NewIdentityFromPEM(data []byte) (Identity, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid pem file")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return NewEd25519IdentityFromPEM(data)
+	case "EC PARAMETERS":
+		if next, _ := pem.Decode(rest); next != nil {
+			block = next
+		}
+		fallthrough
+	case "EC PRIVATE KEY":
+		var raw ecPrivateKey
+		if _, err := asn1.Unmarshal(block.Bytes, &raw); err != nil {
+			return nil, err
+		}
+		if isSecp256k1(raw.NamedCurveOID) {
+			return parseSecp256k1PEMBody(block)
+		}
+		return NewPrime256v1IdentityFromPEM(pem.EncodeToMemory(block))
+	default:
+		return nil, fmt.Errorf("unsupported pem block %q", block.Type)
+	}
+}
+
+// dfxIdentityConfig is the content of identity.json.
+type dfxIdentityConfig struct {
+	HSM                   json.RawMessage      `json:"hsm,omitempty"`
+	Encryption            *dfxEncryptionConfig `json:"encryption,omitempty"`
+	KeyringIdentitySuffix string               `json:"keyring_identity_suffix,omitempty"`
+}
+
+func readDfxIdentityConfig(dir string) (dfxIdentityConfig, error) {
+	var config dfxIdentityConfig
+	data, err := os.ReadFile(filepath.Join(dir, dfxConfigFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid %s: %w", dfxConfigFile, err)
+	}
+	return config, nil
+}
+
+// dfxEncryptionConfig describes how the PEM file is encrypted: with
+// AES-256-GCM and a key that is derived from the password with Argon2id.
+type dfxEncryptionConfig struct {
+	// PasswordSalt is the unpadded base64 encoded salt of the key derivation.
+	PasswordSalt string `json:"pw_salt"`
+	// FileNonce is the 96 bit nonce of the encryption.
+	FileNonce []byte `json:"file_nonce"`
+}
+
+func newDfxEncryptionConfig() (*dfxEncryptionConfig, error) {
+	salt := make([]byte, 16)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &dfxEncryptionConfig{
+		PasswordSalt: base64.RawStdEncoding.EncodeToString(salt),
+		FileNonce:    nonce,
+	}, nil
+}
+
+func (c dfxEncryptionConfig) aead(password []byte) (cipher.AEAD, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(c.PasswordSalt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password salt: %w", err)
+	}
+	if len(c.FileNonce) != 12 {
+		return nil, fmt.Errorf("invalid file nonce")
+	}
+	// Same parameters as dfx: 64000 KiB of memory, 3 iterations, 1 lane.
+	key := argon2.IDKey(password, salt, 3, 64000, 1, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// MarshalJSON encodes the nonce as an array of numbers, like serde does.
+func (c dfxEncryptionConfig) MarshalJSON() ([]byte, error) {
+	nonce := make([]int, len(c.FileNonce))
+	for i, b := range c.FileNonce {
+		nonce[i] = int(b)
+	}
+	return json.Marshal(struct {
+		PasswordSalt string `json:"pw_salt"`
+		FileNonce    []int  `json:"file_nonce"`
+	}{c.PasswordSalt, nonce})
+}
+
+// UnmarshalJSON decodes the nonce from an array of numbers.
+func (c *dfxEncryptionConfig) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		PasswordSalt string `json:"pw_salt"`
+		FileNonce    []int  `json:"file_nonce"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	nonce := make([]byte, len(raw.FileNonce))
+	for i, b := range raw.FileNonce {
+		if b < 0 || 255 < b {
+			return fmt.Errorf("invalid file nonce")
+		}
+		nonce[i] = byte(b)
+	}
+	*c = dfxEncryptionConfig{PasswordSalt: raw.PasswordSalt, FileNonce: nonce}
+	return nil
+}
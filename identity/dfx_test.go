@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDfxIdentity(t *testing.T) {
+	t.Setenv("DFX_CONFIG_ROOT", t.TempDir())
+	password := func() ([]byte, error) {
+		return []byte("secret"), nil
+	}
+
+	ed25519ID, _ := NewRandomEd25519Identity()
+	secp256k1ID, _ := NewRandomSecp256k1Identity()
+	prime256v1ID, _ := NewRandomPrime256v1Identity()
+	for name, id := range map[string]Identity{
+		"ed25519":    ed25519ID,
+		"secp256k1":  secp256k1ID,
+		"prime256v1": prime256v1ID,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := WriteDfxIdentity(name, id, nil); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadDfxIdentity(name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !loaded.Sender().Equal(id.Sender()) {
+				t.Errorf("got %s, want %s", loaded.Sender(), id.Sender())
+			}
+		})
+	}
+
+	t.Run("encrypted", func(t *testing.T) {
+		if err := WriteDfxIdentity("encrypted", secp256k1ID, password); err != nil {
+			t.Fatal(err)
+		}
+		dir, _ := DfxIdentityDir("encrypted")
+		if _, err := os.Stat(filepath.Join(dir, "identity.pem")); !os.IsNotExist(err) {
+			t.Error("expected no plaintext PEM file")
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "identity.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config struct {
+			Encryption struct {
+				PasswordSalt string `json:"pw_salt"`
+				FileNonce    []int  `json:"file_nonce"`
+			} `json:"encryption"`
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			t.Fatal(err)
+		}
+		if config.Encryption.PasswordSalt == "" || len(config.Encryption.FileNonce) != 12 {
+			t.Errorf("unexpected configuration %s", data)
+		}
+
+		loaded, err := LoadDfxIdentity("encrypted", password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !loaded.Sender().Equal(secp256k1ID.Sender()) {
+			t.Errorf("got %s, want %s", loaded.Sender(), secp256k1ID.Sender())
+		}
+		if _, err := LoadDfxIdentity("encrypted", nil); err == nil {
+			t.Error("expected an error without password")
+		}
+		if _, err := LoadDfxIdentity("encrypted", func() ([]byte, error) {
+			return []byte("wrong"), nil
+		}); err == nil {
+			t.Error("expected an error for a wrong password")
+		}
+	})
+
+	if _, err := LoadDfxIdentity("../encrypted", nil); err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+}
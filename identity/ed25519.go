@@ -12,15 +12,15 @@ import (
 	"github.com/niccolofant/agent-go/principal"
 )
 
+var ed25519OID = asn1.ObjectIdentifier{1, 3, 101, 112}
+
 func derEncodeEd25519PublicKey(key ed25519.PublicKey) ([]byte, error) {
 	return asn1.Marshal(struct {
 		Algorithm pkix.AlgorithmIdentifier
 		PublicKey asn1.BitString
 	}{
 		Algorithm: pkix.AlgorithmIdentifier{
-			Algorithm: asn1.ObjectIdentifier{
-				1, 3, 101, 112,
-			},
+			Algorithm: ed25519OID,
 		},
 		PublicKey: asn1.BitString{
 			BitLength: len(key) * 8,
@@ -1,6 +1,13 @@
 package identity
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"slices"
+
+	secp256k1 "github.com/consensys/gnark-crypto/ecc/secp256k1/ecdsa"
 	"github.com/niccolofant/agent-go/principal"
 )
 
@@ -17,3 +24,40 @@ type Identity interface {
 	// ToPEM returns the PEM representation of the identity.
 	ToPEM() ([]byte, error)
 }
+
+// VerifySignature verifies the signature of the given message with the DER
+// encoded public key of an Ed25519, P-256 or secp256k1 identity. Signatures of
+// other keys, e.g. canister signatures, are not supported.
+func VerifySignature(publicKey, msg, sig []byte) bool {
+	// The algorithm identifier of Ed25519 keys has no parameters, so it also
+	// decodes as a sequence of object identifiers.
+	var key ecPublicKey
+	if rest, err := asn1.Unmarshal(publicKey, &key); err != nil || len(rest) != 0 {
+		return false
+	}
+	raw := key.PublicKey.RightAlign()
+	switch {
+	case slices.EqualFunc(key.Metadata, []asn1.ObjectIdentifier{ed25519OID}, asn1.ObjectIdentifier.Equal):
+		if len(raw) != ed25519.PublicKeySize {
+			return false
+		}
+		return ed25519.Verify(raw, msg, sig)
+	case slices.EqualFunc(key.Metadata, []asn1.ObjectIdentifier{ecPublicKeyOID, prime256v1OID}, asn1.ObjectIdentifier.Equal):
+		pk, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), raw)
+		if err != nil || len(sig) != 64 {
+			return false
+		}
+		return Prime256v1Identity{publicKey: pk}.Verify(msg, sig)
+	case slices.EqualFunc(key.Metadata, []asn1.ObjectIdentifier{ecPublicKeyOID, secp256k1OID}, asn1.ObjectIdentifier.Equal):
+		if len(raw) != uncompressedPointLen || raw[0] != 0x04 {
+			return false
+		}
+		var pk secp256k1.PublicKey
+		if _, err := pk.SetBytes(raw[1:]); err != nil {
+			return false
+		}
+		return Secp256k1Identity{publicKey: &pk}.Verify(msg, sig)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,39 @@
+package identity
+
+import (
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	ed25519ID, err := NewRandomEd25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prime256v1ID, err := NewRandomPrime256v1Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secp256k1ID, err := NewRandomSecp256k1Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("hello")
+	for _, id := range []Identity{ed25519ID, prime256v1ID, secp256k1ID} {
+		sig, err := id.Sign(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifySignature(id.PublicKey(), msg, sig) {
+			t.Errorf("%T: invalid signature", id)
+		}
+		if VerifySignature(id.PublicKey(), []byte("other"), sig) {
+			t.Errorf("%T: valid signature of another message", id)
+		}
+		if VerifySignature(id.PublicKey(), msg, sig[:len(sig)-1]) {
+			t.Errorf("%T: valid truncated signature", id)
+		}
+	}
+	if VerifySignature(AnonymousIdentity{}.PublicKey(), msg, nil) {
+		t.Error("valid signature of the anonymous identity")
+	}
+}
@@ -0,0 +1,199 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/secp256k1"
+)
+
+// DefaultDerivationPath is the BIP32 derivation path of the IC, which is used
+// by quill and dfx for identities derived from a seed phrase.
+const DefaultDerivationPath = "m/44'/223'/0'/0/0"
+
+//go:embed bip39_english.txt
+var bip39English string
+
+// bip39Words is the BIP39 English word list.
+var bip39Words = strings.Fields(bip39English)
+
+// bip39Indices maps each BIP39 word to its index in the word list.
+var bip39Indices = func() map[string]int {
+	m := make(map[string]int, len(bip39Words))
+	for i, w := range bip39Words {
+		m[w] = i
+	}
+	return m
+}()
+
+// NewMnemonic generates a new BIP39 seed phrase with the given number of words,
+// which has to be 12, 15, 18, 21 or 24.
+func NewMnemonic(words int) (string, error) {
+	if words < 12 || 24 < words || words%3 != 0 {
+		return "", fmt.Errorf("invalid number of words: %d", words)
+	}
+	entropy := make([]byte, words*4/3)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return mnemonicFromEntropy(entropy), nil
+}
+
+// ValidateMnemonic checks whether the given phrase is a valid BIP39 seed
+// phrase, i.e. whether it consists of a valid number of words of the English
+// word list and has a valid checksum.
+func ValidateMnemonic(phrase string) error {
+	words := strings.Fields(phrase)
+	if len(words) < 12 || 24 < len(words) || len(words)%3 != 0 {
+		return fmt.Errorf("invalid number of words: %d", len(words))
+	}
+	// Every word encodes 11 bits: the entropy followed by the checksum.
+	bits := new(big.Int)
+	for _, w := range words {
+		i, ok := bip39Indices[w]
+		if !ok {
+			return fmt.Errorf("invalid word %q", w)
+		}
+		bits.Lsh(bits, 11).Or(bits, big.NewInt(int64(i)))
+	}
+	// Recompute the checksum of the entropy.
+	entropy := bits.Rsh(bits, uint(len(words)/3)).FillBytes(make([]byte, len(words)*4/3))
+	if mnemonicFromEntropy(entropy) != strings.Join(words, " ") {
+		return fmt.Errorf("invalid checksum")
+	}
+	return nil
+}
+
+// NewSecp256k1IdentityFromMnemonic derives a secp256k1 identity from the given
+// BIP39 seed phrase and passphrase along the given BIP32 derivation path, e.g.
+// DefaultDerivationPath, which is used if the path is empty. The result is
+// the same identity as quill and dfx derive from the phrase.
+//
+// The passphrase is used as is, BIP39 requires it to be in NFKD form, which
+// every ASCII string is.
+func NewSecp256k1IdentityFromMnemonic(phrase, passphrase, path string) (*Secp256k1Identity, error) {
+	if err := ValidateMnemonic(phrase); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = DefaultDerivationPath
+	}
+	indices, err := parseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := pbkdf2.Key(sha512.New, strings.Join(strings.Fields(phrase), " "), []byte("mnemonic"+passphrase), 2048, 64)
+	if err != nil {
+		return nil, err
+	}
+	key, chainCode := bip32MasterKey(seed)
+	for _, index := range indices {
+		key, chainCode, err = bip32ChildKey(key, chainCode, index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	privateKey, err := newSecp256k1PrivateKeyFromASN1(ecPrivateKey{
+		PrivateKey: key.FillBytes(make([]byte, scalarLen)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewSecp256k1Identity(privateKey)
+}
+
+// mnemonicFromEntropy encodes the entropy as a seed phrase, followed by the
+// first bits of its SHA-256 hash as checksum.
+func mnemonicFromEntropy(entropy []byte) string {
+	hash := sha256.Sum256(entropy)
+	checksumBits := uint(len(entropy) / 4)
+	bits := new(big.Int).SetBytes(entropy)
+	bits.Lsh(bits, checksumBits).Or(bits, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+	words := make([]string, (len(entropy)*8+int(checksumBits))/11)
+	mask := big.NewInt(1<<11 - 1)
+	for i := len(words) - 1; 0 <= i; i-- {
+		words[i] = bip39Words[new(big.Int).And(bits, mask).Int64()]
+		bits.Rsh(bits, 11)
+	}
+	return strings.Join(words, " ")
+}
+
+// hardenedOffset is added to the index of hardened derivation steps.
+const hardenedOffset = 1 << 31
+
+// parseDerivationPath parses a BIP32 path like "m/44'/223'/0'/0/0".
+func parseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path %q", path)
+	}
+	indices := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path %q", path)
+		}
+		if hardened {
+			index += hardenedOffset
+		}
+		indices = append(indices, uint32(index))
+	}
+	return indices, nil
+}
+
+// bip32MasterKey returns the master private key and chain code of the seed.
+func bip32MasterKey(seed []byte) (*big.Int, []byte) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+	return new(big.Int).SetBytes(i[:32]), i[32:]
+}
+
+// bip32ChildKey derives the child private key and chain code with the given
+// index.
+func bip32ChildKey(key *big.Int, chainCode []byte, index uint32) (*big.Int, []byte, error) {
+	mac := hmac.New(sha512.New, chainCode)
+	if hardenedOffset <= index {
+		mac.Write([]byte{0x00})
+		mac.Write(key.FillBytes(make([]byte, scalarLen)))
+	} else {
+		mac.Write(compressedPublicKey(key))
+	}
+	mac.Write(binary.BigEndian.AppendUint32(nil, index))
+	i := mac.Sum(nil)
+	child := new(big.Int).SetBytes(i[:32])
+	if secp256k1Order.Cmp(child) <= 0 {
+		return nil, nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	child.Add(child, key).Mod(child, secp256k1Order)
+	if child.Sign() == 0 {
+		return nil, nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	return child, i[32:], nil
+}
+
+// compressedPublicKey returns the SEC1 compressed public key of the private
+// key, 0x02 or 0x03 || X.
+func compressedPublicKey(key *big.Int) []byte {
+	var p secp256k1.G1Affine
+	p.ScalarMultiplicationBase(key)
+	prefix := byte(0x02)
+	if p.Y.BigInt(new(big.Int)).Bit(0) == 1 {
+		prefix = 0x03
+	}
+	x := p.X.Bytes()
+	return append([]byte{prefix}, x[:]...)
+}
@@ -0,0 +1,120 @@
+package identity
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha512"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMnemonic(t *testing.T) {
+	// https://github.com/trezor/python-mnemonic/blob/master/vectors.json
+	phrase := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	if got := mnemonicFromEntropy(make([]byte, 16)); got != phrase {
+		t.Errorf("got %q, want %q", got, phrase)
+	}
+	if err := ValidateMnemonic(phrase); err != nil {
+		t.Error(err)
+	}
+	seed, err := pbkdf2.Key(sha512.New, phrase, []byte("mnemonicTREZOR"), 2048, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(seed), "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"; got != want {
+		t.Errorf("got seed %s, want %s", got, want)
+	}
+
+	for _, invalid := range []string{
+		strings.Repeat("abandon ", 12),
+		strings.Repeat("abandon ", 11) + "zzz",
+		strings.Repeat("abandon ", 10) + "about",
+	} {
+		if err := ValidateMnemonic(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+
+	for _, words := range []int{12, 24} {
+		phrase, err := NewMnemonic(words)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(strings.Fields(phrase)); n != words {
+			t.Errorf("got %d words, want %d", n, words)
+		}
+		if err := ValidateMnemonic(phrase); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := NewMnemonic(13); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestBIP32(t *testing.T) {
+	// Test vector 1 of BIP32.
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	key, chainCode := bip32MasterKey(seed)
+	for _, step := range []struct {
+		index     uint32
+		key       string
+		chainCode string
+	}{
+		{hardenedOffset, "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141"},
+		{1, "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368", ""},
+		{2 + hardenedOffset, "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca", ""},
+	} {
+		var err error
+		key, chainCode, err = bip32ChildKey(key, chainCode, step.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key.FillBytes(make([]byte, 32))); got != step.key {
+			t.Errorf("got key %s, want %s", got, step.key)
+		}
+		if got := hex.EncodeToString(chainCode); step.chainCode != "" && got != step.chainCode {
+			t.Errorf("got chain code %s, want %s", got, step.chainCode)
+		}
+	}
+}
+
+func TestNewSecp256k1IdentityFromMnemonic(t *testing.T) {
+	phrase := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	id, err := NewSecp256k1IdentityFromMnemonic(phrase, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id_, err := NewSecp256k1IdentityFromMnemonic(phrase, "", DefaultDerivationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !id.Sender().Equal(id_.Sender()) {
+		t.Error("expected the default derivation path")
+	}
+	other, err := NewSecp256k1IdentityFromMnemonic(phrase, "passphrase", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Sender().Equal(other.Sender()) {
+		t.Error("expected the passphrase to change the identity")
+	}
+	if _, err := NewSecp256k1IdentityFromMnemonic(phrase, "", "44'/223'"); err == nil {
+		t.Error("expected an error for an invalid path")
+	}
+}
+
+func TestNewSecp256k1IdentityFromMnemonic_knownKey(t *testing.T) {
+	// The key of the first Ethereum account of the BIP39 test phrase, as
+	// derived by e.g. MetaMask and ethers.js, which use the same derivation
+	// with another coin type.
+	phrase := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	id, err := NewSecp256k1IdentityFromMnemonic(phrase, "", "m/44'/60'/0'/0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := id.privateKey.Bytes()
+	if got, want := hex.EncodeToString(raw[len(raw)-scalarLen:]), "1ab42cc412b618bdea3a599e3c9bae199ebf030895b039e9db1e30dafb12b727"; got != want {
+		t.Errorf("got key %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// Interceptor intercepts a request to the IC. It can inspect or modify the
+// operation, e.g. add headers, and has to call next to send it. Returning
+// without calling next short-circuits the request.
+//
+// The returned bytes are the raw response: the certificate of a call (nil if
+// the call was accepted asynchronously), the CBOR encoded response of a query
+// or the CBOR encoded response of a read_state request. Failures are returned
+// as RejectError, HTTPError or network errors. Once next returned, the decoded
+// outcome of the response is available in op.Outcome.
+//
+// Example:
+//
+//	func timing(ctx context.Context, op *agent.Operation, next agent.Invoker) ([]byte, error) {
+//		start := time.Now()
+//		raw, err := next(ctx, op)
+//		log.Printf("%s %s %s: %s", op.Type, op.CanisterID, op.MethodName, time.Since(start))
+//		return raw, err
+//	}
+type Interceptor func(ctx context.Context, op *Operation, next Invoker) ([]byte, error)
+
+// Invoker sends the operation to the IC, or to the next interceptor.
+type Invoker func(ctx context.Context, op *Operation) ([]byte, error)
+
+// Operation is a request to the IC that passes through the interceptors.
+type Operation struct {
+	// Type is the type of the request.
+	Type RequestType
+	// EffectiveCanisterID is the canister ID that is used to route the
+	// request. It is empty for subnet read_state requests.
+	EffectiveCanisterID principal.Principal
+	// SubnetID is the subnet of a subnet read_state request.
+	SubnetID principal.Principal
+	// RequestID is the ID of the request.
+	RequestID RequestID
+	// Request is the content of the signed envelope, containing e.g. the
+	// canister ID, method name and paths.
+	Request Request
+	// Envelope is the CBOR encoded signed envelope that is sent.
+	Envelope []byte
+	// Header contains the headers that are added to the HTTP request.
+	Header http.Header
+	// Outcome is the decoded and verified outcome of the response, which is
+	// set once next returns. It is nil if the response was not decoded, e.g.
+	// if the request failed or a call was accepted asynchronously.
+	Outcome *Outcome
+}
+
+// Outcome is the decoded outcome of an operation.
+type Outcome struct {
+	// Reply is the reply of a replied call or query.
+	Reply []byte
+	// Err is the RejectError of a rejected call or query, the
+	// VerificationError of a response that could not be verified, or the
+	// error of a response that could not be decoded.
+	Err error
+}
+
+// CanisterID returns the canister that is called, empty for read_state requests.
+func (op *Operation) CanisterID() principal.Principal {
+	return op.Request.CanisterID
+}
+
+// MethodName returns the name of the called method, empty for read_state
+// requests.
+func (op *Operation) MethodName() string {
+	return op.Request.MethodName
+}
+
+// Paths returns the requested paths of a read_state request.
+func (op *Operation) Paths() [][]hashtree.Label {
+	return op.Request.Paths
+}
+
+// WithInterceptors adds interceptors to the client. The first interceptor is
+// the outermost one.
+func WithInterceptors(interceptors ...Interceptor) ClientOption {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// decoder decodes and verifies the raw response of an operation.
+type decoder func(ctx context.Context, raw []byte) *Outcome
+
+type decoderKey struct{}
+
+// withDecoder returns a context with which the response of the next operation
+// is decoded by d, so that its outcome is available to the interceptors.
+func withDecoder(ctx context.Context, d decoder) context.Context {
+	return context.WithValue(ctx, decoderKey{}, d)
+}
+
+// cachedDecoder remembers the outcome of the last decoded response, so that the
+// agent does not decode the response again unless an interceptor replaced it.
+type cachedDecoder struct {
+	decode  decoder
+	raw     []byte
+	outcome *Outcome
+}
+
+func newCachedDecoder(decode decoder) *cachedDecoder {
+	return &cachedDecoder{decode: decode}
+}
+
+func (d *cachedDecoder) do(ctx context.Context, raw []byte) *Outcome {
+	if d.outcome == nil || !bytes.Equal(d.raw, raw) {
+		d.raw, d.outcome = raw, d.decode(ctx, raw)
+	}
+	return d.outcome
+}
+
+// intercept passes the operation through the interceptors of the client and
+// finally to send. Without interceptors the envelope is not decoded.
+func (c Client) intercept(ctx context.Context, op *Operation, send Invoker) ([]byte, error) {
+	d, _ := ctx.Value(decoderKey{}).(decoder)
+	if d != nil {
+		// Requests made while decoding, e.g. to fetch keys, are not decoded
+		// with d.
+		ctx = context.WithValue(ctx, decoderKey{}, decoder(nil))
+	}
+	if len(c.interceptors) == 0 {
+		return send(ctx, op)
+	}
+	var envelope struct {
+		Content Request `cbor:"content"`
+	}
+	if err := cbor.Unmarshal(op.Envelope, &envelope); err != nil {
+		return nil, err
+	}
+	op.Request = envelope.Content
+	op.RequestID = NewRequestID(envelope.Content)
+	op.Header = make(http.Header)
+	next := send
+	if d != nil {
+		next = func(ctx context.Context, op *Operation) ([]byte, error) {
+			raw, err := send(ctx, op)
+			op.Outcome = nil
+			if err == nil && len(raw) != 0 {
+				op.Outcome = d(ctx, raw)
+			}
+			return raw, err
+		}
+	}
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := c.interceptors[i], next
+		next = func(ctx context.Context, op *Operation) ([]byte, error) {
+			return interceptor(ctx, op, inner)
+		}
+	}
+	return next(ctx, op)
+}
@@ -0,0 +1,137 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestInterceptor(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls())
+	defer r.Close()
+	r.HandleQuery(canisterID, "greet", func(call agenttest.Call) ([]any, error) {
+		return []any{"Hello!"}, nil
+	})
+
+	var (
+		order []string
+		ops   []agent.Operation
+	)
+	errBlocked := errors.New("blocked")
+	config := r.AgentConfig()
+	config.Interceptors = []agent.Interceptor{
+		func(ctx context.Context, op *agent.Operation, next agent.Invoker) ([]byte, error) {
+			order = append(order, "outer")
+			ops = append(ops, *op)
+			return next(ctx, op)
+		},
+		func(ctx context.Context, op *agent.Operation, next agent.Invoker) ([]byte, error) {
+			order = append(order, "inner")
+			if op.MethodName() == "blocked" {
+				return nil, errBlocked
+			}
+			op.Header.Set("X-Test", "true")
+			return next(ctx, op)
+		},
+	}
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := a.CreateCandidAPIRequest(agent.RequestTypeCall, canisterID, "greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestID, err := req.Submit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out string
+	if err := a.WaitEntry(context.Background(), req.JournalEntry(), []any{&out}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(order[:2]) != "[outer inner]" {
+		t.Errorf("order = %v", order)
+	}
+	call := ops[0]
+	if call.Type != agent.RequestTypeCall || call.RequestID != requestID || call.MethodName() != "greet" ||
+		!call.CanisterID().Equal(canisterID) || !call.EffectiveCanisterID.Equal(canisterID) {
+		t.Errorf("unexpected call operation: %+v", call)
+	}
+	readState := ops[1]
+	if readState.Type != agent.RequestTypeReadState || len(readState.Paths()) != 1 {
+		t.Errorf("unexpected read_state operation: %+v", readState)
+	}
+
+	// Short-circuit the request.
+	if err := a.Query(canisterID, "blocked", nil, nil); !errors.Is(err, errBlocked) {
+		t.Errorf("expected blocked error, got %v", err)
+	}
+}
+
+func TestInterceptor_outcome(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica()
+	defer r.Close()
+	r.HandleQuery(canisterID, "greet", func(call agenttest.Call) ([]any, error) {
+		return []any{"Hello!"}, nil
+	})
+	r.HandleQuery(canisterID, "denied", func(call agenttest.Call) ([]any, error) {
+		return nil, &agenttest.Reject{Code: 4, Message: "no access"}
+	})
+	r.HandleUpdate(canisterID, "store", func(call agenttest.Call) ([]any, error) {
+		return []any{"Hello!"}, nil
+	})
+
+	outcomes := make(map[agent.RequestType]*agent.Outcome)
+	config := r.AgentConfig()
+	config.Interceptors = []agent.Interceptor{
+		func(ctx context.Context, op *agent.Operation, next agent.Invoker) ([]byte, error) {
+			raw, err := next(ctx, op)
+			outcomes[op.Type] = op.Outcome
+			return raw, err
+		},
+	}
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out string
+	if err := a.Query(canisterID, "greet", nil, []any{&out}); err != nil {
+		t.Fatal(err)
+	}
+	if o := outcomes[agent.RequestTypeQuery]; o == nil || o.Err != nil || len(o.Reply) == 0 {
+		t.Errorf("unexpected replied query outcome: %+v", o)
+	}
+
+	if err := a.Query(canisterID, "denied", nil, nil); err == nil {
+		t.Fatal("expected reject error")
+	}
+	var rejectErr *agent.RejectError
+	if o := outcomes[agent.RequestTypeQuery]; o == nil || !errors.As(o.Err, &rejectErr) || rejectErr.Message != "no access" {
+		t.Errorf("unexpected rejected query outcome: %+v", o)
+	}
+
+	if err := a.Call(canisterID, "store", nil, []any{&out}); err != nil {
+		t.Fatal(err)
+	}
+	if o := outcomes[agent.RequestTypeCall]; o == nil || o.Err != nil || len(o.Reply) == 0 {
+		t.Errorf("unexpected call outcome: %+v", o)
+	}
+
+	if _, err := a.ReadStateCertificate(canisterID, [][]hashtree.Label{{hashtree.Label("time")}}); err != nil {
+		t.Fatal(err)
+	}
+	if o := outcomes[agent.RequestTypeReadState]; o == nil || o.Err != nil {
+		t.Errorf("unexpected read_state outcome: %+v", o)
+	}
+}
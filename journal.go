@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// CallJournal records submitted update calls until their outcome is known, so
+// that calls that were in flight when the process stopped can be resumed with
+// Agent.WaitEntry instead of being sent again.
+type CallJournal interface {
+	// Record records a call before it is submitted.
+	Record(entry CallJournalEntry) error
+	// Remove removes a call once it is replied or rejected.
+	Remove(requestID RequestID) error
+	// Pending returns all recorded calls whose outcome is not known yet.
+	Pending() ([]CallJournalEntry, error)
+}
+
+// CallJournalEntry is a call recorded in a CallJournal.
+type CallJournalEntry struct {
+	// RequestID is the ID of the call.
+	RequestID RequestID `json:"request_id"`
+	// CanisterID is the canister that is called.
+	CanisterID principal.Principal `json:"canister_id"`
+	// EffectiveCanisterID is the canister ID that is used to route the call.
+	EffectiveCanisterID principal.Principal `json:"effective_canister_id"`
+	// MethodName is the name of the called method.
+	MethodName string `json:"method_name"`
+	// IngressExpiry is the expiry of the call, in nanoseconds since the Unix
+	// epoch. A call that is not known to the IC after its expiry will never
+	// be executed.
+	IngressExpiry uint64 `json:"ingress_expiry"`
+}
+
+// FileCallJournal is a CallJournal that stores its entries in a JSON file. The
+// file is replaced atomically on every change.
+type FileCallJournal struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[RequestID]CallJournalEntry
+}
+
+// NewFileCallJournal opens the journal at the given path, creating it if it
+// does not exist.
+func NewFileCallJournal(path string) (*FileCallJournal, error) {
+	j := &FileCallJournal{
+		path:    path,
+		entries: make(map[RequestID]CallJournalEntry),
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []CallJournalEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		j.entries[e.RequestID] = e
+	}
+	return j, nil
+}
+
+// Pending returns all recorded calls, ordered by their ingress expiry.
+func (j *FileCallJournal) Pending() ([]CallJournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.sorted(), nil
+}
+
+// Record records the call and writes the journal to disk.
+func (j *FileCallJournal) Record(entry CallJournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[entry.RequestID] = entry
+	return j.save()
+}
+
+// Remove removes the call and writes the journal to disk.
+func (j *FileCallJournal) Remove(requestID RequestID) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.entries[requestID]; !ok {
+		return nil
+	}
+	delete(j.entries, requestID)
+	return j.save()
+}
+
+func (j *FileCallJournal) save() error {
+	raw, err := json.Marshal(j.sorted())
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := f.Write(raw); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), j.path)
+}
+
+func (j *FileCallJournal) sorted() []CallJournalEntry {
+	entries := make([]CallJournalEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b CallJournalEntry) int {
+		return cmp.Or(
+			cmp.Compare(a.IngressExpiry, b.IngressExpiry),
+			slices.Compare(a.RequestID[:], b.RequestID[:]),
+		)
+	})
+	return entries
+}
+
+// record records the call in the journal of the agent, if any.
+func (a Agent) record(entry CallJournalEntry) error {
+	if a.journal == nil {
+		return nil
+	}
+	return a.journal.Record(entry)
+}
+
+// resolve removes the call from the journal of the agent if its outcome is
+// known, i.e. it was replied or rejected, or can not be known anymore.
+func (a Agent) resolve(requestID RequestID, err error) {
+	if a.journal == nil {
+		return
+	}
+	var (
+		rejectErr  *RejectError
+		unknownErr *UnknownOutcomeError
+	)
+	if err != nil && !errors.As(err, &rejectErr) && !errors.As(err, &unknownErr) {
+		return
+	}
+	if err := a.journal.Remove(requestID); err != nil {
+		a.logger.Printf("[AGENT] JOURNAL failed to remove %x: %v", requestID, err)
+	}
+}
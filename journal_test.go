@@ -0,0 +1,183 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/identity"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestFileCallJournal(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls())
+	defer r.Close()
+	var transfers int
+	r.HandleUpdate(canisterID, "transfer", func(call agenttest.Call) ([]any, error) {
+		transfers++
+		return []any{uint64(transfers)}, nil
+	})
+
+	id, err := identity.NewRandomEd25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "journal.json")
+	newAgent := func() (*agent.Agent, *agent.FileCallJournal) {
+		journal, err := agent.NewFileCallJournal(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := r.AgentConfig()
+		config.Identity = id
+		config.CallJournal = journal
+		a, err := agent.New(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a, journal
+	}
+
+	// Submit the call, then "crash" before waiting for the result.
+	a, _ := newAgent()
+	req, err := a.CreateCandidAPIRequest(agent.RequestTypeCall, canisterID, "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestID, err := req.Submit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resume the pending call after a restart.
+	a, journal := newAgent()
+	pending, err := journal.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].RequestID != requestID || pending[0].MethodName != "transfer" {
+		t.Fatalf("unexpected pending calls: %+v", pending)
+	}
+	var n uint64
+	if err := a.WaitEntry(context.Background(), pending[0], []any{&n}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || transfers != 1 {
+		t.Errorf("transfers = %d, want 1", transfers)
+	}
+
+	// The resolved call is removed from the journal, also on disk.
+	_, journal = newAgent()
+	if pending, _ := journal.Pending(); len(pending) != 0 {
+		t.Errorf("unexpected pending calls: %+v", pending)
+	}
+
+	// Calls that are replied immediately are not left in the journal.
+	if err := a.Call(canisterID, "transfer", nil, []any{&n}); err != nil {
+		t.Fatal(err)
+	}
+	_, journal = newAgent()
+	if pending, _ := journal.Pending(); len(pending) != 0 {
+		t.Errorf("unexpected pending calls: %+v", pending)
+	}
+}
+
+func TestWait(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls())
+	defer r.Close()
+	r.HandleUpdate(canisterID, "transfer", func(call agenttest.Call) ([]any, error) {
+		return []any{uint64(1)}, nil
+	})
+	a, err := agent.New(r.AgentConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := a.CreateCandidAPIRequest(agent.RequestTypeCall, canisterID, "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestID, err := req.Submit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n uint64
+	if err := a.Wait(context.Background(), canisterID, requestID, []any{&n}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("n = %d, want 1", n)
+	}
+}
+
+func TestWait_unknownOutcome(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls())
+	defer r.Close()
+	r.HandleUpdate(canisterID, "transfer", func(call agenttest.Call) ([]any, error) {
+		return []any{uint64(1)}, nil
+	})
+
+	journal, err := agent.NewFileCallJournal(filepath.Join(t.TempDir(), "journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := r.AgentConfig()
+	config.CallJournal = journal
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectUnknown := func(t *testing.T, call agent.CallJournalEntry, status string) {
+		t.Helper()
+		var n uint64
+		err := a.WaitEntry(context.Background(), call, []any{&n})
+		var unknownErr *agent.UnknownOutcomeError
+		if !errors.As(err, &unknownErr) {
+			t.Fatalf("expected unknown outcome error, got %v", err)
+		}
+		if unknownErr.Status != status || unknownErr.RequestID != call.RequestID {
+			t.Errorf("unexpected error: %+v", unknownErr)
+		}
+		if pending, _ := journal.Pending(); len(pending) != 0 {
+			t.Errorf("unexpected pending calls: %+v", pending)
+		}
+	}
+
+	t.Run("done", func(t *testing.T) {
+		req, err := a.CreateCandidAPIRequest(agent.RequestTypeCall, canisterID, "transfer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		requestID, err := req.Submit(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoveReply(requestID)
+		pending, err := journal.Pending()
+		if err != nil || len(pending) != 1 {
+			t.Fatalf("unexpected pending calls: %+v, %v", pending, err)
+		}
+		expectUnknown(t, pending[0], "done")
+	})
+
+	t.Run("unknown after expiry", func(t *testing.T) {
+		// A call that never reached the IC.
+		call := agent.CallJournalEntry{
+			RequestID:           agent.RequestID{1},
+			CanisterID:          canisterID,
+			EffectiveCanisterID: canisterID,
+			MethodName:          "transfer",
+			IngressExpiry:       uint64(time.Now().Add(-time.Hour).UnixNano()),
+		}
+		if err := journal.Record(call); err != nil {
+			t.Fatal(err)
+		}
+		expectUnknown(t, call, "unknown")
+	})
+}
@@ -0,0 +1,298 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/niccolofant/agent-go/certification"
+	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// maxPollBatch is the maximum number of request IDs that are polled with a
+// single read_state request.
+const maxPollBatch = 64
+
+// Poller polls the status of many in-flight calls at once. On every tick the
+// pending request IDs are grouped by the subnet of their effective canister ID
+// and requested with a single read_state request per group, of which the
+// certificate is verified once. The subnets of the canisters are learned from
+// the canister ranges in the certificates, calls to canisters of which the
+// subnet is not known yet are grouped by effective canister ID.
+//
+// Batching only works on replicas that allow it. The IC only accepts
+// read_state requests for the status of a single request, and responds with
+// 400 Bad Request to batched requests. The poller then falls back to polling
+// every request ID with a separate read_state request, still sent together on
+// every tick, for the rest of its lifetime.
+//
+// All polled calls must have been signed by the identity of the agent.
+type Poller struct {
+	a    *Agent
+	done chan struct{}
+	once sync.Once
+
+	mu        sync.Mutex
+	groups    map[string]*pollGroup
+	subnets   map[string]certification.CanisterRanges
+	unbatched bool
+}
+
+// NewPoller starts a new poller that polls with the poll delay of the agent.
+// The caller should call Close when finished, to stop it.
+func NewPoller(a *Agent) *Poller {
+	p := &Poller{
+		a:       a,
+		done:    make(chan struct{}),
+		groups:  make(map[string]*pollGroup),
+		subnets: make(map[string]certification.CanisterRanges),
+	}
+	go p.run()
+	return p
+}
+
+// Close stops the poller. Pending calls to Wait return an error.
+func (p *Poller) Close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
+
+// Wait waits for the result of the call and returns the raw reply. It returns
+// an error if the call is rejected, its outcome can not be known anymore (see
+// UnknownOutcomeError), the poll timeout of the agent is reached or the context
+// is done.
+func (p *Poller) Wait(ctx context.Context, call CallJournalEntry) ([]byte, error) {
+	ch := make(chan pollResult, 1)
+	p.add(call, ch)
+	defer p.remove(call.EffectiveCanisterID, call.RequestID, ch)
+
+	timer := time.NewTimer(p.a.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.raw, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("out of time... waited %d seconds", p.a.timeout/time.Second)
+	case <-p.done:
+		return nil, fmt.Errorf("poller closed")
+	}
+}
+
+func (p *Poller) add(call CallJournalEntry, ch chan pollResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ecID := call.EffectiveCanisterID
+	g, ok := p.groups[string(ecID.Raw)]
+	if !ok {
+		g = &pollGroup{
+			ecID:     ecID,
+			waiters:  make(map[RequestID][]chan pollResult),
+			expiries: make(map[RequestID]uint64),
+		}
+		p.groups[string(ecID.Raw)] = g
+	}
+	g.waiters[call.RequestID] = append(g.waiters[call.RequestID], ch)
+	g.expiries[call.RequestID] = call.IngressExpiry
+}
+
+// dispatch sends the result to all waiters of the given request.
+func (p *Poller) dispatch(ecID principal.Principal, requestID RequestID, r pollResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.groups[string(ecID.Raw)]
+	if !ok {
+		return
+	}
+	for _, ch := range g.waiters[requestID] {
+		ch <- r
+	}
+	g.delete(requestID)
+	if len(g.waiters) == 0 {
+		delete(p.groups, string(ecID.Raw))
+	}
+}
+
+// pending returns the pending requests, grouped in batches per subnet.
+func (p *Poller) pending() []pollBatch {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	size := maxPollBatch
+	if p.unbatched {
+		size = 1
+	}
+	subnets := make(map[string][]pollRequest)
+	for key, g := range p.groups {
+		if subnet := p.subnetLocked(g.ecID); subnet != "" {
+			key = subnet
+		}
+		for requestID := range g.waiters {
+			subnets[key] = append(subnets[key], pollRequest{
+				ecID:          g.ecID,
+				requestID:     requestID,
+				ingressExpiry: g.expiries[requestID],
+			})
+		}
+	}
+	var batches []pollBatch
+	for _, requests := range subnets {
+		for batch := range slices.Chunk(requests, size) {
+			// Any canister of the subnet can be used to read the status of the
+			// requests.
+			batches = append(batches, pollBatch{ecID: batch[0].ecID, requests: batch})
+		}
+	}
+	return batches
+}
+
+// subnetLocked returns the key of the subnet of the given canister, or an
+// empty string if it is not known.
+func (p *Poller) subnetLocked(canisterID principal.Principal) string {
+	for subnetID, ranges := range p.subnets {
+		if ranges.InRange(canisterID) {
+			return subnetID
+		}
+	}
+	return ""
+}
+
+// storeSubnet stores the canister ranges of the subnet that signed the
+// certificate.
+func (p *Poller) storeSubnet(certificate *certification.Certificate) {
+	subnetID := principal.MustDecode(certification.RootSubnetID)
+	if certificate.Delegation != nil {
+		subnetID = certificate.Delegation.SubnetId
+	}
+	ranges := queryVerificationCanisterRanges(certificate, subnetID)
+	if len(ranges) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subnets[principalCacheKey(subnetID)] = ranges
+}
+
+// poll polls all pending requests once.
+func (p *Poller) poll() {
+	var wg sync.WaitGroup
+	for _, batch := range p.pending() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.pollBatch(batch)
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *Poller) pollBatch(batch pollBatch) {
+	paths := make([][]hashtree.Label, len(batch.requests))
+	for i, request := range batch.requests {
+		paths[i] = []hashtree.Label{hashtree.Label("request_status"), request.requestID[:]}
+	}
+	p.a.logger.Printf("[AGENT] POLL %s (%d requests)", batch.ecID, len(batch.requests))
+	p.a.recordPoll(batch.ecID)
+	ctx, span := p.a.startSpan(p.a.ctx, "agent.poll", batch.ecID, "")
+	certificate, err := p.a.readStateCertificate(ctx, batch.ecID, paths)
+	endSpan(span, err)
+	if err != nil {
+		var httpErr *HTTPError
+		if len(batch.requests) > 1 && errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusBadRequest {
+			p.a.logger.Printf("[AGENT] POLL batched read_state not supported: %v", err)
+			p.mu.Lock()
+			p.unbatched = true
+			p.mu.Unlock()
+			for _, request := range batch.requests {
+				p.pollBatch(pollBatch{ecID: request.ecID, requests: []pollRequest{request}})
+			}
+			return
+		}
+		for _, request := range batch.requests {
+			p.dispatch(request.ecID, request.requestID, pollResult{err: err})
+		}
+		return
+	}
+	p.storeSubnet(certificate)
+	for i, request := range batch.requests {
+		status, node, err := handleStatus(paths[i], certificate)
+		if err != nil {
+			p.dispatch(request.ecID, request.requestID, pollResult{err: err})
+			continue
+		}
+		if raw, done, err := requestResult(status, node, request.requestID, request.ingressExpiry); done {
+			p.dispatch(request.ecID, request.requestID, pollResult{raw: raw, err: err})
+		}
+	}
+}
+
+func (p *Poller) remove(ecID principal.Principal, requestID RequestID, ch chan pollResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.groups[string(ecID.Raw)]
+	if !ok {
+		return
+	}
+	waiters := g.waiters[requestID]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		g.delete(requestID)
+	} else {
+		g.waiters[requestID] = waiters
+	}
+	if len(g.waiters) == 0 {
+		delete(p.groups, string(ecID.Raw))
+	}
+}
+
+func (p *Poller) run() {
+	ticker := time.NewTicker(p.a.delay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.poll()
+		}
+	}
+}
+
+type pollBatch struct {
+	// ecID is the effective canister ID of the read_state request.
+	ecID     principal.Principal
+	requests []pollRequest
+}
+
+type pollRequest struct {
+	ecID          principal.Principal
+	requestID     RequestID
+	ingressExpiry uint64
+}
+
+type pollGroup struct {
+	ecID     principal.Principal
+	waiters  map[RequestID][]chan pollResult
+	expiries map[RequestID]uint64
+}
+
+func (g *pollGroup) delete(requestID RequestID) {
+	delete(g.waiters, requestID)
+	delete(g.expiries, requestID)
+}
+
+type pollResult struct {
+	raw []byte
+	err error
+}
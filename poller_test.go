@@ -0,0 +1,238 @@
+package agent_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/candid"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestPoller(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		batched bool
+	}{
+		{name: "batched", batched: true},
+		{name: "unbatched"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+			options := []agenttest.Option{agenttest.WithAsynchronousCalls()}
+			if test.batched {
+				options = append(options, agenttest.WithBatchedRequestStatus())
+			}
+			r := agenttest.NewReplica(options...)
+			defer r.Close()
+			r.HandleUpdate(canisterID, "echo", func(call agenttest.Call) ([]any, error) {
+				var n uint64
+				if err := call.Decode(&n); err != nil {
+					return nil, err
+				}
+				return []any{n}, nil
+			})
+
+			// The proxy records the number of paths of every read_state request.
+			var (
+				mu    sync.Mutex
+				reads []int
+			)
+			proxy := httputil.NewSingleHostReverseProxy(r.URL())
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if strings.HasSuffix(req.URL.Path, "/read_state") {
+					body, _ := io.ReadAll(req.Body)
+					req.Body = io.NopCloser(bytes.NewReader(body))
+					var envelope struct {
+						Content struct {
+							Paths [][][]byte `cbor:"paths"`
+						} `cbor:"content"`
+					}
+					_ = cbor.Unmarshal(body, &envelope)
+					n := len(envelope.Content.Paths)
+					mu.Lock()
+					reads = append(reads, n)
+					mu.Unlock()
+				}
+				proxy.ServeHTTP(w, req)
+			}))
+			defer s.Close()
+			u, _ := url.Parse(s.URL)
+
+			a, err := agent.New(agent.Config{
+				ClientConfig: []agent.ClientOption{agent.WithHostURL(u)},
+				FetchRootKey: true,
+				PollDelay:    10 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := agent.NewPoller(a)
+			defer p.Close()
+
+			calls := make([]agent.CallJournalEntry, 10)
+			for i := range calls {
+				req, err := a.CreateCandidAPIRequest(agent.RequestTypeCall, canisterID, "echo", uint64(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := req.Submit(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				calls[i] = req.JournalEntry()
+			}
+
+			var wg sync.WaitGroup
+			for i, call := range calls {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					raw, err := p.Wait(context.Background(), call)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					var n uint64
+					if err := candid.Unmarshal(raw, []any{&n}); err != nil {
+						t.Error(err)
+						return
+					}
+					if n != uint64(i) {
+						t.Errorf("got %d, want %d", n, i)
+					}
+				}()
+			}
+			wg.Wait()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if test.batched {
+				if len(reads) >= len(calls) {
+					t.Errorf("expected batched read_state requests, got %v", reads)
+				}
+			} else if reads[len(reads)-1] != 1 {
+				t.Errorf("expected fallback to single read_state requests, got %v", reads)
+			}
+		})
+	}
+}
+
+func TestPoller_subnets(t *testing.T) {
+	canisterA := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	canisterB := principal.MustDecode("rrkah-fqaaa-aaaaa-aaaaq-cai")
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls(), agenttest.WithBatchedRequestStatus())
+	defer r.Close()
+	r.HandleUpdate(canisterA, "echo", func(call agenttest.Call) ([]any, error) {
+		return nil, nil
+	})
+
+	// The proxy records the largest number of paths of a read_state request.
+	var (
+		mu       sync.Mutex
+		maxPaths int
+	)
+	proxy := httputil.NewSingleHostReverseProxy(r.URL())
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/read_state") {
+			body, _ := io.ReadAll(req.Body)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			var envelope struct {
+				Content struct {
+					Paths [][][]byte `cbor:"paths"`
+				} `cbor:"content"`
+			}
+			_ = cbor.Unmarshal(body, &envelope)
+			mu.Lock()
+			maxPaths = max(maxPaths, len(envelope.Content.Paths))
+			mu.Unlock()
+		}
+		proxy.ServeHTTP(w, req)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+
+	a, err := agent.New(agent.Config{
+		ClientConfig: []agent.ClientOption{agent.WithHostURL(u)},
+		FetchRootKey: true,
+		PollDelay:    10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := agent.NewPoller(a)
+	defer p.Close()
+
+	expectUnknown := func(t *testing.T, call agent.CallJournalEntry, status string) {
+		t.Helper()
+		_, err := p.Wait(context.Background(), call)
+		var unknownErr *agent.UnknownOutcomeError
+		if !errors.As(err, &unknownErr) {
+			t.Fatalf("expected unknown outcome error, got %v", err)
+		}
+		if unknownErr.Status != status {
+			t.Errorf("got status %s, want %s", unknownErr.Status, status)
+		}
+	}
+
+	t.Run("grouped by subnet", func(t *testing.T) {
+		// Calls that never reached the IC, to different canisters of the same
+		// subnet, which stay pending until they expire.
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		expiry := uint64(time.Now().Add(time.Hour).UnixNano())
+		var wg sync.WaitGroup
+		for i, canisterID := range []principal.Principal{canisterA, canisterB} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := p.Wait(ctx, agent.CallJournalEntry{
+					RequestID:           agent.RequestID{byte(i)},
+					EffectiveCanisterID: canisterID,
+					IngressExpiry:       expiry,
+				})
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("expected deadline exceeded, got %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		if maxPaths != 2 {
+			t.Errorf("expected a read_state request for both canisters, got at most %d paths", maxPaths)
+		}
+	})
+
+	t.Run("unknown after expiry", func(t *testing.T) {
+		expectUnknown(t, agent.CallJournalEntry{
+			RequestID:           agent.RequestID{2},
+			EffectiveCanisterID: canisterB,
+			IngressExpiry:       uint64(time.Now().Add(-time.Hour).UnixNano()),
+		}, "unknown")
+	})
+
+	t.Run("done", func(t *testing.T) {
+		req, err := a.CreateCandidAPIRequest(agent.RequestTypeCall, canisterA, "echo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		requestID, err := req.Submit(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoveReply(requestID)
+		expectUnknown(t, req.JournalEntry(), "done")
+	})
+}
@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultPrometheusBuckets are the default histogram buckets, in seconds.
+var DefaultPrometheusBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// PrometheusMetrics is an in-memory implementation of Metrics that exposes the
+// recorded metrics in the Prometheus text exposition format. It can be served
+// directly as an HTTP handler, e.g. on "/metrics".
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+// NewPrometheusMetrics returns new metrics that use the given histogram
+// buckets, or DefaultPrometheusBuckets if none are given.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultPrometheusBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		buckets:    buckets,
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+// AddCounter adds the given value to a counter.
+func (m *PrometheusMetrics) AddCounter(name string, value float64, labels ...Label) {
+	key := formatLabels(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.counters[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.counters[name] = series
+	}
+	series[key] += value
+}
+
+// ObserveHistogram adds an observation to a histogram.
+func (m *PrometheusMetrics) ObserveHistogram(name string, value float64, labels ...Label) {
+	key := formatLabels(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.histograms[name]
+	if !ok {
+		series = make(map[string]*histogram)
+		m.histograms[name] = series
+	}
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		series[key] = h
+	}
+	for i, bound := range m.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text format to w. The metrics
+// and their series are sorted by name and labels.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	m.mu.Lock()
+	for _, name := range sortedKeys(m.counters) {
+		series := m.counters[name]
+		cw.write("# TYPE ", name, " counter\n")
+		for _, labels := range sortedKeys(series) {
+			cw.write(name, labels, " ", formatFloat(series[labels]), "\n")
+		}
+	}
+	for _, name := range sortedKeys(m.histograms) {
+		series := m.histograms[name]
+		cw.write("# TYPE ", name, " histogram\n")
+		for _, labels := range sortedKeys(series) {
+			h := series[labels]
+			for i, bound := range m.buckets {
+				cw.write(name, "_bucket", withLabel(labels, "le", formatFloat(bound)), " ", strconv.FormatUint(h.counts[i], 10), "\n")
+			}
+			cw.write(name, "_bucket", withLabel(labels, "le", "+Inf"), " ", strconv.FormatUint(h.count, 10), "\n")
+			cw.write(name, "_sum", labels, " ", formatFloat(h.sum), "\n")
+			cw.write(name, "_count", labels, " ", strconv.FormatUint(h.count, 10), "\n")
+		}
+	}
+	m.mu.Unlock()
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) write(parts ...string) {
+	for _, p := range parts {
+		if w.err != nil {
+			return
+		}
+		n, err := w.w.WriteString(p)
+		w.n += int64(n)
+		w.err = err
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// formatLabels formats the labels as "{name="value",...}", sorted by name.
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	labels = append([]Label(nil), labels...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withLabel appends a label to formatted labels.
+func withLabel(labels, name, value string) string {
+	l := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + l + "}"
+	}
+	return labels[:len(labels)-1] + "," + l + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/ed25519"
 	"fmt"
+	"time"
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/niccolofant/agent-go/certification"
@@ -20,8 +21,8 @@ import (
 //
 // Call WithEffectiveCanisterID, when needed, before sharing the request between
 // goroutines; mutating it concurrently with execution is not supported.
-func (a *Agent) PrepareQuery(canisterID principal.Principal, methodName string, in []any) (*CandidAPIRequest, error) {
-	return a.CreateCandidAPIRequest(RequestTypeQuery, canisterID, methodName, in...)
+func (a *Agent) PrepareQuery(canisterID principal.Principal, methodName string, in []any, options ...RequestOption) (*CandidAPIRequest, error) {
+	return a.createCandidAPIRequest(RequestTypeQuery, canisterID, methodName, in, options)
 }
 
 // Query calls a method on a canister and unmarshals the result into the given values.
@@ -48,85 +49,68 @@ func (q APIRequest[In, Out]) QueryContext(ctx context.Context, out Out, skipVeri
 // argument without decoding it with the request's payload codec. It is useful
 // for replica races that need to defer expensive Candid decoding until a
 // response is actually considered for semantic freshness.
-func (q APIRequest[In, Out]) QueryRawContext(ctx context.Context, skipVerification bool) ([]byte, error) {
+func (q APIRequest[In, Out]) QueryRawContext(ctx context.Context, skipVerification bool) (raw []byte, err error) {
 	q.a.logger.Printf("[AGENT] QUERY %s %s", q.effectiveCanisterID, q.methodName)
 	if ctx == nil {
 		ctx = q.a.ctx
 	}
+	ctx, span := q.a.startSpan(ctx, "agent.query", q.canisterID, q.methodName)
+	start := q.a.startTimer()
+	defer func() {
+		q.a.recordRequest(RequestTypeQuery, q.canisterID, q.methodName, start, err)
+		endSpan(span, err)
+	}()
+	skipVerification = skipVerification || q.skipVerification
+	if skipVerification && q.a.client.untrusted() {
+		return nil, ErrUntrustedRoute
+	}
+	if q.a.queryCache != nil && q.typ == RequestTypeQuery {
+		verified := !skipVerification && q.a.verifySignatures
+		return q.a.queryCache.do(ctx, q.cacheKey, q.methodName, verified, func(ctx context.Context) ([]byte, time.Time, error) {
+			return q.queryRaw(ctx, skipVerification)
+		})
+	}
+	raw, _, err = q.queryRaw(ctx, skipVerification)
+	return raw, err
+}
+
+// queryRaw executes the query and returns the raw reply and, if the
+// signatures were verified, the time of the earliest signature.
+func (q APIRequest[In, Out]) queryRaw(ctx context.Context, skipVerification bool) ([]byte, time.Time, error) {
 	ctx, cancel := context.WithTimeout(ctx, q.a.ingressExpiry)
 	defer cancel()
-	rawResp, err := q.a.client.Query(ctx, q.effectiveCanisterID, q.data)
+	var signedAt time.Time
+	d := newCachedDecoder(func(ctx context.Context, raw []byte) *Outcome {
+		reply, t, err := q.decodeResponse(ctx, raw, skipVerification)
+		signedAt = t
+		return &Outcome{Reply: reply, Err: err}
+	})
+	rawResp, err := q.a.client.Query(withDecoder(ctx, d.do), q.effectiveCanisterID, q.data)
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
+	outcome := d.do(ctx, rawResp)
+	return outcome.Reply, signedAt, outcome.Err
+}
+
+// decodeResponse decodes and verifies the raw query response, and returns the
+// reply and, if the signatures were verified, the time of the earliest
+// signature.
+func (q APIRequest[In, Out]) decodeResponse(ctx context.Context, rawResp []byte, skipVerification bool) ([]byte, time.Time, error) {
 	var resp Response
 	if err := cbor.Unmarshal(rawResp, &resp); err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	// Verify query signatures.
+	var signedAt time.Time
 	if !skipVerification && q.a.verifySignatures {
-		if len(resp.Signatures) == 0 {
-			return nil, fmt.Errorf("no signatures")
-		}
-		if len(q.effectiveCanisterID.Raw) == 0 {
-			return nil, fmt.Errorf("can not verify signature without effective canister ID")
-		}
-
-		keys, err := q.a.queryVerificationKeys(ctx, q.effectiveCanisterID, resp.Signatures)
-		if err != nil {
-			return nil, err
+		if err := q.verifySignatures(ctx, resp); err != nil {
+			return nil, time.Time{}, err
 		}
 		for _, signature := range resp.Signatures {
-			publicKey, ok := keys.publicKey(signature.Identity)
-			if !ok {
-				return nil, fmt.Errorf("no public key found for signature identity %s", signature.Identity)
-			}
-			switch resp.Status {
-			case "replied":
-				sig, err := certification.RepresentationIndependentHash(
-					[]certification.KeyValuePair{
-						{Key: "status", Value: resp.Status},
-						{Key: "reply", Value: resp.Reply},
-						{Key: "timestamp", Value: signature.Timestamp},
-						{Key: "request_id", Value: q.requestID[:]},
-					},
-				)
-				if err != nil {
-					return nil, err
-				}
-				if !ed25519.Verify(
-					publicKey,
-					append([]byte("\x0Bic-response"), sig[:]...),
-					signature.Signature,
-				) {
-					return nil, fmt.Errorf("invalid replied signature")
-				}
-			case "rejected":
-				var codeBuf [10]byte
-				code := leb128.AppendUnsignedUint64(codeBuf[:0], uint64(resp.RejectCode))
-				sig, err := certification.RepresentationIndependentHash(
-					[]certification.KeyValuePair{
-						{Key: "status", Value: resp.Status},
-						{Key: "reject_code", Value: code},
-						{Key: "reject_message", Value: resp.RejectMsg},
-						{Key: "error_code", Value: resp.ErrorCode},
-						{Key: "timestamp", Value: signature.Timestamp},
-						{Key: "request_id", Value: q.requestID[:]},
-					},
-				)
-				if err != nil {
-					return nil, err
-				}
-				if !ed25519.Verify(
-					publicKey,
-					append([]byte("\x0Bic-response"), sig[:]...),
-					signature.Signature,
-				) {
-					return nil, fmt.Errorf("invalid rejected signature")
-				}
-			default:
-				panic("unreachable")
+			if t := time.Unix(0, signature.Timestamp); signedAt.IsZero() || t.Before(signedAt) {
+				signedAt = t
 			}
 		}
 	}
@@ -136,28 +120,105 @@ func (q APIRequest[In, Out]) QueryRawContext(ctx context.Context, skipVerificati
 			Arg []byte `ic:"arg"`
 		}
 		if err := cbor.Unmarshal(resp.Reply, &reply); err != nil {
-			return nil, err
+			return nil, time.Time{}, err
 		}
-		return reply.Arg, nil
+		return reply.Arg, signedAt, nil
 	case "rejected":
-		return nil, preprocessingError{
-			RejectCode: resp.RejectCode,
+		return nil, time.Time{}, &RejectError{
+			CanisterID: q.canisterID,
+			MethodName: q.methodName,
+			RejectCode: RejectCode(resp.RejectCode),
 			Message:    resp.RejectMsg,
 			ErrorCode:  resp.ErrorCode,
 		}
 	default:
-		panic("unreachable")
+		return nil, time.Time{}, fmt.Errorf("unknown query status: %s", resp.Status)
+	}
+}
+
+// verifySignatures verifies the node signatures of a query response.
+func (q APIRequest[In, Out]) verifySignatures(ctx context.Context, resp Response) (err error) {
+	if len(resp.Signatures) == 0 {
+		return &VerificationError{Err: fmt.Errorf("no signatures")}
+	}
+	if len(q.effectiveCanisterID.Raw) == 0 {
+		return fmt.Errorf("can not verify signature without effective canister ID")
+	}
+
+	keys, err := q.a.queryVerificationKeys(ctx, q.effectiveCanisterID, resp.Signatures)
+	if err != nil {
+		return err
+	}
+
+	_, span := q.a.startSpan(ctx, "agent.verify_query_signature", q.effectiveCanisterID, q.methodName)
+	start := q.a.startTimer()
+	defer func() {
+		q.a.recordVerification("query_signature", start, err)
+		endSpan(span, err)
+	}()
+	for _, signature := range resp.Signatures {
+		publicKey, ok := keys.publicKey(signature.Identity)
+		if !ok {
+			return &VerificationError{Err: fmt.Errorf("no public key found for signature identity %s", signature.Identity)}
+		}
+		switch resp.Status {
+		case "replied":
+			sig, err := certification.RepresentationIndependentHash(
+				[]certification.KeyValuePair{
+					{Key: "status", Value: resp.Status},
+					{Key: "reply", Value: resp.Reply},
+					{Key: "timestamp", Value: signature.Timestamp},
+					{Key: "request_id", Value: q.requestID[:]},
+				},
+			)
+			if err != nil {
+				return err
+			}
+			if !ed25519.Verify(
+				publicKey,
+				append([]byte("\x0Bic-response"), sig[:]...),
+				signature.Signature,
+			) {
+				return &VerificationError{Err: fmt.Errorf("invalid replied signature")}
+			}
+		case "rejected":
+			var codeBuf [10]byte
+			code := leb128.AppendUnsignedUint64(codeBuf[:0], uint64(resp.RejectCode))
+			sig, err := certification.RepresentationIndependentHash(
+				[]certification.KeyValuePair{
+					{Key: "status", Value: resp.Status},
+					{Key: "reject_code", Value: code},
+					{Key: "reject_message", Value: resp.RejectMsg},
+					{Key: "error_code", Value: resp.ErrorCode},
+					{Key: "timestamp", Value: signature.Timestamp},
+					{Key: "request_id", Value: q.requestID[:]},
+				},
+			)
+			if err != nil {
+				return err
+			}
+			if !ed25519.Verify(
+				publicKey,
+				append([]byte("\x0Bic-response"), sig[:]...),
+				signature.Signature,
+			) {
+				return &VerificationError{Err: fmt.Errorf("invalid rejected signature")}
+			}
+		default:
+			return &VerificationError{Err: fmt.Errorf("unknown query status: %s", resp.Status)}
+		}
 	}
+	return nil
 }
 
 // Query calls a method on a canister and unmarshals the result into the given values.
-func (a Agent) Query(canisterID principal.Principal, methodName string, in, out []any) error {
-	return a.QueryContext(a.ctx, canisterID, methodName, in, out)
+func (a Agent) Query(canisterID principal.Principal, methodName string, in, out []any, options ...RequestOption) error {
+	return a.QueryContext(a.ctx, canisterID, methodName, in, out, options...)
 }
 
 // QueryContext calls a method on a canister and unmarshals the result into the given values.
-func (a Agent) QueryContext(ctx context.Context, canisterID principal.Principal, methodName string, in, out []any) error {
-	query, err := a.PrepareQuery(canisterID, methodName, in)
+func (a Agent) QueryContext(ctx context.Context, canisterID principal.Principal, methodName string, in, out []any, options ...RequestOption) error {
+	query, err := a.PrepareQuery(canisterID, methodName, in, options...)
 	if err != nil {
 		return err
 	}
@@ -166,13 +227,13 @@ func (a Agent) QueryContext(ctx context.Context, canisterID principal.Principal,
 
 // QueryProto calls a method on a canister and unmarshals the result into the given proto message.
 // Verifies query signatures by default; set Config.DisableSignedQueryVerification to opt out.
-func (a Agent) QueryProto(canisterID principal.Principal, methodName string, in, out proto.Message) error {
-	return a.QueryProtoContext(a.ctx, canisterID, methodName, in, out)
+func (a Agent) QueryProto(canisterID principal.Principal, methodName string, in, out proto.Message, options ...RequestOption) error {
+	return a.QueryProtoContext(a.ctx, canisterID, methodName, in, out, options...)
 }
 
 // QueryProtoContext calls a method on a canister and unmarshals the result into the given proto message.
-func (a Agent) QueryProtoContext(ctx context.Context, canisterID principal.Principal, methodName string, in, out proto.Message) error {
-	query, err := a.CreateProtoAPIRequest(RequestTypeQuery, canisterID, methodName, in)
+func (a Agent) QueryProtoContext(ctx context.Context, canisterID principal.Principal, methodName string, in, out proto.Message, options ...RequestOption) error {
+	query, err := a.CreateProtoAPIRequest(RequestTypeQuery, canisterID, methodName, in, options...)
 	if err != nil {
 		return err
 	}
@@ -184,8 +245,8 @@ func (a Agent) QueryProtoContext(ctx context.Context, canisterID principal.Princ
 // Example:
 //
 //	reply, err := a.QueryRaw(canisterID, "lookup", cborBytes)
-func (a Agent) QueryRaw(canisterID principal.Principal, methodName string, arg []byte) ([]byte, error) {
-	query, err := a.CreateRawAPIRequest(RequestTypeQuery, canisterID, methodName, arg)
+func (a Agent) QueryRaw(canisterID principal.Principal, methodName string, arg []byte, options ...RequestOption) ([]byte, error) {
+	query, err := a.CreateRawAPIRequest(RequestTypeQuery, canisterID, methodName, arg, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -198,14 +259,14 @@ func (a Agent) QueryRaw(canisterID principal.Principal, methodName string, arg [
 
 // QueryWithContext is like Query but uses the given context as the parent of the
 // per-request timeout, letting the caller cancel an in-flight query.
-func (a Agent) QueryWithContext(ctx context.Context, canisterID principal.Principal, methodName string, in, out []any) error {
-	return a.QueryContext(ctx, canisterID, methodName, in, out)
+func (a Agent) QueryWithContext(ctx context.Context, canisterID principal.Principal, methodName string, in, out []any, options ...RequestOption) error {
+	return a.QueryContext(ctx, canisterID, methodName, in, out, options...)
 }
 
 // QueryWithEffectiveCanisterID is like Query but lets the caller supply the effective
 // canister ID. Symmetric with CallWithEffectiveCanisterID.
-func (a Agent) QueryWithEffectiveCanisterID(canisterID, effectiveCanisterID principal.Principal, methodName string, in, out []any) error {
-	query, err := a.PrepareQuery(canisterID, methodName, in)
+func (a Agent) QueryWithEffectiveCanisterID(canisterID, effectiveCanisterID principal.Principal, methodName string, in, out []any, options ...RequestOption) error {
+	query, err := a.PrepareQuery(canisterID, methodName, in, options...)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// QueryCacheConfig is the configuration of the query response cache. The zero
+// value uses the defaults.
+type QueryCacheConfig struct {
+	// TTL is the time a response is cached, counted from the time it was
+	// signed by the replica. Defaults to 1 second.
+	TTL time.Duration
+	// MethodTTLs overrides the TTL per method name. A negative TTL disables
+	// caching and coalescing for the method.
+	MethodTTLs map[string]time.Duration
+	// MaxEntries is the maximum number of cached responses. Defaults to 1024.
+	MaxEntries int
+	// MaxBytes is the maximum total size of the cached replies. Defaults to
+	// 16 MiB.
+	MaxBytes int
+}
+
+// queryCacheKey identifies a query by canister, method, argument and sender.
+type queryCacheKey [sha256.Size]byte
+
+func newQueryCacheKey(request Request) queryCacheKey {
+	h := sha256.New()
+	for _, field := range [][]byte{
+		request.CanisterID.Raw,
+		[]byte(request.MethodName),
+		request.Arguments,
+		request.Sender.Raw,
+	} {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(field)))
+		h.Write(field)
+	}
+	var key queryCacheKey
+	h.Sum(key[:0])
+	return key
+}
+
+// queryCache caches verified query replies and coalesces identical
+// concurrent queries. Entries are evicted in least recently used order.
+type queryCache struct {
+	config QueryCacheConfig
+
+	mu       sync.Mutex
+	entries  map[queryCacheKey]*list.Element
+	lru      *list.List
+	bytes    int
+	inFlight map[queryFlightKey]*queryFlight
+}
+
+func newQueryCache(config QueryCacheConfig) *queryCache {
+	if config.TTL == 0 {
+		config.TTL = time.Second
+	}
+	if config.MaxEntries == 0 {
+		config.MaxEntries = 1024
+	}
+	if config.MaxBytes == 0 {
+		config.MaxBytes = 16 << 20
+	}
+	return &queryCache{
+		config:   config,
+		entries:  make(map[queryCacheKey]*list.Element),
+		lru:      list.New(),
+		inFlight: make(map[queryFlightKey]*queryFlight),
+	}
+}
+
+// clear removes all entries.
+func (c *queryCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// do returns the cached reply of the query, or executes it. Identical
+// concurrent queries share a single execution. Only replies of verified
+// queries are cached.
+func (c *queryCache) do(ctx context.Context, key queryCacheKey, methodName string, verified bool, query func(ctx context.Context) ([]byte, time.Time, error)) ([]byte, error) {
+	ttl := c.ttl(methodName)
+	if ttl < 0 {
+		reply, _, err := query(ctx)
+		return reply, err
+	}
+
+	c.mu.Lock()
+	if reply, ok := c.getLocked(key); ok {
+		c.mu.Unlock()
+		return slices.Clone(reply), nil
+	}
+	flightKey := queryFlightKey{key: key, verified: verified}
+	if f, ok := c.inFlight[flightKey]; ok {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if f.err != nil && isContextError(f.err) && ctx.Err() == nil {
+			// The context of the first caller was canceled, not ours.
+			reply, _, err := query(ctx)
+			return reply, err
+		}
+		return slices.Clone(f.reply), f.err
+	}
+	f := &queryFlight{done: make(chan struct{})}
+	c.inFlight[flightKey] = f
+	c.mu.Unlock()
+
+	var (
+		reply    []byte
+		signedAt time.Time
+		err      = errQueryPanicked
+	)
+	// The waiting callers are released, even if the query panics.
+	defer func() {
+		f.reply, f.err = reply, err
+		c.mu.Lock()
+		delete(c.inFlight, flightKey)
+		if err == nil && verified && !signedAt.IsZero() {
+			c.storeLocked(key, reply, signedAt.Add(ttl))
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+	reply, signedAt, err = query(ctx)
+	return slices.Clone(reply), err
+}
+
+func (c *queryCache) getLocked(key queryCacheKey) ([]byte, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*queryCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeLocked(e)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.reply, true
+}
+
+func (c *queryCache) removeLocked(e *list.Element) {
+	entry := c.lru.Remove(e).(*queryCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= len(entry.reply)
+}
+
+func (c *queryCache) storeLocked(key queryCacheKey, reply []byte, expiresAt time.Time) {
+	if len(reply) > c.config.MaxBytes || !time.Now().Before(expiresAt) {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		c.removeLocked(e)
+	}
+	c.entries[key] = c.lru.PushFront(&queryCacheEntry{key: key, reply: reply, expiresAt: expiresAt})
+	c.bytes += len(reply)
+	for len(c.entries) > c.config.MaxEntries || c.bytes > c.config.MaxBytes {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *queryCache) ttl(methodName string) time.Duration {
+	if ttl, ok := c.config.MethodTTLs[methodName]; ok {
+		return ttl
+	}
+	return c.config.TTL
+}
+
+type queryCacheEntry struct {
+	key       queryCacheKey
+	reply     []byte
+	expiresAt time.Time
+}
+
+// errQueryPanicked is the error of the callers that wait for a query that
+// panicked.
+var errQueryPanicked = errors.New("query panicked")
+
+type queryFlight struct {
+	done  chan struct{}
+	reply []byte
+	err   error
+}
+
+type queryFlightKey struct {
+	key      queryCacheKey
+	verified bool
+}
+
+// ClearQueryCache removes all cached query responses, e.g. after an update
+// call that changed the state that is queried.
+func (a Agent) ClearQueryCache() {
+	if a.queryCache != nil {
+		a.queryCache.clear()
+	}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueryCacheReleasesWaitersOnPanic(t *testing.T) {
+	c := newQueryCache(QueryCacheConfig{})
+	var key queryCacheKey
+
+	var f *queryFlight
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the query to panic")
+			}
+		}()
+		_, _ = c.do(context.Background(), key, "greet", true, func(context.Context) ([]byte, time.Time, error) {
+			c.mu.Lock()
+			f = c.inFlight[queryFlightKey{key: key, verified: true}]
+			c.mu.Unlock()
+			panic("boom")
+		})
+	}()
+
+	select {
+	case <-f.done:
+	default:
+		t.Fatal("waiters of the panicked query are not released")
+	}
+	if !errors.Is(f.err, errQueryPanicked) {
+		t.Errorf("got error %v, want %v", f.err, errQueryPanicked)
+	}
+	if len(c.inFlight) != 0 {
+		t.Errorf("got %d queries in flight, want 0", len(c.inFlight))
+	}
+
+	reply, err := c.do(context.Background(), key, "greet", true, func(context.Context) ([]byte, time.Time, error) {
+		return []byte("reply"), time.Now(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "reply" {
+		t.Errorf("got %q, want %q", reply, "reply")
+	}
+}
@@ -0,0 +1,134 @@
+package agent_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestQueryCache(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica()
+	defer r.Close()
+	var calls atomic.Int64
+	release := make(chan struct{})
+	close(release)
+	var releaseMu sync.Mutex
+	handler := func(call agenttest.Call) ([]any, error) {
+		calls.Add(1)
+		releaseMu.Lock()
+		ch := release
+		releaseMu.Unlock()
+		<-ch
+		var name string
+		if err := call.Decode(&name); err != nil {
+			return nil, err
+		}
+		return []any{"Hello, " + name + "!"}, nil
+	}
+	r.HandleQuery(canisterID, "greet", handler)
+	r.HandleQuery(canisterID, "uncached", handler)
+
+	newAgent := func(t *testing.T, config agent.QueryCacheConfig, disableVerification bool) *agent.Agent {
+		cfg := r.AgentConfig()
+		cfg.QueryCache = &config
+		cfg.DisableSignedQueryVerification = disableVerification
+		a, err := agent.New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	query := func(t *testing.T, a *agent.Agent, methodName, name string) {
+		var out string
+		if err := a.Query(canisterID, methodName, []any{name}, []any{&out}); err != nil {
+			t.Error(err)
+			return
+		}
+		if want := "Hello, " + name + "!"; out != want {
+			t.Errorf("got %q, want %q", out, want)
+		}
+	}
+	expectCalls := func(t *testing.T, want int64) {
+		t.Helper()
+		if got := calls.Swap(0); got != want {
+			t.Errorf("got %d calls, want %d", got, want)
+		}
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		a := newAgent(t, agent.QueryCacheConfig{
+			TTL:        time.Minute,
+			MethodTTLs: map[string]time.Duration{"uncached": -1},
+		}, false)
+		query(t, a, "greet", "a")
+		query(t, a, "greet", "a")
+		query(t, a, "greet", "b")
+		expectCalls(t, 2)
+
+		query(t, a, "uncached", "a")
+		query(t, a, "uncached", "a")
+		expectCalls(t, 2)
+
+		a.ClearQueryCache()
+		query(t, a, "greet", "a")
+		expectCalls(t, 1)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		a := newAgent(t, agent.QueryCacheConfig{TTL: 50 * time.Millisecond}, false)
+		query(t, a, "greet", "a")
+		time.Sleep(100 * time.Millisecond)
+		query(t, a, "greet", "a")
+		expectCalls(t, 2)
+	})
+
+	t.Run("evicted", func(t *testing.T) {
+		a := newAgent(t, agent.QueryCacheConfig{TTL: time.Minute, MaxEntries: 1}, false)
+		query(t, a, "greet", "a")
+		query(t, a, "greet", "b")
+		query(t, a, "greet", "a")
+		expectCalls(t, 3)
+	})
+
+	t.Run("unverified", func(t *testing.T) {
+		a := newAgent(t, agent.QueryCacheConfig{TTL: time.Minute}, true)
+		query(t, a, "greet", "a")
+		query(t, a, "greet", "a")
+		expectCalls(t, 2)
+	})
+
+	t.Run("coalesced", func(t *testing.T) {
+		a := newAgent(t, agent.QueryCacheConfig{TTL: time.Minute}, false)
+		// Fetch the verification keys before blocking the handler.
+		if err := a.WarmQueryVerificationCache(canisterID); err != nil {
+			t.Fatal(err)
+		}
+		blocked := make(chan struct{})
+		releaseMu.Lock()
+		release = blocked
+		releaseMu.Unlock()
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				query(t, a, "greet", "c")
+			}()
+		}
+		// Wait until the first query reached the replica.
+		for calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		close(blocked)
+		wg.Wait()
+		expectCalls(t, 1)
+	})
+}
@@ -127,7 +127,9 @@ func (a Agent) refreshQueryVerificationKeys(ecID principal.Principal, identities
 	}()
 }
 
-func (a Agent) fetchQueryVerificationKeys(ctx context.Context, ecID principal.Principal, identities []principal.Principal) (*queryVerificationKeySet, error) {
+func (a Agent) fetchQueryVerificationKeys(ctx context.Context, ecID principal.Principal, identities []principal.Principal) (_ *queryVerificationKeySet, err error) {
+	ctx, span := a.startSpan(ctx, "agent.fetch_query_verification_keys", ecID, "")
+	defer func() { endSpan(span, err) }()
 	certificate, err := a.readStateCertificateContext(ctx, ecID, [][]hashtree.Label{{hashtree.Label("subnet")}})
 	if err != nil {
 		return nil, err
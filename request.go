@@ -3,6 +3,8 @@ package agent
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 
 	"github.com/niccolofant/agent-go/certification/hashtree"
 	"github.com/niccolofant/agent-go/identity"
@@ -211,6 +213,62 @@ func (r RequestID) Sign(id identity.Identity) ([]byte, error) {
 	return id.Sign(message)
 }
 
+// UnmarshalCBOR implements the CBOR unmarshaler interface.
+func (r *Request) UnmarshalCBOR(data []byte) error {
+	var m struct {
+		Type          RequestType `cbor:"request_type"`
+		CanisterID    []byte      `cbor:"canister_id"`
+		MethodName    string      `cbor:"method_name"`
+		Arguments     []byte      `cbor:"arg"`
+		Sender        []byte      `cbor:"sender"`
+		IngressExpiry uint64      `cbor:"ingress_expiry"`
+		Nonce         []byte      `cbor:"nonce"`
+		Paths         [][][]byte  `cbor:"paths"`
+	}
+	if err := cbor.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	var paths [][]hashtree.Label
+	if m.Paths != nil {
+		paths = make([][]hashtree.Label, len(m.Paths))
+		for i, path := range m.Paths {
+			paths[i] = make([]hashtree.Label, len(path))
+			for j, label := range path {
+				paths[i][j] = label
+			}
+		}
+	}
+	*r = Request{
+		Type:          m.Type,
+		Sender:        principal.Principal{Raw: m.Sender},
+		Nonce:         m.Nonce,
+		IngressExpiry: m.IngressExpiry,
+		CanisterID:    principal.Principal{Raw: m.CanisterID},
+		MethodName:    m.MethodName,
+		Arguments:     m.Arguments,
+		Paths:         paths,
+	}
+	return nil
+}
+
+// MarshalText encodes the request ID as a hexadecimal string.
+func (r RequestID) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(r[:])), nil
+}
+
+// UnmarshalText decodes the request ID from a hexadecimal string.
+func (r *RequestID) UnmarshalText(text []byte) error {
+	raw, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	if len(raw) != len(r) {
+		return fmt.Errorf("invalid request ID length: %d", len(raw))
+	}
+	copy(r[:], raw)
+	return nil
+}
+
 // RequestType is the type of request.
 type RequestType = string
 
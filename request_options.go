@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/niccolofant/agent-go/identity"
+)
+
+// RequestOption configures a single request, overriding the configuration of
+// the agent. This lets a single agent send requests on behalf of many users.
+//
+// Example:
+//
+//	err := a.Call(canisterID, "transfer", in, out, agent.WithIdentity(user), agent.WithPollTimeout(time.Minute))
+type RequestOption func(o *requestOptions)
+
+type requestOptions struct {
+	identity         identity.Identity
+	ingressExpiry    time.Duration
+	nonce            []byte
+	pollTimeout      time.Duration
+	skipVerification bool
+}
+
+// WithIdentity signs the request with the given identity instead of the
+// identity of the agent. The status of a call is polled with the same
+// identity.
+func WithIdentity(id identity.Identity) RequestOption {
+	return func(o *requestOptions) {
+		o.identity = id
+	}
+}
+
+// WithIngressExpiry sets the duration for which the request is valid, and the
+// timeout of the HTTP requests that send it.
+func WithIngressExpiry(ingressExpiry time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.ingressExpiry = ingressExpiry
+	}
+}
+
+// WithNonce sets the nonce of the request instead of a random one. Requests
+// with the same content, expiry and nonce have the same request ID.
+func WithNonce(nonce []byte) RequestOption {
+	return func(o *requestOptions) {
+		o.nonce = nonce
+	}
+}
+
+// WithPollTimeout sets the maximum time to wait for the result of a call.
+func WithPollTimeout(timeout time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.pollTimeout = timeout
+	}
+}
+
+// WithSkipVerification skips the verification of the node signatures of a
+// query response. The certificates of calls are always verified.
+func WithSkipVerification() RequestOption {
+	return func(o *requestOptions) {
+		o.skipVerification = true
+	}
+}
+
+// withRequestOptions returns a copy of the agent that applies the given
+// options, or the agent itself if there are none. The copy shares the client
+// and the caches of the agent.
+func (a *Agent) withRequestOptions(options []RequestOption) (*Agent, requestOptions) {
+	var o requestOptions
+	if len(options) == 0 {
+		return a, o
+	}
+	for _, option := range options {
+		option(&o)
+	}
+	c := *a
+	if o.identity != nil {
+		c.identity = o.identity
+		c.sender = o.identity.Sender()
+		c.senderPubKey = o.identity.PublicKey()
+	}
+	if o.ingressExpiry != 0 {
+		c.ingressExpiry = o.ingressExpiry
+	}
+	if o.pollTimeout != 0 {
+		c.timeout = o.pollTimeout
+	}
+	return &c, o
+}
@@ -0,0 +1,128 @@
+package agent_test
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/identity"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestRequestOptions(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls())
+	defer r.Close()
+	var calls atomic.Int64
+	whoami := func(call agenttest.Call) ([]any, error) {
+		calls.Add(1)
+		return []any{call.Sender}, nil
+	}
+	r.HandleQuery(canisterID, "whoami", whoami)
+
+	t.Run("identity", func(t *testing.T) {
+		a, err := agent.New(r.AgentConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := identity.NewRandomEd25519Identity()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var sender principal.Principal
+		if err := a.Query(canisterID, "whoami", nil, []any{&sender}, agent.WithIdentity(id)); err != nil {
+			t.Fatal(err)
+		}
+		if !sender.Equal(id.Sender()) {
+			t.Errorf("got %s, want %s", sender, id.Sender())
+		}
+		// The status of the call is polled with the same identity.
+		if err := a.Call(canisterID, "whoami", nil, []any{&sender}, agent.WithIdentity(id)); err != nil {
+			t.Fatal(err)
+		}
+		if !sender.Equal(id.Sender()) {
+			t.Errorf("got %s, want %s", sender, id.Sender())
+		}
+
+		// The identity of the agent is not changed.
+		if err := a.Query(canisterID, "whoami", nil, []any{&sender}); err != nil {
+			t.Fatal(err)
+		}
+		if !sender.Equal(principal.AnonymousID) {
+			t.Errorf("got %s, want %s", sender, principal.AnonymousID)
+		}
+	})
+
+	t.Run("nonce", func(t *testing.T) {
+		nonce := []byte{1, 2, 3}
+		var got []byte
+		cfg := r.AgentConfig()
+		cfg.Interceptors = []agent.Interceptor{
+			func(ctx context.Context, op *agent.Operation, next agent.Invoker) ([]byte, error) {
+				if op.Type == agent.RequestTypeQuery {
+					got = op.Request.Nonce
+				}
+				return next(ctx, op)
+			},
+		}
+		a, err := agent.New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Query(canisterID, "whoami", nil, []any{new(principal.Principal)}, agent.WithNonce(nonce)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, nonce) {
+			t.Errorf("got nonce %x, want %x", got, nonce)
+		}
+	})
+
+	t.Run("poll timeout", func(t *testing.T) {
+		cfg := r.AgentConfig()
+		cfg.PollTimeout = time.Minute
+		cfg.Interceptors = []agent.Interceptor{
+			func(ctx context.Context, op *agent.Operation, next agent.Invoker) ([]byte, error) {
+				if op.Type == agent.RequestTypeCall {
+					// Accept the call without submitting it.
+					return nil, nil
+				}
+				return next(ctx, op)
+			},
+		}
+		a, err := agent.New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if err := a.Call(canisterID, "whoami", nil, []any{new(principal.Principal)}, agent.WithPollTimeout(100*time.Millisecond)); err == nil {
+			t.Fatal("expected the call to time out")
+		}
+		if d := time.Since(start); d > 10*time.Second {
+			t.Errorf("call took %s", d)
+		}
+	})
+
+	t.Run("skip verification", func(t *testing.T) {
+		cfg := r.AgentConfig()
+		cfg.QueryCache = &agent.QueryCacheConfig{TTL: time.Minute}
+		a, err := agent.New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		calls.Store(0)
+		// Unverified replies are not cached.
+		for range 2 {
+			if err := a.Query(canisterID, "whoami", nil, []any{new(principal.Principal)}, agent.WithSkipVerification()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := calls.Load(); got != 2 {
+			t.Errorf("got %d calls, want 2", got)
+		}
+	})
+}
@@ -135,3 +135,35 @@ func TestRequest_MarshalCBOR(t *testing.T) {
 		t.Error(len(r))
 	}
 }
+
+func TestRequest_UnmarshalCBOR(t *testing.T) {
+	for _, request := range []agent.Request{
+		{
+			Type:          agent.RequestTypeCall,
+			Sender:        principal.AnonymousID,
+			Nonce:         []byte{0x01},
+			IngressExpiry: uint64(time.Now().Add(time.Minute).UnixNano()),
+			CanisterID:    principal.Principal{Raw: []byte{}},
+			MethodName:    "raw_rand",
+			Arguments:     []byte{},
+		},
+		{
+			Type:          agent.RequestTypeReadState,
+			Sender:        principal.AnonymousID,
+			Paths:         [][]hashtree.Label{{hashtree.Label("subnet")}},
+			IngressExpiry: uint64(time.Now().Add(time.Minute).UnixNano()),
+		},
+	} {
+		encoded, err := cbor.Marshal(&request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded agent.Request
+		if err := cbor.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if agent.NewRequestID(decoded) != agent.NewRequestID(request) {
+			t.Errorf("request ID mismatch: %+v", decoded)
+		}
+	}
+}
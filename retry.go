@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryPolicy is the retry policy that is used if none is configured.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	RetryableStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// RetryPolicy determines how requests to the IC are retried on transient
+// failures: network errors (connection resets, timeouts, unexpected EOFs) and
+// responses with a retryable HTTP status code.
+//
+// Retrying is always safe. A retried update call re-submits the exact same
+// signed envelope, so it has the same request ID and is executed at most once.
+//
+// Zero values are replaced by the values of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	// Set it to 1 to disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the delay grows after every attempt.
+	Multiplier float64
+	// Jitter is the fraction by which the delay is randomly varied, e.g. 0.2
+	// for ±20%. Set it to a negative value to disable jitter.
+	Jitter float64
+	// RetryableStatusCodes are the HTTP status codes that are retried.
+	RetryableStatusCodes []int
+	// RequestTypes overrides the policy for the given request types.
+	RequestTypes map[RequestType]RetryPolicy
+	// OnRetry, if non-nil, is called before every retry with the type of the
+	// request, the attempt that failed (starting at 1), the error and the delay
+	// before the next attempt.
+	OnRetry func(typ RequestType, attempt int, err error, delay time.Duration)
+}
+
+// backoff returns the delay after the given failed attempt, starting at 1. The
+// delay never exceeds MaxBackoff, jitter included.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	d = math.Min(d, float64(p.MaxBackoff))
+	return time.Duration(d)
+}
+
+// forType returns the policy for the given request type, with defaults applied.
+func (p RetryPolicy) forType(typ RequestType) RetryPolicy {
+	if override, ok := p.RequestTypes[typ]; ok {
+		if override.OnRetry == nil {
+			override.OnRetry = p.OnRetry
+		}
+		p = override
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if p.Multiplier <= 0 {
+		p.Multiplier = DefaultRetryPolicy.Multiplier
+	}
+	switch {
+	case p.Jitter == 0:
+		p.Jitter = DefaultRetryPolicy.Jitter
+	case p.Jitter < 0:
+		p.Jitter = 0
+	}
+	if p.RetryableStatusCodes == nil {
+		p.RetryableStatusCodes = DefaultRetryPolicy.RetryableStatusCodes
+	}
+	return p
+}
+
+// retryable returns whether the given error is worth retrying.
+func (p RetryPolicy) retryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return slices.Contains(p.RetryableStatusCodes, httpErr.StatusCode)
+	}
+	return isTransientError(err)
+}
+
+// retry calls f until it succeeds, returns a non-retryable error, the maximum
+// number of attempts is reached or the context is done.
+func (p RetryPolicy) retry(ctx context.Context, typ RequestType, logger Logger, f func() ([]byte, error)) ([]byte, error) {
+	p = p.forType(typ)
+	for attempt := 1; ; attempt++ {
+		raw, err := f()
+		if err == nil || attempt >= p.MaxAttempts || !p.retryable(err) || ctx.Err() != nil {
+			return raw, err
+		}
+		delay := p.backoff(attempt)
+		logger.Printf("[CLIENT] RETRY %s (attempt %d/%d) in %s: %v", typ, attempt, p.MaxAttempts, delay, err)
+		if p.OnRetry != nil {
+			p.OnRetry(typ, attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// isTransientError returns whether the error is a network error that might not
+// occur again, e.g. a connection reset or a timeout. Errors caused by a
+// cancelled context are never transient.
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &recordErr)
+}
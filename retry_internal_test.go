@@ -0,0 +1,19 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoffClampsJitter(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second,
+		Jitter:         0.5,
+	}.forType(RequestTypeCall)
+	for range 100 {
+		if d := p.backoff(3); d > p.MaxBackoff {
+			t.Fatalf("backoff = %s, want at most %s", d, p.MaxBackoff)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package agent_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica()
+	defer r.Close()
+
+	var executed int
+	r.HandleQuery(canisterID, "inc", func(call agenttest.Call) ([]any, error) {
+		executed++
+		return []any{uint64(executed)}, nil
+	})
+
+	// The proxy fails the first two attempts of every request with 503.
+	var (
+		mu       sync.Mutex
+		attempts = make(map[string][][]byte)
+	)
+	proxy := httputil.NewSingleHostReverseProxy(r.URL())
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			body, _ := io.ReadAll(req.Body)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			mu.Lock()
+			attempts[req.URL.Path] = append(attempts[req.URL.Path], body)
+			n := len(attempts[req.URL.Path])
+			mu.Unlock()
+			if n <= 2 {
+				http.Error(w, "overloaded", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		proxy.ServeHTTP(w, req)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+
+	var (
+		retries []agent.RequestType
+		delays  []time.Duration
+	)
+	a, err := agent.New(agent.Config{
+		ClientConfig: []agent.ClientOption{agent.WithHostURL(u)},
+		FetchRootKey: true,
+		RetryPolicy: &agent.RetryPolicy{
+			InitialBackoff: time.Millisecond,
+			Jitter:         -1,
+			OnRetry: func(typ agent.RequestType, attempt int, err error, delay time.Duration) {
+				retries = append(retries, typ)
+				delays = append(delays, delay)
+			},
+			RequestTypes: map[agent.RequestType]agent.RetryPolicy{
+				agent.RequestTypeQuery: {MaxAttempts: 1},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n uint64
+	if err := a.Call(canisterID, "inc", nil, []any{&n}); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || executed != 1 {
+		t.Errorf("executed %d times", executed)
+	}
+	callPath := "/api/v4/canister/" + canisterID.Encode() + "/call"
+	if got := attempts[callPath]; len(got) != 3 {
+		t.Errorf("call attempts = %d, want 3", len(got))
+	} else if !bytes.Equal(got[0], got[1]) || !bytes.Equal(got[0], got[2]) {
+		t.Error("expected the same envelope to be re-submitted")
+	}
+	if len(retries) != 2 || retries[0] != agent.RequestTypeCall {
+		t.Errorf("unexpected retries: %v", retries)
+	}
+	// Without jitter the delays are exact.
+	if len(delays) != 2 || delays[0] != time.Millisecond || delays[1] != 2*time.Millisecond {
+		t.Errorf("unexpected delays: %v", delays)
+	}
+
+	// Queries are not retried.
+	err = a.Query(canisterID, "inc", nil, []any{&n})
+	var httpErr *agent.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %v", err)
+	}
+	if got := attempts["/api/v2/canister/"+canisterID.Encode()+"/query"]; len(got) != 1 {
+		t.Errorf("query attempts = %d, want 1", len(got))
+	}
+}
+
+func TestRetryPolicy_notRetryable(t *testing.T) {
+	var attempts int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "invalid envelope", http.StatusBadRequest)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	a, err := agent.New(agent.Config{
+		ClientConfig: []agent.ClientOption{agent.WithHostURL(u)},
+		RetryPolicy:  &agent.RetryPolicy{InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Call(principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai"), "inc", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid envelope") {
+		t.Fatalf("expected error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DiscoveryRouteConfig is the configuration of a DiscoveryRoute. The zero
+// value uses the defaults.
+type DiscoveryRouteConfig struct {
+	// Interval is the interval at which the API boundary nodes are
+	// rediscovered. Defaults to 5 minutes.
+	Interval time.Duration
+	// Hosts are used until the first discovery succeeds. If empty, the
+	// initial discovery has to succeed.
+	Hosts []*url.URL
+	// NewRoute builds the route provider for a set of hosts, e.g.
+	// NewHealthAwareRoute. It is only called if the set of hosts changed.
+	// Replaced providers that have a Close method are closed. Defaults to
+	// RoundRobinRoute.
+	NewRoute func(hosts []*url.URL) (RouteProvider, error)
+	// Logger logs discoveries and their failures.
+	Logger Logger
+}
+
+// DiscoveryRoute is a RouteProvider that periodically rediscovers the API
+// boundary nodes from the certified api_boundary_nodes state, and atomically
+// swaps the set of hosts when it changes. If a discovery fails, the last known
+// good set of hosts is kept.
+//
+// Example:
+//
+//	rp, _ := agent.NewDiscoveryRoute(a, agent.DiscoveryRouteConfig{
+//		NewRoute: func(hosts []*url.URL) (agent.RouteProvider, error) {
+//			return agent.NewHealthAwareRoute(hosts, agent.HealthAwareRouteConfig{})
+//		},
+//	})
+//	defer rp.Close()
+//	a.Client().SetRouteProvider(rp)
+type DiscoveryRoute struct {
+	a       *Agent
+	config  DiscoveryRouteConfig
+	current atomic.Pointer[discoveredRoute]
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	// mu serializes swaps.
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewDiscoveryRoute discovers the API boundary nodes with the given agent and
+// starts rediscovering them in the background. The agent may use the returned
+// provider itself. The caller should call Close when finished, to stop the
+// rediscovery.
+func NewDiscoveryRoute(a *Agent, config DiscoveryRouteConfig) (*DiscoveryRoute, error) {
+	if config.Interval == 0 {
+		config.Interval = 5 * time.Minute
+	}
+	if config.NewRoute == nil {
+		config.NewRoute = RoundRobinRoute
+	}
+	if config.Logger == nil {
+		config.Logger = new(NoopLogger)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &DiscoveryRoute{
+		a:      a,
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if err := r.Refresh(ctx); err != nil {
+		if len(config.Hosts) == 0 {
+			cancel()
+			return nil, err
+		}
+		r.config.Logger.Printf("[ROUTE] DISCOVER failed, using %d configured hosts: %v", len(config.Hosts), err)
+		if err := r.swap(config.Hosts); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r, nil
+}
+
+// Close stops the rediscovery and closes the current route provider, if it
+// has a Close method. The last set of hosts remains routable.
+func (r *DiscoveryRoute) Close() {
+	r.cancel()
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	closeRoute(r.current.Load().route)
+}
+
+// Hosts returns the current set of hosts.
+func (r *DiscoveryRoute) Hosts() []*url.URL {
+	return slices.Clone(r.current.Load().hosts)
+}
+
+// Refresh discovers the API boundary nodes once and swaps the set of hosts if
+// it changed. On failure the current set of hosts is kept.
+func (r *DiscoveryRoute) Refresh(ctx context.Context) error {
+	hosts, err := discoverRoutes(ctx, r.a)
+	if err != nil {
+		return err
+	}
+	return r.swap(hosts)
+}
+
+// ReportResult forwards the result of a request to the current route
+// provider, if it implements RouteFeedback.
+func (r *DiscoveryRoute) ReportResult(host *url.URL, err error) {
+	if feedback, ok := r.current.Load().route.(RouteFeedback); ok {
+		feedback.ReportResult(host, err)
+	}
+}
+
+// Route returns a host of the current route provider.
+func (r *DiscoveryRoute) Route() (*url.URL, error) {
+	return r.current.Load().route.Route()
+}
+
+func (r *DiscoveryRoute) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Refresh(r.ctx); err != nil && !errors.Is(err, context.Canceled) {
+				r.config.Logger.Printf("[ROUTE] DISCOVER failed, keeping %d hosts: %v", len(r.current.Load().hosts), err)
+			}
+		}
+	}
+}
+
+// swap replaces the route provider if the set of hosts changed.
+func (r *DiscoveryRoute) swap(hosts []*url.URL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errors.New("discovery route: closed")
+	}
+	old := r.current.Load()
+	if old != nil && sameHosts(old.hosts, hosts) {
+		return nil
+	}
+	route, err := r.config.NewRoute(hosts)
+	if err != nil {
+		return err
+	}
+	r.config.Logger.Printf("[ROUTE] DISCOVER %d hosts", len(hosts))
+	r.current.Store(&discoveredRoute{hosts: hosts, route: route})
+	if old != nil {
+		closeRoute(old.route)
+	}
+	return nil
+}
+
+type discoveredRoute struct {
+	hosts []*url.URL
+	route RouteProvider
+}
+
+// closeRoute closes the route provider if it has a Close method.
+func closeRoute(rp RouteProvider) {
+	if closer, ok := rp.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
+
+// sameHosts reports whether both lists contain the same hosts, in any order.
+func sameHosts(a, b []*url.URL) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	hosts := make(map[string]int, len(a))
+	for _, u := range a {
+		hosts[u.String()]++
+	}
+	for _, u := range b {
+		hosts[u.String()]--
+	}
+	for _, n := range hosts {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package agent_test
+
+import (
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestDiscoveryRoute(t *testing.T) {
+	r := agenttest.NewReplica()
+	defer r.Close()
+	r.SetAPIBoundaryNodes([]agent.APIBoundaryNode{
+		{NodeID: principal.AnonymousID, Domain: "a.example"},
+	})
+	a, err := agent.New(r.AgentConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu     sync.Mutex
+		routes []*testRoute
+	)
+	rp, err := agent.NewDiscoveryRoute(a, agent.DiscoveryRouteConfig{
+		Interval: 10 * time.Millisecond,
+		NewRoute: func(hosts []*url.URL) (agent.RouteProvider, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			route := &testRoute{RouteProvider: agent.StaticRoute(hosts[0])}
+			routes = append(routes, route)
+			return route, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hostNames(rp.Hosts()); !slices.Equal(got, []string{"a.example"}) {
+		t.Fatalf("unexpected hosts %v", got)
+	}
+
+	// The host set is swapped in the background.
+	r.SetAPIBoundaryNodes([]agent.APIBoundaryNode{
+		{NodeID: principal.AnonymousID, Domain: "b.example"},
+		{NodeID: principal.Principal{Raw: []byte{0x01}}, Domain: "c.example"},
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Equal(hostNames(rp.Hosts()), []string{"b.example", "c.example"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("hosts were not rediscovered: %v", hostNames(rp.Hosts()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if u := route(t, rp); u.Host != "c.example" {
+		t.Errorf("unexpected route %s", u)
+	}
+
+	// The last known good set is kept if discovery fails.
+	r.Close()
+	time.Sleep(50 * time.Millisecond)
+	if got := hostNames(rp.Hosts()); !slices.Equal(got, []string{"b.example", "c.example"}) {
+		t.Fatalf("expected last known hosts, got %v", got)
+	}
+
+	rp.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(routes) != 2 || !routes[0].closed || !routes[1].closed {
+		t.Errorf("expected both route providers to be closed")
+	}
+	if u := route(t, rp); u.Host != "c.example" {
+		t.Errorf("unexpected route after close %s", u)
+	}
+}
+
+func TestClient_SetRouteProvider(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica()
+	defer r.Close()
+	r.HandleQuery(canisterID, "greet", func(call agenttest.Call) ([]any, error) {
+		return []any{"Hello!"}, nil
+	})
+	a, err := agent.New(r.AgentConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Swap the route provider while queries are in flight.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				var out string
+				if err := a.Query(canisterID, "greet", nil, []any{&out}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for range 10 {
+		a.Client().SetRouteProvider(agent.StaticRoute(r.URL()))
+	}
+	wg.Wait()
+
+	// The provider is shared with the agent.
+	a.Client().SetRouteProvider(agent.StaticRoute(&url.URL{Scheme: "http", Host: "127.0.0.1:1"}))
+	if err := a.Query(canisterID, "greet", nil, []any{new(string)}); err == nil {
+		t.Error("expected the new route provider to be used")
+	}
+}
+
+// testRoute records whether it was closed.
+type testRoute struct {
+	agent.RouteProvider
+	closed bool
+}
+
+func (r *testRoute) Close() {
+	r.closed = true
+}
+
+func hostNames(hosts []*url.URL) []string {
+	var names []string
+	for _, u := range hosts {
+		names = append(names, u.Host)
+	}
+	slices.Sort(names)
+	return names
+}
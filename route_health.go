@@ -0,0 +1,342 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RouteFeedback is implemented by route providers that want to learn about the
+// outcome of the requests sent to the hosts they returned. The client reports
+// the result of every HTTP request, including retries.
+type RouteFeedback interface {
+	// ReportResult reports the result of a request to the given host. The
+	// error is nil on success, an *HTTPError if the host responded with an
+	// error status, or the error returned by the HTTP client.
+	ReportResult(host *url.URL, err error)
+}
+
+// HealthAwareRouteConfig is the configuration of a HealthAwareRoute. The zero
+// value uses the defaults.
+type HealthAwareRouteConfig struct {
+	// ProbeInterval is the interval at which /api/v2/status is probed on every
+	// host. Defaults to 10 seconds.
+	ProbeInterval time.Duration
+	// ProbeTimeout is the timeout of a single probe. Defaults to 5 seconds.
+	ProbeTimeout time.Duration
+	// FailureThreshold is the number of consecutive failures after which a
+	// host is ejected. Defaults to 3.
+	FailureThreshold int
+	// ErrorRateThreshold is the error rate over the last WindowSize results
+	// at or above which a host is ejected. Defaults to 0.5.
+	ErrorRateThreshold float64
+	// WindowSize is the number of recent results the error rate is computed
+	// over. The error rate is only considered once the window is full.
+	// Defaults to 20.
+	WindowSize int
+	// EjectionDuration is the time an ejected host is not routed to. After
+	// it, the host is readmitted by the next successful probe. Defaults to 30
+	// seconds.
+	EjectionDuration time.Duration
+	// PreferredHosts is the number of lowest-latency healthy hosts that
+	// requests are spread over. Defaults to 3.
+	PreferredHosts int
+	// HTTPClient is the client that is used for probes. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// Logger logs ejections and readmissions.
+	Logger Logger
+}
+
+// HealthAwareRoute is a RouteProvider that routes to the lowest-latency
+// healthy hosts. Latency is measured by periodically probing /api/v2/status on
+// every host. Every host has a circuit breaker that ejects it after too many
+// consecutive failures, or a too high error rate, as reported by the client
+// and the probes. Ejected hosts are readmitted once a probe succeeds after the
+// ejection duration.
+//
+// If all hosts are ejected, the host that is readmitted first is returned, so
+// that requests still have a chance to succeed.
+//
+// Example:
+//
+//	hosts, _ := agent.DiscoverRoutes(a)
+//	rp, _ := agent.NewHealthAwareRoute(hosts, agent.HealthAwareRouteConfig{})
+//	defer rp.Close()
+//	a.Client().SetRouteProvider(rp)
+type HealthAwareRoute struct {
+	config HealthAwareRouteConfig
+	next   atomic.Uint64
+	done   chan struct{}
+	once   sync.Once
+
+	mu    sync.Mutex
+	hosts []*hostHealth
+}
+
+// NewHealthAwareRoute returns a new HealthAwareRoute for the given hosts and
+// starts probing them in the background. The caller should call Close when
+// finished, to stop probing.
+func NewHealthAwareRoute(hosts []*url.URL, config HealthAwareRouteConfig) (*HealthAwareRoute, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("health-aware route: no hosts")
+	}
+	if config.ProbeInterval == 0 {
+		config.ProbeInterval = 10 * time.Second
+	}
+	if config.ProbeTimeout == 0 {
+		config.ProbeTimeout = 5 * time.Second
+	}
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = 3
+	}
+	if config.ErrorRateThreshold == 0 {
+		config.ErrorRateThreshold = 0.5
+	}
+	if config.WindowSize == 0 {
+		config.WindowSize = 20
+	}
+	if config.EjectionDuration == 0 {
+		config.EjectionDuration = 30 * time.Second
+	}
+	if config.PreferredHosts == 0 {
+		config.PreferredHosts = 3
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.Logger == nil {
+		config.Logger = new(NoopLogger)
+	}
+	r := &HealthAwareRoute{
+		config: config,
+		done:   make(chan struct{}),
+	}
+	for _, host := range hosts {
+		r.hosts = append(r.hosts, &hostHealth{url: host, window: make([]bool, config.WindowSize)})
+	}
+	go r.run()
+	return r, nil
+}
+
+// Close stops probing the hosts.
+func (r *HealthAwareRoute) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+}
+
+// Probe probes /api/v2/status on all hosts once and updates their latency and
+// health.
+func (r *HealthAwareRoute) Probe(ctx context.Context) {
+	r.mu.Lock()
+	hosts := append([]*hostHealth(nil), r.hosts...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latency, err := r.probe(ctx, h.url)
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err == nil {
+				h.observeLatency(latency)
+			}
+			if h.ejected() {
+				if time.Now().Before(h.ejectedUntil) {
+					return
+				}
+				if err != nil {
+					h.ejectedUntil = time.Now().Add(r.config.EjectionDuration)
+					return
+				}
+				r.config.Logger.Printf("[ROUTE] READMIT %s", h.url)
+				h.reset()
+				return
+			}
+			r.record(h, err != nil)
+		}()
+	}
+	wg.Wait()
+}
+
+// ReportResult records the result of a request to the given host. Responses
+// with status 429 or 5xx and network errors count as failures, canceled
+// requests are ignored.
+func (r *HealthAwareRoute) ReportResult(host *url.URL, err error) {
+	var httpErr *HTTPError
+	failure := true
+	switch {
+	case err == nil:
+		failure = false
+	case errors.Is(err, context.Canceled):
+		return
+	case errors.As(err, &httpErr):
+		failure = httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, h := range r.hosts {
+		if h.url == host || h.url.String() == host.String() {
+			// Ejected hosts are only readmitted by probes.
+			if !h.ejected() {
+				r.record(h, failure)
+			}
+			return
+		}
+	}
+}
+
+// Route returns one of the lowest-latency healthy hosts. Hosts that have not
+// been probed yet are ranked after the probed ones.
+func (r *HealthAwareRoute) Route() (*url.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var healthy []*hostHealth
+	for _, h := range r.hosts {
+		if !h.ejected() {
+			healthy = append(healthy, h)
+		}
+	}
+	if len(healthy) == 0 {
+		first := r.hosts[0]
+		for _, h := range r.hosts[1:] {
+			if h.ejectedUntil.Before(first.ejectedUntil) {
+				first = h
+			}
+		}
+		return first.url, nil
+	}
+	sort.SliceStable(healthy, func(i, j int) bool {
+		return healthy[i].rank() < healthy[j].rank()
+	})
+	n := min(r.config.PreferredHosts, len(healthy))
+	i := r.next.Add(1) - 1
+	return healthy[int(i%uint64(n))].url, nil
+}
+
+func (r *HealthAwareRoute) probe(ctx context.Context, host *url.URL) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.ProbeTimeout)
+	defer cancel()
+	u := *host
+	u.Path = path.Join(u.Path, "/api/v2/status")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := r.config.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return time.Since(start), nil
+}
+
+// record records the result of a request or probe to a healthy host, and
+// ejects it if it exceeds the failure thresholds.
+func (r *HealthAwareRoute) record(h *hostHealth, failure bool) {
+	if failure {
+		h.consecutiveFailures++
+	} else {
+		h.consecutiveFailures = 0
+	}
+	h.window[h.results%len(h.window)] = failure
+	h.results++
+	if h.consecutiveFailures >= r.config.FailureThreshold ||
+		(h.results >= len(h.window) && h.errorRate() >= r.config.ErrorRateThreshold) {
+		r.config.Logger.Printf("[ROUTE] EJECT %s (%d consecutive failures, error rate %.2f)", h.url, h.consecutiveFailures, h.errorRate())
+		h.ejectedUntil = time.Now().Add(r.config.EjectionDuration)
+	}
+}
+
+func (r *HealthAwareRoute) run() {
+	ticker := time.NewTicker(r.config.ProbeInterval)
+	defer ticker.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-r.done
+		cancel()
+	}()
+	for {
+		r.Probe(ctx)
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// hostHealth is the health of a single host.
+type hostHealth struct {
+	url *url.URL
+	// latency is the moving average of the probe latency, zero if unknown.
+	latency time.Duration
+	// consecutiveFailures is the number of failures since the last success.
+	consecutiveFailures int
+	// window is a ring buffer of the most recent results, true on failure.
+	window  []bool
+	results int
+	// ejectedUntil is the time until the host is ejected, zero if healthy.
+	ejectedUntil time.Time
+}
+
+func (h *hostHealth) ejected() bool {
+	return !h.ejectedUntil.IsZero()
+}
+
+func (h *hostHealth) errorRate() float64 {
+	n := min(h.results, len(h.window))
+	if n == 0 {
+		return 0
+	}
+	var failures int
+	for _, failure := range h.window[:n] {
+		if failure {
+			failures++
+		}
+	}
+	return float64(failures) / float64(n)
+}
+
+// observeLatency updates the moving average of the latency.
+func (h *hostHealth) observeLatency(latency time.Duration) {
+	if h.latency == 0 {
+		h.latency = latency
+		return
+	}
+	h.latency = (7*h.latency + 3*latency) / 10
+}
+
+func (h *hostHealth) rank() time.Duration {
+	if h.latency == 0 {
+		return math.MaxInt64
+	}
+	return h.latency
+}
+
+// reset readmits the host and forgets its previous results.
+func (h *hostHealth) reset() {
+	h.ejectedUntil = time.Time{}
+	h.consecutiveFailures = 0
+	h.results = 0
+	clear(h.window)
+}
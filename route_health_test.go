@@ -0,0 +1,134 @@
+package agent_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestHealthAwareRoute(t *testing.T) {
+	var (
+		fastDown atomic.Bool
+		slow     = newStatusServer(t, 50*time.Millisecond, nil)
+		fast     = newStatusServer(t, 0, &fastDown)
+	)
+	rp, err := agent.NewHealthAwareRoute([]*url.URL{slow, fast}, agent.HealthAwareRouteConfig{
+		ProbeInterval:    time.Hour,
+		EjectionDuration: 10 * time.Millisecond,
+		PreferredHosts:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rp.Close()
+
+	rp.Probe(context.Background())
+	if got := route(t, rp); got != fast {
+		t.Fatalf("expected lowest-latency host %s, got %s", fast, got)
+	}
+
+	// Eject the fast host after three consecutive failures.
+	for range 3 {
+		rp.ReportResult(fast, &agent.HTTPError{StatusCode: http.StatusServiceUnavailable})
+	}
+	if got := route(t, rp); got != slow {
+		t.Fatalf("expected ejected host to be skipped, got %s", got)
+	}
+
+	// Client errors do not affect the health of a host.
+	for range 3 {
+		rp.ReportResult(slow, &agent.HTTPError{StatusCode: http.StatusBadRequest})
+	}
+	if got := route(t, rp); got != slow {
+		t.Fatalf("expected healthy host, got %s", got)
+	}
+
+	// The host is not readmitted while its probes fail.
+	fastDown.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	rp.Probe(context.Background())
+	if got := route(t, rp); got != slow {
+		t.Fatalf("expected failing host to stay ejected, got %s", got)
+	}
+
+	// A successful probe after the ejection duration readmits it.
+	fastDown.Store(false)
+	time.Sleep(20 * time.Millisecond)
+	rp.Probe(context.Background())
+	if got := route(t, rp); got != fast {
+		t.Fatalf("expected readmitted host %s, got %s", fast, got)
+	}
+}
+
+func TestHealthAwareRoute_Client(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica()
+	defer r.Close()
+	r.HandleQuery(canisterID, "greet", func(call agenttest.Call) ([]any, error) {
+		return []any{"Hello!"}, nil
+	})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+	deadURL, _ := url.Parse(dead.URL)
+
+	rp, err := agent.NewHealthAwareRoute([]*url.URL{r.URL(), deadURL}, agent.HealthAwareRouteConfig{
+		ProbeInterval:    time.Hour,
+		EjectionDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rp.Close()
+	config := r.AgentConfig()
+	config.ClientConfig = append(config.ClientConfig, agent.WithRouteProvider(rp))
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The failing host is ejected based on the feedback of the client, and
+	// the retries are routed to the healthy one.
+	for range 5 {
+		var out string
+		if err := a.Query(canisterID, "greet", nil, []any{&out}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 5 {
+		if got := route(t, rp); got == deadURL {
+			t.Fatal("expected failing host to be ejected")
+		}
+	}
+}
+
+// newStatusServer starts a server that responds to status requests after the
+// given delay, or with 503 if down is set.
+func newStatusServer(t *testing.T, delay time.Duration, down *atomic.Bool) *url.URL {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if down != nil && down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(s.Close)
+	u, _ := url.Parse(s.URL)
+	return u
+}
+
+func route(t *testing.T, rp agent.RouteProvider) *url.URL {
+	u, err := rp.Route()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
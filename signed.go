@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/niccolofant/agent-go/certification/hashtree"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// SignedRequest is a signed update call that can be submitted later, possibly
+// from another machine, by an agent that has no access to the private key.
+//
+// It contains the signed call envelope and a signed read_state envelope that
+// is used to poll the status of the call. Both are valid until the ingress
+// expiry. The request can be serialized with encoding/json.
+type SignedRequest struct {
+	// RequestID is the ID of the call.
+	RequestID RequestID `json:"request_id"`
+	// Sender is the principal that signed the call.
+	Sender principal.Principal `json:"sender"`
+	// CanisterID is the canister that is called.
+	CanisterID principal.Principal `json:"canister_id"`
+	// EffectiveCanisterID is the canister ID that is used to route the call.
+	EffectiveCanisterID principal.Principal `json:"effective_canister_id"`
+	// MethodName is the name of the called method.
+	MethodName string `json:"method_name"`
+	// IngressExpiry is the expiry of both envelopes, in nanoseconds since the
+	// Unix epoch.
+	IngressExpiry uint64 `json:"ingress_expiry"`
+	// Envelope is the CBOR encoded signed call envelope.
+	Envelope []byte `json:"envelope"`
+	// ReadStateEnvelope is the CBOR encoded signed read_state envelope that
+	// requests the status of the call.
+	ReadStateEnvelope []byte `json:"read_state_envelope"`
+}
+
+// Sign returns the signed envelopes of the call without sending it. The result
+// can be submitted with Agent.SubmitSignedEnvelope and Agent.WaitSigned.
+//
+// Example:
+//
+//	req, _ := a.CreateCandidAPIRequest(agent.RequestTypeCall, canisterID, "transfer", args)
+//	signed, _ := req.Sign()
+//	raw, _ := json.Marshal(signed) // Move to an online machine.
+func (c APIRequest[_, _]) Sign() (*SignedRequest, error) {
+	if c.typ != RequestTypeCall {
+		return nil, fmt.Errorf("can not sign %s request offline", c.typ)
+	}
+	_, readState, err := c.a.sign(Request{
+		Type:          RequestTypeReadState,
+		Sender:        c.a.Sender(),
+		Paths:         [][]hashtree.Label{{hashtree.Label("request_status"), c.requestID[:]}},
+		IngressExpiry: c.ingressExpiry,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SignedRequest{
+		RequestID:           c.requestID,
+		Sender:              c.a.Sender(),
+		CanisterID:          c.canisterID,
+		EffectiveCanisterID: c.effectiveCanisterID,
+		MethodName:          c.methodName,
+		IngressExpiry:       c.ingressExpiry,
+		Envelope:            c.data,
+		ReadStateEnvelope:   readState,
+	}, nil
+}
+
+// SubmitSignedEnvelope submits the signed call envelope, without waiting for
+// the result. The identity of the agent is not used. If submitting fails with a
+// network error the call might still have been received, WaitSigned can be
+// used to find out.
+func (a Agent) SubmitSignedEnvelope(ctx context.Context, req *SignedRequest) error {
+	a.logger.Printf("[AGENT] SUBMIT SIGNED %s %s (%x)", req.EffectiveCanisterID, req.MethodName, req.RequestID)
+	if _, err := a.call(ctx, req.EffectiveCanisterID, req.Envelope); err != nil {
+		return withCall(err, req.CanisterID, req.MethodName)
+	}
+	return nil
+}
+
+// WaitSigned polls the status of a submitted signed request with its signed
+// read_state envelope and returns the raw reply, e.g. the Candid encoded
+// result. The identity of the agent is not used.
+func (a Agent) WaitSigned(ctx context.Context, req *SignedRequest) ([]byte, error) {
+	ecID := req.EffectiveCanisterID
+	path := []hashtree.Label{hashtree.Label("request_status"), req.RequestID[:]}
+	raw, err := a.pollStatus(ctx, ecID, req.RequestID, req.IngressExpiry, func(ctx context.Context) ([]byte, hashtree.Node, error) {
+		a.logger.Printf("[AGENT] REQUEST STATUS %s %x", ecID, req.RequestID)
+		certificate, err := a.readSignedStateCertificate(ctx, ecID, req.ReadStateEnvelope)
+		if err != nil {
+			return nil, nil, err
+		}
+		return handleStatus(path, certificate)
+	})
+	if err != nil {
+		return nil, withCall(err, req.CanisterID, req.MethodName)
+	}
+	return raw, nil
+}
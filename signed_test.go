@@ -0,0 +1,71 @@
+package agent_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/candid"
+	"github.com/niccolofant/agent-go/identity"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestAgent_WaitSigned(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls())
+	defer r.Close()
+	r.HandleUpdate(canisterID, "whoami", func(call agenttest.Call) ([]any, error) {
+		return []any{call.Sender}, nil
+	})
+
+	// The offline agent never contacts the replica.
+	id, err := identity.NewRandomEd25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, err := agent.New(agent.Config{Identity: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := offline.CreateCandidAPIRequest(agent.RequestTypeCall, canisterID, "whoami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := req.Sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The online agent uses the anonymous identity.
+	online, err := agent.New(r.AgentConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received agent.SignedRequest
+	if err := json.Unmarshal(raw, &received); err != nil {
+		t.Fatal(err)
+	}
+	if received.RequestID != signed.RequestID {
+		t.Fatalf("request ID = %x, want %x", received.RequestID, signed.RequestID)
+	}
+	if err := online.SubmitSignedEnvelope(context.Background(), &received); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := online.WaitSigned(context.Background(), &received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sender principal.Principal
+	if err := candid.Unmarshal(reply, []any{&sender}); err != nil {
+		t.Fatal(err)
+	}
+	if !sender.Equal(id.Sender()) {
+		t.Errorf("sender = %s, want %s", sender, id.Sender())
+	}
+}
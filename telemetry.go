@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/niccolofant/agent-go/principal"
+)
+
+// Tracer starts spans. It mirrors the subset of the OpenTelemetry tracing API
+// that is used by the agent, so that an OpenTelemetry tracer can be plugged in
+// with a small adapter.
+//
+// The agent starts the following spans: "agent.call", "agent.submit",
+// "agent.poll", "agent.query", "agent.read_state",
+// "agent.verify_certificate", "agent.verify_query_signature" and
+// "agent.fetch_query_verification_keys".
+type Tracer interface {
+	// Start starts a span with the given name and attributes, as a child of
+	// the span in the context, if any.
+	Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	// RecordError records an error that occurred during the operation.
+	RecordError(err error)
+	// End ends the span.
+	End()
+}
+
+// Attribute is a key-value pair that describes a span.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Metrics records counters and histograms. See PrometheusMetrics for an
+// implementation that exposes them in the Prometheus text format.
+//
+// The agent records the following metrics:
+//
+//   - ic_agent_requests_total{type,canister_id,method,result}: the number of
+//     calls and queries, by result ("ok", "reject" or "error").
+//   - ic_agent_request_duration_seconds{type,canister_id,method}: the latency
+//     of calls (including polling) and queries.
+//   - ic_agent_rejects_total{type,canister_id,method,reject_code}: the number
+//     of rejected calls and queries.
+//   - ic_agent_polls_total{canister_id}: the number of request status polls.
+//   - ic_agent_verification_duration_seconds{kind}: the time spent verifying
+//     certificates and query signatures.
+//   - ic_agent_verification_failures_total{kind}: the number of failed
+//     verifications.
+type Metrics interface {
+	// AddCounter adds the given value to a counter.
+	AddCounter(name string, value float64, labels ...Label)
+	// ObserveHistogram adds an observation to a histogram.
+	ObserveHistogram(name string, value float64, labels ...Label)
+}
+
+// Label is a name-value pair that identifies a metric series.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// noopSpan is the span that is used if no tracer is configured.
+type noopSpan struct{}
+
+func (noopSpan) End() {}
+
+func (noopSpan) RecordError(error) {}
+
+// startSpan starts a span if a tracer is configured. The canister ID and
+// method name are added as attributes if they are set.
+func (a Agent) startSpan(ctx context.Context, name string, canisterID principal.Principal, methodName string) (context.Context, Span) {
+	if a.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	var attributes []Attribute
+	if canisterID.Raw != nil {
+		attributes = append(attributes, Attribute{Key: "ic.canister_id", Value: canisterID.Encode()})
+	}
+	if methodName != "" {
+		attributes = append(attributes, Attribute{Key: "ic.method", Value: methodName})
+	}
+	return a.tracer.Start(ctx, name, attributes...)
+}
+
+// endSpan records the error, if any, and ends the span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// startTimer returns the current time if metrics are recorded.
+func (a Agent) startTimer() time.Time {
+	if a.metrics == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// recordRequest records the result and latency of a call or query.
+func (a Agent) recordRequest(typ RequestType, canisterID principal.Principal, methodName string, start time.Time, err error) {
+	if a.metrics == nil {
+		return
+	}
+	canister := canisterID.Encode()
+	result := "ok"
+	var rejectErr *RejectError
+	switch {
+	case errors.As(err, &rejectErr):
+		result = "reject"
+		a.metrics.AddCounter("ic_agent_rejects_total", 1,
+			Label{Name: "type", Value: typ},
+			Label{Name: "canister_id", Value: canister},
+			Label{Name: "method", Value: methodName},
+			Label{Name: "reject_code", Value: strconv.FormatUint(uint64(rejectErr.RejectCode), 10)},
+		)
+	case err != nil:
+		result = "error"
+	}
+	a.metrics.AddCounter("ic_agent_requests_total", 1,
+		Label{Name: "type", Value: typ},
+		Label{Name: "canister_id", Value: canister},
+		Label{Name: "method", Value: methodName},
+		Label{Name: "result", Value: result},
+	)
+	a.metrics.ObserveHistogram("ic_agent_request_duration_seconds", time.Since(start).Seconds(),
+		Label{Name: "type", Value: typ},
+		Label{Name: "canister_id", Value: canister},
+		Label{Name: "method", Value: methodName},
+	)
+}
+
+// recordPoll records a request status poll.
+func (a Agent) recordPoll(ecID principal.Principal) {
+	if a.metrics == nil {
+		return
+	}
+	a.metrics.AddCounter("ic_agent_polls_total", 1, Label{Name: "canister_id", Value: ecID.Encode()})
+}
+
+// recordVerification records the duration and result of a verification.
+func (a Agent) recordVerification(kind string, start time.Time, err error) {
+	if a.metrics == nil {
+		return
+	}
+	a.metrics.ObserveHistogram("ic_agent_verification_duration_seconds", time.Since(start).Seconds(), Label{Name: "kind", Value: kind})
+	if err != nil {
+		a.metrics.AddCounter("ic_agent_verification_failures_total", 1, Label{Name: "kind", Value: kind})
+	}
+}
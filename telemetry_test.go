@@ -0,0 +1,175 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/niccolofant/agent-go"
+	"github.com/niccolofant/agent-go/agenttest"
+	"github.com/niccolofant/agent-go/principal"
+)
+
+func TestTelemetry(t *testing.T) {
+	canisterID := principal.MustDecode("ryjl3-tyaaa-aaaaa-aaaba-cai")
+	r := agenttest.NewReplica(agenttest.WithAsynchronousCalls())
+	defer r.Close()
+	r.HandleUpdate(canisterID, "greet", func(call agenttest.Call) ([]any, error) {
+		return []any{"Hello!"}, nil
+	})
+	r.HandleQuery(canisterID, "fail", func(call agenttest.Call) ([]any, error) {
+		return nil, &agenttest.Reject{Code: 5, Message: "failed"}
+	})
+
+	tracer := new(testTracer)
+	metrics := agent.NewPrometheusMetrics()
+	config := r.AgentConfig()
+	config.Tracer = tracer
+	config.Metrics = metrics
+	a, err := agent.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out string
+	if err := a.Call(canisterID, "greet", nil, []any{&out}); err != nil {
+		t.Fatal(err)
+	}
+	var rejectErr *agent.RejectError
+	if err := a.Query(canisterID, "fail", nil, nil); !errors.As(err, &rejectErr) {
+		t.Fatalf("expected reject error, got %v", err)
+	}
+
+	for _, name := range []string{
+		"agent.call", "agent.poll", "agent.read_state", "agent.verify_certificate",
+		"agent.query", "agent.fetch_query_verification_keys", "agent.verify_query_signature",
+	} {
+		if !tracer.started(name) {
+			t.Errorf("span %q was not started, got %v", name, tracer.names())
+		}
+	}
+	if !tracer.failed("agent.query") {
+		t.Error("expected error on query span")
+	}
+	if tracer.open != 0 {
+		t.Errorf("%d spans were not ended", tracer.open)
+	}
+
+	var b strings.Builder
+	if _, err := metrics.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE ic_agent_requests_total counter",
+		`ic_agent_requests_total{canister_id="ryjl3-tyaaa-aaaaa-aaaba-cai",method="greet",result="ok",type="call"} 1`,
+		`ic_agent_requests_total{canister_id="ryjl3-tyaaa-aaaaa-aaaba-cai",method="fail",result="reject",type="query"} 1`,
+		`ic_agent_rejects_total{canister_id="ryjl3-tyaaa-aaaaa-aaaba-cai",method="fail",reject_code="5",type="query"} 1`,
+		"# TYPE ic_agent_request_duration_seconds histogram",
+		`ic_agent_request_duration_seconds_bucket{canister_id="ryjl3-tyaaa-aaaaa-aaaba-cai",method="greet",type="call",le="+Inf"} 1`,
+		`ic_agent_request_duration_seconds_count{canister_id="ryjl3-tyaaa-aaaaa-aaaba-cai",method="greet",type="call"} 1`,
+		`ic_agent_verification_duration_seconds_count{kind="query_signature"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, b.String())
+		}
+	}
+	if !strings.Contains(b.String(), `ic_agent_polls_total{canister_id="ryjl3-tyaaa-aaaaa-aaaba-cai"}`) {
+		t.Errorf("missing polls in:\n%s", b.String())
+	}
+	if strings.Contains(b.String(), "ic_agent_verification_failures_total") {
+		t.Errorf("unexpected verification failures in:\n%s", b.String())
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := agent.NewPrometheusMetrics(1, 0.5)
+	m.AddCounter("c", 1, agent.Label{Name: "b", Value: "x\"y\\z\n"}, agent.Label{Name: "a", Value: "1"})
+	m.AddCounter("c", 2, agent.Label{Name: "a", Value: "1"}, agent.Label{Name: "b", Value: "x\"y\\z\n"})
+	m.ObserveHistogram("h", 0.75)
+	m.ObserveHistogram("h", 0.25)
+
+	var b strings.Builder
+	n, err := m.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE c counter
+c{a="1",b="x\"y\\z\n"} 3
+# TYPE h histogram
+h_bucket{le="0.5"} 1
+h_bucket{le="1"} 2
+h_bucket{le="+Inf"} 2
+h_sum 1
+h_count 2
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if n != int64(len(want)) {
+		t.Errorf("got %d bytes, want %d", n, len(want))
+	}
+}
+
+// testTracer records the started spans.
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+	open  int
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, _ ...agent.Attribute) (context.Context, agent.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &testSpan{tracer: t, name: name}
+	t.spans = append(t.spans, span)
+	t.open++
+	return ctx, span
+}
+
+func (t *testTracer) failed(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, span := range t.spans {
+		if span.name == name && span.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *testTracer) names() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var names []string
+	for _, span := range t.spans {
+		names = append(names, span.name)
+	}
+	return names
+}
+
+func (t *testTracer) started(name string) bool {
+	for _, n := range t.names() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+type testSpan struct {
+	tracer *testTracer
+	name   string
+	err    error
+}
+
+func (s *testSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.open--
+}
+
+func (s *testSpan) RecordError(err error) {
+	s.err = err
+}